@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// shellChars are the characters that make a command need a shell: pipes,
+// lists, redirections, expansions, globs and comments.
+const shellChars = "|&;$<>()`*?[]~{}#!\n"
+
+// directArgs returns the program and arguments command runs if it can be
+// started without a shell, or nil if it needs one. Commands are left to the
+// shell whenever there's doubt: anything using shell syntax, assigning a
+// variable, or naming something that isn't a program on the PATH, such as
+// a shell builtin. On Windows every command goes through cmd.exe.
+func directArgs(command string) []string {
+	if runtime.GOOS == "windows" || strings.ContainsAny(command, shellChars) {
+		return nil
+	}
+	args, ok := splitArgs(command)
+	if !ok || len(args) == 0 || strings.Contains(args[0], "=") {
+		return nil
+	}
+	if !strings.Contains(args[0], "/") {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			return nil
+		}
+	}
+	return args
+}
+
+// splitArgs splits command into words the way sh would for a command free
+// of expansions: whitespace separates words, single quotes keep everything
+// literally, and double quotes keep everything but \" and \\, which a
+// backslash escapes. Outside quotes a backslash escapes any character. It
+// reports false if a quote is left open or the command ends in a backslash.
+func splitArgs(command string) ([]string, bool) {
+	var (
+		args   []string
+		word   strings.Builder
+		inWord bool
+	)
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case c == ' ' || c == '\t':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\\':
+			if i+1 == len(command) {
+				return nil, false
+			}
+			i++
+			word.WriteByte(command[i])
+			inWord = true
+		case c == '\'':
+			end := strings.IndexByte(command[i+1:], '\'')
+			if end < 0 {
+				return nil, false
+			}
+			word.WriteString(command[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			closed := false
+			for i++; i < len(command); i++ {
+				if command[i] == '"' {
+					closed = true
+					break
+				}
+				if command[i] == '\\' && i+1 < len(command) && (command[i+1] == '"' || command[i+1] == '\\') {
+					i++
+				}
+				word.WriteByte(command[i])
+			}
+			if !closed {
+				return nil, false
+			}
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, true
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Codimow/Reflex/internal/dotenv"
+	"github.com/Codimow/Reflex/internal/watcher"
+)
+
+// envFile is a .env file whose variables the commands get. It is read again
+// when it changes, so the next run has the new values.
+type envFile struct {
+	path     string // As given, for messages
+	abs      string // Absolute path, to spot its events
+	required bool   // A missing file is an error rather than an empty one
+
+	mu   sync.Mutex
+	vars map[string]string
+}
+
+// loadEnvFile reads the .env file at path. Unless required, a missing file
+// counts as empty, and is read once it is created.
+func loadEnvFile(path string, required bool) (*envFile, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &envFile{path: path, abs: abs, required: required}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// reload reads the file again. On error the variables stay as they were.
+func (f *envFile) reload() error {
+	vars, err := dotenv.Load(f.path)
+	if errors.Is(err, fs.ErrNotExist) && !f.required {
+		vars, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.vars = vars
+	return nil
+}
+
+// changedBy returns the event in a batch that is a change to the file, if
+// there is one.
+func (f *envFile) changedBy(events []watcher.Event) (watcher.Event, bool) {
+	return fileEvent(events, f.abs)
+}
+
+// fileEvent returns the event in a batch for the file at the absolute path
+// abs, if there is one.
+func fileEvent(events []watcher.Event, abs string) (watcher.Event, bool) {
+	for _, ev := range events {
+		if p, err := filepath.Abs(ev.Path); err == nil && p == abs {
+			return ev, true
+		}
+	}
+	return watcher.Event{}, false
+}
+
+// env returns the variables for a command that aren't already set in
+// Reflex's own environment: those in overrides, and those in the file that
+// overrides doesn't have. So Reflex's environment comes first, then the
+// overrides (--env), then the file.
+func (f *envFile) env(overrides map[string]string) map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	env := make(map[string]string, len(f.vars)+len(overrides))
+	for k, v := range f.vars {
+		env[k] = v
+	}
+	for k, v := range overrides {
+		env[k] = v
+	}
+	for k := range env {
+		if _, ok := os.LookupEnv(k); ok {
+			delete(env, k)
+		}
+	}
+	return env
+}
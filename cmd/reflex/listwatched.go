@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/Codimow/Reflex/internal/watcher"
+)
+
+// defaultInotifyWatches is the usual per-user limit on inotify watches,
+// for when the real one can't be read.
+const defaultInotifyWatches = 8192
+
+// listWatched prints the directories the watcher would watch, with the
+// number of matching files in each, and the rules that decided them, for
+// --list-watched.
+func listWatched(opts options) error {
+	dirs, err := watcher.List(opts.roots, opts.patterns, watcherOptions(opts)...)
+	if err != nil {
+		return fmt.Errorf("failed to list watched files: %w", err)
+	}
+
+	fmt.Printf("Patterns:       %s\n", strings.Join(opts.patterns, ", "))
+	fmt.Printf("Always ignored: %s\n", strings.Join(watcher.IgnoredDirs(), ", "))
+	if len(opts.excludes) > 0 {
+		fmt.Printf("Excluded:       %s\n", strings.Join(opts.excludes, ", "))
+	}
+	if opts.gitignore {
+		fmt.Println("Ignore files:   .gitignore, .reflexignore")
+	} else {
+		fmt.Println("Ignore files:   .reflexignore (--no-gitignore)")
+	}
+	fmt.Println()
+
+	total := 0
+	for _, d := range dirs {
+		fmt.Printf("%6d  %s\n", d.Files, d.Dir)
+		total += d.Files
+	}
+	fmt.Printf("%d directories, %d matching files\n", len(dirs), total)
+
+	// Each directory takes an inotify watch, unless polling
+	if runtime.GOOS == "linux" && opts.pollInterval == 0 {
+		if limit := inotifyWatchLimit(); len(dirs) > limit {
+			fmt.Fprintf(os.Stderr, "\nWarning: %d directories is more than the %d inotify watches allowed, so changes in some are missed.\n", len(dirs), limit)
+			fmt.Fprintln(os.Stderr, "Raise the limit with: sudo sysctl fs.inotify.max_user_watches=524288")
+			fmt.Fprintln(os.Stderr, "or narrow what is watched with --watch, --ignore or .reflexignore, or use --poll.")
+		}
+	}
+	return nil
+}
+
+// inotifyWatchLimit returns how many inotify watches a user may have.
+func inotifyWatchLimit() int {
+	data, err := os.ReadFile("/proc/sys/fs/inotify/max_user_watches")
+	if err != nil {
+		return defaultInotifyWatches
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return defaultInotifyWatches
+	}
+	return limit
+}
@@ -21,7 +21,12 @@
 // 1. Watcher monitors the filesystem and emits events on file changes
 // 2. Controller receives events and orchestrates process restarts
 // 3. Process Manager handles the child process lifecycle (start/stop/output)
-// 4. UI displays status and streams process output to the terminal
+// 4. UI displays status and streams process output to the terminal; when
+//    stdout isn't a terminal, plain prefixed lines are written instead
+// 5. Optionally, a dev proxy forwards HTTP traffic to the child and reports
+//    each request to the UI
+// 6. Optionally, a local JSON API reports status and logs and accepts
+//    restart requests
 //
 // Shutdown:
 // - SIGINT/SIGTERM triggers graceful shutdown via context cancellation
@@ -31,61 +36,158 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/Codimow/Reflex/internal/api"
+	"github.com/Codimow/Reflex/internal/config"
+	"github.com/Codimow/Reflex/internal/har"
+	"github.com/Codimow/Reflex/internal/healthcheck"
+	"github.com/Codimow/Reflex/internal/logfile"
+	"github.com/Codimow/Reflex/internal/logging"
+	"github.com/Codimow/Reflex/internal/metrics"
 	"github.com/Codimow/Reflex/internal/process"
+	"github.com/Codimow/Reflex/internal/proxy"
 	"github.com/Codimow/Reflex/internal/ui"
 	"github.com/Codimow/Reflex/internal/watcher"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
 )
 
-// Default file extensions to watch.
-// These cover common web development file types.
-// Note: .json is intentionally excluded because build tools (Next.js, npm, etc.)
-// frequently modify package.json, lock files, and other JSON configs, causing
-// unwanted restarts.
-var defaultExtensions = []string{
-	".js", ".ts", ".jsx", ".tsx",
-	".css", ".scss", ".sass",
-	".mdx", ".md",
-	".html", ".vue", ".svelte",
-}
-
-// restartDebounce is the delay between detecting a file change and restarting
-// the process. This prevents rapid restarts when multiple files change at once
-// (e.g., during a git checkout or editor save-all).
-const restartDebounce = 250 * time.Millisecond
-
 func main() {
 	if err := run(); err != nil {
+		var exit exitError
+		if errors.As(err, &exit) {
+			os.Exit(exit.code)
+		}
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
+// exitError makes Reflex exit with code without an error message, as
+// --once does when the command fails.
+type exitError struct {
+	code int
+}
+
+func (e exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
 // run is the main application logic, separated for cleaner error handling.
 func run() error {
-	// Parse command line arguments
-	command, err := parseArgs()
+	// "reflex init" writes a starter config file and exits
+	if len(os.Args) == 2 && os.Args[1] == "init" {
+		if err := config.WriteTemplate(config.TemplateFileName); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %s\n", config.TemplateFileName)
+		return nil
+	}
+
+	// Resolve settings from the config file and command line arguments
+	opts, err := parseArgs()
 	if err != nil {
 		return err
 	}
 
+	// Reflex's own messages, and those of the standard library's servers,
+	// go through logging so the TUI can keep them off its screen
+	log.SetFlags(0)
+	log.SetOutput(logging.Writer())
+	if opts.debugLog != "" {
+		file, err := os.OpenFile(opts.debugLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open debug log: %w", err)
+		}
+		defer file.Close()
+		logging.SetOutput(logging.ToWriter(file))
+	}
+
 	// Create a root context that cancels on SIGINT or SIGTERM.
 	// This enables graceful shutdown when the user presses Ctrl+C.
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
+	if opts.listWatched {
+		return listWatched(opts)
+	}
+	if opts.once {
+		return runOnce(ctx, opts)
+	}
+	if !opts.tui {
+		return runPlain(ctx, opts)
+	}
+	return runTUI(ctx, cancel, opts)
+}
+
+// runTUI runs the controller alongside the Bubbletea UI until the user quits
+// or the controller fails.
+func runTUI(ctx context.Context, cancel context.CancelFunc, opts options) error {
 	// Initialize the Bubbletea UI program with alternate screen mode
 	// (preserves the user's terminal history on exit)
-	program := tea.NewProgram(ui.New(), tea.WithAltScreen())
+	names := make([]string, len(opts.tasks))
+	for i, t := range opts.tasks {
+		names[i] = t.name
+	}
+	// The UI asks for restarts on this channel when the user presses r, and
+	// to pause or resume them on pauses when they press p
+	manual := make(chan ui.ManualRestartMsg, 1)
+	pauses := make(chan ui.PauseMsg, 1)
+	stops := make(chan ui.StopMsg, 1)
+	uiOpts := ui.Options{
+		Tasks:       names,
+		ProxyPane:   opts.proxyPort != 0,
+		MaxLogLines: opts.maxLogLines,
+		Restarts:    manual,
+		Pauses:      pauses,
+		Stops:       stops,
+		Timestamps:  opts.timestamps,
+		Quiet:       opts.quiet,
+	}
+	// With --interactive, keys typed into the UI reach the processes'
+	// stdin through a pipe each
+	var stdin map[string]io.Reader
+	if opts.interactive {
+		input := make(chan ui.InputMsg, 64)
+		uiOpts.Input = input
+		stdin = forwardInput(ctx, input, names, opts.pty)
+	}
+	model := ui.New(uiOpts)
+	if !opts.color {
+		lipgloss.SetColorProfile(termenv.Ascii)
+	}
+	program := tea.NewProgram(model, tea.WithAltScreen())
+
+	// Anything written to stderr would end up on the UI's screen, so log
+	// messages are shown in the panes unless they go to --debug-log
+	if opts.debugLog == "" {
+		logging.SetOutput(func(text string) {
+			program.Send(ui.LogMsg{Text: text, Time: time.Now()})
+		})
+		defer logging.SetOutput(nil)
+	}
 
 	// WaitGroup to coordinate goroutine shutdown
 	var wg sync.WaitGroup
@@ -93,23 +195,46 @@ func run() error {
 	// Channel to propagate fatal errors from goroutines
 	errChan := make(chan error, 1)
 
+	// Pressing q stops the processes with SIGINT while the UI stays up to
+	// show it; pressing it again kills them
+	stop := &stopper{force: make(chan struct{})}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case msg := <-stops:
+				if msg.Force {
+					stop.kill()
+				} else {
+					stop.interrupt()
+					cancel()
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
 	// Start the controller goroutine that orchestrates watcher → process → UI
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := runController(ctx, program, command); err != nil {
+		requests := uiRequests{restarts: manual, pauses: pauses, stop: stop, stdin: stdin}
+		if err := runController(ctx, tuiSink{program: program}, requests, opts); err != nil {
 			// Send error to main goroutine (non-blocking)
 			select {
 			case errChan <- err:
 			default:
 			}
-			// Quit the UI on controller error
-			program.Send(tea.Quit())
 		}
+		// Quit the UI once the processes have stopped, whatever the reason
+		program.Send(tea.Quit())
 	}()
 
 	// Run the UI (blocking). This returns when:
-	// - User presses 'q' or Ctrl+C in the UI
+	// - The controller has stopped after the user pressed 'q' or Ctrl+C
+	// - User presses 'q' or Ctrl+C again, to force the exit
 	// - program.Quit() is called
 	// - An error occurs
 	_, uiErr := program.Run()
@@ -130,112 +255,1326 @@ func run() error {
 	return uiErr
 }
 
-// parseArgs validates and returns the command to run.
-func parseArgs() (string, error) {
-	if len(os.Args) < 2 {
-		return "", fmt.Errorf("usage: reflex <command>\n\nExample:\n  reflex \"npm run dev\"\n  reflex \"go run .\"")
+// forwardInput writes the keys typed into the UI for each of the named
+// tasks to a pipe, and returns the pipes to read them from, by name. On a
+// pipe rather than a terminal, enter ends a line with \n. The pipes close
+// once ctx is done.
+func forwardInput(ctx context.Context, input <-chan ui.InputMsg, names []string, pty bool) map[string]io.Reader {
+	readers := make(map[string]io.Reader, len(names))
+	writers := make(map[string]*io.PipeWriter, len(names))
+	for _, name := range names {
+		readers[name], writers[name] = io.Pipe()
+	}
+	go func() {
+		defer func() {
+			for _, w := range writers {
+				w.Close()
+			}
+		}()
+		for {
+			select {
+			case msg := <-input:
+				data := msg.Data
+				if !pty {
+					data = bytes.ReplaceAll(data, []byte("\r"), []byte("\n"))
+				}
+				writers[msg.Task].Write(data)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return readers
+}
+
+// runPlain runs the controller without a TUI, streaming process output to
+// stdout. It returns when the context is cancelled or the controller fails.
+func runPlain(ctx context.Context, opts options) error {
+	var requests uiRequests
+	if opts.interactive {
+		// Only a single task gets past parseArgs
+		requests.stdin = map[string]io.Reader{opts.tasks[0].name: os.Stdin}
+	}
+	return runController(ctx, streamSink(opts), requests, opts)
+}
+
+// streamSink returns the sink for output streamed to stdout rather than
+// shown in the TUI: JSON lines with --json, plain text otherwise, which
+// --quiet cuts down to statuses and the stderr of crashed runs.
+func streamSink(opts options) outputSink {
+	if opts.json {
+		return newJSONSink(os.Stdout)
+	}
+	var sink outputSink = &plainSink{
+		w:          os.Stdout,
+		errW:       os.Stderr,
+		timestamps: opts.timestamps,
+		dim:        opts.color,
+		omitOutput: opts.logFile == logfile.Stdout && !opts.once,
+	}
+	if opts.quiet {
+		sink = &quietSink{outputSink: sink}
 	}
-	return os.Args[1], nil
+	return sink
+}
+
+// runOnce runs each task once, without watching for changes, streaming
+// output as in plain mode. It returns once every task has finished, with
+// an exitError carrying the first failing task's exit code.
+func runOnce(ctx context.Context, opts options) error {
+	sink := streamSink(opts)
+	if !opts.color {
+		sink = noColorSink{outputSink: sink}
+	}
+
+	codes := make([]int, len(opts.tasks))
+	var wg sync.WaitGroup
+	for i, t := range opts.tasks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if t.build != "" {
+				if codes[i] = runCommandOnce(ctx, sink, t.name, t.build, nil, opts); codes[i] != 0 {
+					sink.Status(t.name, fmt.Sprintf("Build failed (exit %d)", codes[i]))
+					return
+				}
+			}
+			var stdin io.Reader
+			if opts.interactive {
+				stdin = os.Stdin
+			}
+			codes[i] = runCommandOnce(ctx, sink, t.name, t.command, stdin, opts)
+		}()
+	}
+	wg.Wait()
+
+	for _, code := range codes {
+		if code != 0 {
+			return exitError{code: code}
+		}
+	}
+	return nil
+}
+
+// runCommandOnce runs command to completion, fed stdin unless it is nil,
+// and returns its exit code. A command killed by a signal counts as exit
+// code 1, and one stopped because ctx was cancelled (Ctrl+C) as 130, like a
+// shell would report.
+func runCommandOnce(ctx context.Context, sink outputSink, name, command string, stdin io.Reader, opts options) int {
+	var procOpts []process.Option
+	if stdin != nil {
+		procOpts = append(procOpts, process.WithStdin(stdin))
+	}
+	proc := newManager(command, opts, procOpts...)
+	exits := make(chan process.Exit)
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go streamOutput(streamCtx, sink, name, proc, exits)
+
+	if err := proc.Start(); err != nil {
+		sink.Status(name, "Error: failed to start")
+		sink.Line(name, process.Line{Text: fmt.Sprintf("Error: %v", err), Source: process.Stderr})
+		return 1
+	}
+
+	select {
+	case ex := <-exits:
+		if ex.Code < 0 {
+			return 1
+		}
+		return ex.Code
+	case <-ctx.Done():
+		proc.StopGraceful(opts.killTimeout)
+		return 130
+	}
+}
+
+// Crash restart backoff: the delay starts at minBackoff and doubles with each
+// consecutive crash up to maxBackoff. A run lasting stableUptime resets it.
+const (
+	minBackoff   = 500 * time.Millisecond
+	maxBackoff   = 10 * time.Second
+	stableUptime = 30 * time.Second
+)
+
+// batchWindow is how long after a change further changes are gathered into
+// the same batch. A shorter --debounce shortens it too.
+const batchWindow = 100 * time.Millisecond
+
+// uiRequests carries what the user asks of the controller from the UI.
+// All are nil without one.
+type uiRequests struct {
+	restarts <-chan ui.ManualRestartMsg
+	pauses   <-chan ui.PauseMsg
+	stop     *stopper // How the processes stop on exit
+
+	stdin map[string]io.Reader // Input for each task's process by name, with --interactive
 }
 
 // runController is the main event loop that coordinates the watcher,
 // process manager, and UI. It runs until the context is cancelled.
-func runController(ctx context.Context, program *tea.Program, command string) error {
+func runController(ctx context.Context, sink outputSink, requests uiRequests, opts options) error {
+	// Only the display loses its colors; the log file keeps them
+	if !opts.color {
+		sink = noColorSink{outputSink: sink}
+	}
+
+	// Keep a persistent copy of the output that survives restarts
+	if opts.logFile != "" {
+		file, err := logfile.Open(opts.logFile, opts.logMaxSize, logfile.WithKeep(opts.logKeep))
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		logSink := &logFileSink{outputSink: sink, file: file}
+		defer logSink.close()
+		sink = logSink
+	}
+
 	// Initialize the file watcher
-	watcherEvents, err := watcher.New(".", defaultExtensions)
+	w, err := watcher.New(opts.roots, opts.patterns, watcherOptions(opts)...)
 	if err != nil {
 		return fmt.Errorf("failed to create file watcher: %w", err)
 	}
+	sink.Watching(w.Stats())
 
-	// Track the current process (may be nil if not running)
-	var currentProc *process.Manager
+	// Start the dev proxy if requested. It lives for the whole session so
+	// the browser keeps a stable address across restarts.
+	var replays *proxy.ReplayStore
+	var backend *backendState
+	if opts.proxyPort != 0 {
+		// Deferred ahead of the tasks, so it runs once they have stopped
+		if opts.harOutput != "" {
+			recorder := har.NewRecorder(proxyURL(opts))
+			sink = harSink{outputSink: sink, recorder: recorder}
+			defer writeHAR(recorder, opts.harOutput)
+		}
 
-	// Ensure we always clean up the process on exit
-	defer func() {
-		if currentProc != nil {
-			program.Send(ui.StatusUpdateMsg{Status: "Stopping..."})
-			currentProc.Stop()
+		var handler *proxy.ProxyHandler
+		if handler, replays, err = startProxy(ctx, sink, opts); err != nil {
+			return err
 		}
-	}()
+		backend = &backendState{proxy: handler}
+	}
 
-	// Start the initial process
-	program.Send(ui.StatusUpdateMsg{Status: "Starting process..."})
-	currentProc = startProcess(ctx, program, command)
+	// The task serving the proxy target has to open the target's port,
+	// unless --wait-for says what to wait for. With several tasks and no
+	// --serve there's no telling which one does.
+	waitFor, waitPort := opts.waitFor, 0
+	if waitFor == nil && opts.proxyPort != 0 && slices.ContainsFunc(opts.tasks, func(t task) bool { return t.serves }) {
+		port, err := targetPort(opts.proxyTarget)
+		if err != nil {
+			return err
+		}
+		waitFor, waitPort = healthcheck.PortTarget(port), port
+	}
+
+	// Serve the control API if requested; apiRestarts stays nil otherwise
+	var apiRestarts <-chan struct{}
+	if opts.apiPort != 0 {
+		server := api.NewServer()
+		if replays != nil {
+			server.Replay = replays.Replay
+		}
+		addr := fmt.Sprintf("127.0.0.1:%d", opts.apiPort)
+		if err := server.ListenAndServe(ctx, addr); err != nil {
+			return fmt.Errorf("failed to start API on %s: %w", addr, err)
+		}
+		sink = apiSink{outputSink: sink, server: server}
+		apiRestarts = server.Restarts()
+	}
+
+	// Each task runs in its own goroutine so a slow stop in one doesn't
+	// hold up the others. They all stop their processes once ctx is done,
+	// including when the controller returns with an error.
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	runners := make([]*taskRunner, len(opts.tasks))
+	for i, t := range opts.tasks {
+		runners[i] = newTaskRunner(t, sink, opts)
+		if t.serves {
+			runners[i].backend = backend
+			runners[i].waitFor = waitFor
+			runners[i].waitPort = waitPort
+		}
+		runners[i].stop = requests.stop
+		runners[i].stdin = requests.stdin[t.name]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runners[i].run(ctx)
+		}()
+	}
+
+	// Group bursts of changes so each is logged and routed once
+	batches := watcher.Coalesce(w.Events(), min(opts.debounce, batchWindow))
+
+	// The command each task runs, by name, to spot new ones in the config
+	// file
+	commands := make(map[string]string, len(opts.tasks))
+	for _, t := range opts.tasks {
+		commands[t.name] = t.command
+	}
+
+	// While paused, changes are remembered rather than routed, and each
+	// task they concern restarts once on resume
+	paused := false
+	changedWhilePaused := make(map[*taskRunner]bool)
+
+	// A restart storm pauses restarts the same way until stormOver fires
+	throttle := newRestartThrottle(opts.maxRestartsPerMinute, opts.debounce)
+	var stormOver <-chan time.Time
 
-	// Main event loop: wait for file changes or shutdown signal
+	// Main event loop: route file changes to the tasks they concern
 	for {
 		select {
 		case <-ctx.Done():
 			// Graceful shutdown requested (Ctrl+C or SIGTERM)
-			log.Println("Shutdown signal received, cleaning up...")
+			logging.Println("Shutdown signal received, cleaning up...")
 			return nil
 
-		case event, ok := <-watcherEvents:
+		case events, ok := <-batches:
 			if !ok {
 				// Watcher channel closed (shouldn't happen normally)
 				return fmt.Errorf("file watcher closed unexpectedly")
 			}
+			if events = keepOps(events, opts.ops); len(events) == 0 {
+				continue
+			}
 
-			// File change detected — restart the process
-			log.Printf("File changed: %s", event.Path)
-			program.Send(ui.StatusUpdateMsg{Status: "Restarting..."})
+			if len(events) == 1 {
+				logging.Printf("File changed (%s): %s", events[0].Op, events[0].Path)
+			} else {
+				paths := make([]string, len(events))
+				for i, ev := range events {
+					paths[i] = ev.Path
+				}
+				logging.Printf("%d files changed: %s", len(events), strings.Join(paths, ", "))
+			}
+			sink.Changed(events)
+			reasons := make(map[*taskRunner]restartRequest)
+			for _, r := range runners {
+				if req, ok := changeRequest(r.filter, events); ok {
+					reasons[r] = req
+				}
+			}
+			// Every command gets the .env variables, so all of them restart
+			// with the new values
+			if ev, ok := opts.envFile.changedBy(events); ok {
+				if err := opts.envFile.reload(); err != nil {
+					logging.Printf("Not restarting for the changed env file: %v", err)
+				} else {
+					for _, r := range runners {
+						reasons[r] = restartRequest{reason: fmt.Sprintf("%s changed", ev.Path), files: []string{ev.Path}}
+					}
+				}
+			}
+			if opts.configPath != "" {
+				if _, ok := fileEvent(events, opts.configPath); ok {
+					reloadCommands(opts.configPath, runners, commands)
+				}
+			}
+			if len(reasons) > 0 && !paused && stormOver == nil && throttle.storm(time.Now()) {
+				logging.Printf("Restart storm detected, pausing restarts for %s", stormPause)
+				for _, r := range runners {
+					if _, ok := reasons[r]; ok {
+						sink.Status(r.task.name, fmt.Sprintf("Restart storm detected — paused for %s", stormPause))
+					}
+				}
+				stormOver = time.After(stormPause)
+			}
+			for _, r := range runners {
+				req, ok := reasons[r]
+				switch {
+				case !ok:
+				case paused || stormOver != nil:
+					changedWhilePaused[r] = true
+				default:
+					r.trigger(req)
+				}
+			}
+
+		case limit := <-w.LimitReached():
+			sink.WatchLimit(limit)
 
-			// Stop the current process if running
-			if currentProc != nil {
-				currentProc.Stop()
-				currentProc = nil
+		case <-stormOver:
+			stormOver = nil
+			throttle.reset()
+			logging.Println("Restart storm pause over")
+			if !paused {
+				resume(runners, changedWhilePaused)
 			}
 
-			// Debounce: wait a bit for more changes to settle
-			// This prevents rapid restarts during batch file operations
-			select {
-			case <-ctx.Done():
-				return nil
-			case <-time.After(restartDebounce):
+		case <-apiRestarts:
+			logging.Println("Restart requested via API")
+			for _, r := range runners {
+				r.trigger(restartRequest{reason: "requested via API"})
+			}
+
+		case msg := <-requests.restarts:
+			logging.Println("Manual restart requested from the UI")
+			for _, r := range runners {
+				if r.task.name == msg.Task {
+					r.trigger(restartRequest{reason: "manual restart"})
+				}
 			}
 
-			// Clear logs and start fresh
-			program.Send(ui.ClearLogsMsg{})
-			currentProc = startProcess(ctx, program, command)
+		case msg := <-requests.pauses:
+			if msg.Paused == paused {
+				break
+			}
+			paused = msg.Paused
+			if paused {
+				logging.Println("Restarts paused from the UI")
+				break
+			}
+			logging.Println("Restarts resumed from the UI")
+			if stormOver == nil {
+				resume(runners, changedWhilePaused)
+			}
 		}
 	}
 }
 
-// startProcess creates and starts a new child process, streaming its output
-// to the UI. Returns the process manager (or nil on failure).
-func startProcess(ctx context.Context, program *tea.Program, command string) *process.Manager {
-	proc := process.NewManager(command)
+// watcherOptions returns the watcher settings opts asks for.
+func watcherOptions(opts options) []watcher.Option {
+	var watchOpts []watcher.Option
+	if !opts.gitignore {
+		watchOpts = append(watchOpts, watcher.WithoutGitignore())
+	}
+	if !opts.contentCheck {
+		watchOpts = append(watchOpts, watcher.WithoutContentCheck())
+	}
+	if opts.followSymlinks {
+		watchOpts = append(watchOpts, watcher.WithFollowSymlinks())
+	}
+	if opts.diff {
+		watchOpts = append(watchOpts, watcher.WithDiffs())
+	}
+	if opts.pollInterval > 0 {
+		watchOpts = append(watchOpts, watcher.WithPolling(opts.pollInterval))
+	}
+	if len(opts.excludes) > 0 {
+		watchOpts = append(watchOpts, watcher.WithExcludeRegexps(opts.excludes))
+	}
+	// The .env file matches no pattern, and is often in .gitignore; nor
+	// may the config file, which is watched for new commands
+	files := []string{opts.envFile.path}
+	if opts.configPath != "" {
+		files = append(files, opts.configPath)
+	}
+	return append(watchOpts, watcher.WithFiles(files))
+}
 
-	if err := proc.Start(); err != nil {
-		log.Printf("Failed to start process: %v", err)
-		program.Send(ui.StatusUpdateMsg{Status: "Error: failed to start"})
-		program.Send(ui.ProcessOutputLineMsg{Line: fmt.Sprintf("Error: %v", err)})
-		return nil
+// resume restarts each task that files changed for while restarts were
+// paused, once, and forgets the changes.
+func resume(runners []*taskRunner, changed map[*taskRunner]bool) {
+	for _, r := range runners {
+		if changed[r] {
+			r.trigger(restartRequest{reason: "files changed while paused"})
+		}
 	}
+	clear(changed)
+}
 
-	program.Send(ui.StatusUpdateMsg{Status: "Running"})
+// reloadCommands reads the config file at path again and hands each task
+// whose command has changed since commands was last updated its new one.
+// Tasks added to or removed from the file need Reflex to be restarted.
+func reloadCommands(path string, runners []*taskRunner, commands map[string]string) {
+	cfg, err := config.Load(path)
+	var tasks []task
+	if err == nil {
+		tasks, err = resolveTasks(cfg, nil, nil)
+	}
+	if err != nil {
+		logging.Printf("Not reloading the commands: %v", err)
+		return
+	}
 
-	// Stream process output to the UI in a separate goroutine.
-	// This goroutine exits when:
-	// - The process exits (output channel closes)
-	// - The context is cancelled (we stop reading)
+	known := 0
+	for _, t := range tasks {
+		old, ok := commands[t.name]
+		if !ok {
+			logging.Printf("Restart Reflex to run the new task %q in %s", t.name, path)
+			continue
+		}
+		known++
+		if t.command == old {
+			continue
+		}
+		commands[t.name] = t.command
+		for _, r := range runners {
+			if r.task.name == t.name {
+				logging.Printf("Command changed in %s: %s", path, t.command)
+				r.setCommand(t.command)
+			}
+		}
+	}
+	if known < len(commands) {
+		logging.Printf("Restart Reflex to stop tasks removed from %s", path)
+	}
+}
+
+// keepOps returns the events in a batch for the kinds of change in ops.
+func keepOps(events []watcher.Event, ops watcher.Op) []watcher.Event {
+	if ops == watcher.AllOps {
+		return events
+	}
+	var kept []watcher.Event
+	for _, ev := range events {
+		if ev.Op&ops != 0 {
+			kept = append(kept, ev)
+		}
+	}
+	return kept
+}
+
+// changeRequest asks for a restart for the events in a batch that filter
+// matches, with their paths as the files. It reports false if none match.
+func changeRequest(filter watcher.Filter, events []watcher.Event) (restartRequest, bool) {
+	var files []string
+	for _, ev := range events {
+		if filter.Match(ev) {
+			files = addPaths(files, ev.Path)
+		}
+	}
+	if len(files) == 0 {
+		return restartRequest{}, false
+	}
+	return restartRequest{reason: changedReason(files), files: files}, true
+}
+
+// changedReason describes a restart for changed files, such as "main.go
+// changed" or "12 files changed".
+func changedReason(files []string) string {
+	if len(files) == 1 {
+		return fmt.Sprintf("%s changed", files[0])
+	}
+	return fmt.Sprintf("%d files changed", len(files))
+}
+
+// addPaths appends to paths those of more it doesn't already hold.
+func addPaths(paths []string, more ...string) []string {
+	for _, p := range more {
+		if !slices.Contains(paths, p) {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// taskRunner owns the process of a single task: it restarts it on request,
+// debounces bursts of changes, and recovers from crashes.
+type taskRunner struct {
+	task   task
+	filter watcher.Filter // Files that restart this task
+	sink   outputSink
+	opts   options
+
+	// restarts carries a pending restart request. Requests that arrive
+	// while one is pending are merged into it.
+	restarts chan restartRequest
+
+	// commands carries a new command for the task, which replaces the old
+	// one and restarts it.
+	commands chan string
+
+	// backend tells the dev proxy when the process is down; nil without
+	// the proxy, or if the task doesn't serve its target.
+	backend *backendState
+
+	// waitFor has to be ready after each start before the process counts
+	// as running and the proxy lets requests through; nil skips the check,
+	// as for every task but the one serving the proxy target.
+	waitFor *url.URL
+
+	// waitPort is the proxy target's port when waitFor is just that port
+	// rather than given with --wait-for; 0 otherwise.
+	waitPort int
+
+	// stop stops the process when the runner is done; nil stops it with
+	// SIGTERM.
+	stop *stopper
+
+	// stdin is fed to the process, across restarts; nil leaves its input
+	// empty.
+	stdin io.Reader
+}
+
+// healthResult is the outcome of the health check for one run.
+type healthResult struct {
+	run int
+	err error
+}
+
+// healthInterval is how often the health check tries the port.
+const healthInterval = 100 * time.Millisecond
+
+// backendState tells the dev proxy when the process behind it is down, so
+// it holds requests rather than failing them. Only the task that serves the
+// proxy target has one; other tasks restarting don't concern the proxy.
+type backendState struct {
+	proxy *proxy.ProxyHandler
+}
+
+// set records whether the process is up. It does nothing on a nil
+// backendState.
+func (b *backendState) set(up bool) {
+	if b == nil {
+		return
+	}
+	if up {
+		b.proxy.BackendUp()
+	} else {
+		b.proxy.BackendDown()
+	}
+}
+
+// stopper decides how the task runners stop their processes on exit: with
+// SIGTERM, or with SIGINT once the user has asked from the UI, escalating to
+// SIGKILL after the kill timeout, or at once if they ask again.
+type stopper struct {
+	mu          sync.Mutex
+	interrupted bool
+	force       chan struct{} // Closed to kill the processes still stopping
+}
+
+// interrupt makes processes stopped from now on get SIGINT.
+func (s *stopper) interrupt() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.interrupted = true
+}
+
+// kill kills the processes that are stopping, and any stopped later.
+func (s *stopper) kill() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.force:
+	default:
+		close(s.force)
+	}
+}
+
+// stop stops proc, allowing it timeout to exit. On a nil stopper it is
+// proc.StopGraceful.
+func (s *stopper) stop(proc *process.Manager, timeout time.Duration) {
+	if s == nil {
+		proc.StopGraceful(timeout)
+		return
+	}
+	s.mu.Lock()
+	interrupted := s.interrupted
+	s.mu.Unlock()
+
+	stopped := make(chan struct{})
 	go func() {
-		for {
+		defer close(stopped)
+		if interrupted {
+			proc.Interrupt(timeout)
+		} else {
+			proc.StopGraceful(timeout)
+		}
+	}()
+	select {
+	case <-stopped:
+	case <-s.force:
+		proc.Kill()
+		<-stopped
+	}
+}
+
+func newTaskRunner(t task, sink outputSink, opts options) *taskRunner {
+	return &taskRunner{
+		task:     t,
+		filter:   watcher.NewFilter(t.patterns),
+		sink:     sink,
+		opts:     opts,
+		restarts: make(chan restartRequest, 1),
+		commands: make(chan string, 1),
+	}
+}
+
+// restartRequest is a request for a task to restart.
+type restartRequest struct {
+	reason string   // Shown with the restart, e.g. "./a.js changed"
+	files  []string // The changed files behind it, if any
+}
+
+// trigger asks the runner to restart its process. It never blocks: a
+// request the runner hasn't taken yet is merged into this one, so the
+// files it names aren't lost.
+func (r *taskRunner) trigger(req restartRequest) {
+	select {
+	case pending := <-r.restarts:
+		if files := addPaths(pending.files, req.files...); len(req.files) > 0 {
+			req = restartRequest{reason: changedReason(files), files: files}
+		} else {
+			req.files = files
+		}
+	default:
+	}
+	select {
+	case r.restarts <- req:
+	default:
+	}
+}
+
+// setCommand asks the runner to run command from now on, restarting its
+// process. It never blocks: a command the runner hasn't taken yet is
+// replaced.
+func (r *taskRunner) setCommand(command string) {
+	select {
+	case <-r.commands:
+	default:
+	}
+	r.commands <- command
+}
+
+// run starts the task's process and keeps it running until ctx is done.
+func (r *taskRunner) run(ctx context.Context) {
+	name, sink, opts := r.task.name, r.sink, r.opts
+
+	// One Manager runs the command for the whole session; running is
+	// whether it has a live run we started.
+	var procOpts []process.Option
+	if r.stdin != nil {
+		procOpts = append(procOpts, process.WithStdin(r.stdin))
+	}
+	proc := newManager(r.task.command, opts, procOpts...)
+	running := false
+
+	// exited receives each run that ended on its own, after its output.
+	// Runs we stopped ourselves are never reported.
+	exited := make(chan process.Exit)
+	go streamOutput(ctx, sink, name, proc, exited)
+
+	// Build state for tasks with a build command: the old process keeps
+	// running while building is true, and is only replaced once the build
+	// arrives on built with a zero exit code.
+	var build *process.Manager
+	building := false
+	built := make(chan process.Exit)
+	if r.task.build != "" {
+		build = newManager(r.task.build, opts)
+		go streamOutput(ctx, sink, name, build, built)
+	}
+
+	// Debounce state: debounced fires once changes have settled
+	var (
+		debounceTimer *time.Timer
+		debounced     <-chan time.Time
+	)
+
+	// Crash recovery state for --restart-on-exit
+	var (
+		startedAt    time.Time        // When the current run was started
+		crashes      int              // Consecutive crashes since the last stable run
+		backoff      = minBackoff     // Delay before the next crash restart
+		restartTimer <-chan time.Time // Fires when a crash restart is due; nil if none
+	)
+
+	// started is whether the process has run before, which makes the next
+	// start a restart with hooks around it
+	started := false
+
+	// reloaded is whether the current run has been sent the --signal, in
+	// which case it is restarted straight away if it then exits
+	reloaded := false
+
+	// why is the reason for the next start, e.g. "./a.js changed", and
+	// changed the files behind it, gathered until changes settle; both
+	// are empty for the first
+	why, changed := "", []string(nil)
+
+	// Health check state: checked receives the outcome of the check that
+	// stopCheck cancels
+	checked := make(chan healthResult)
+	stopCheck := context.CancelFunc(func() {})
+	defer func() { stopCheck() }()
+
+	// Usage sampling: stopStats ends the poller of the current run
+	stopStats := context.CancelFunc(func() {})
+	defer func() { stopStats() }()
+
+	// pollStats samples the memory and CPU use of a new run until it ends
+	pollStats := func() {
+		stopStats()
+		if !running {
+			return
+		}
+		var statsCtx context.Context
+		statsCtx, stopStats = context.WithCancel(ctx)
+		poller := metrics.NewPoller(proc.Pid(), metrics.DefaultInterval)
+		go poller.Run(statsCtx, func(stats metrics.Stats) {
+			sink.Stats(name, stats)
+		})
+	}
+
+	// ready reports a new run as running, and runs the after-start hook
+	// now that the process can take requests
+	ready := func() {
+		sink.Status(name, "Running")
+		if opts.afterStart != "" {
+			runHook(ctx, sink, name, "after-start", opts.afterStart, opts)
+		}
+	}
+
+	// awaitReady reports a new run as running once it is ready, and keeps
+	// the proxy holding requests until then. Without a check, that is
+	// straight away.
+	awaitReady := func() {
+		stopCheck()
+		if !running || r.waitFor == nil {
+			r.backend.set(true)
+			if running {
+				ready()
+			}
+			return
+		}
+		var checkCtx context.Context
+		checkCtx, stopCheck = context.WithCancel(ctx)
+		run := proc.Runs()
+		check := func() error {
+			return healthcheck.WaitFor(checkCtx, r.waitFor, healthInterval, opts.waitTimeout)
+		}
+		if r.waitPort != 0 {
+			sink.Status(name, fmt.Sprintf("Waiting for port %d...", r.waitPort))
+			check = func() error {
+				return healthcheck.WaitForPort(checkCtx, r.waitPort, healthInterval, opts.waitTimeout)
+			}
+		} else {
+			sink.Status(name, fmt.Sprintf("Starting (waiting for %s)…", healthcheck.Describe(r.waitFor)))
+		}
+		go func() {
+			err := check()
 			select {
-			case <-ctx.Done():
-				// Shutdown requested, stop streaming
+			case checked <- healthResult{run: run, err: err}:
+			case <-checkCtx.Done():
+			}
+		}()
+	}
+
+	// launch starts the process, then the post-restart hook if it replaced
+	// an earlier run. With --signal, a running process is sent the signal
+	// to reload instead, and only restarted if that fails.
+	launch := func() {
+		restart := started
+		if opts.reloadSignal != 0 && running {
+			err := proc.Signal(opts.reloadSignal)
+			if err == nil {
+				reloaded = true
+				sink.Status(name, fmt.Sprintf("Reloaded (sent %s)", opts.signalName))
+				if opts.postRestart != "" {
+					runHook(ctx, sink, name, "post-restart", opts.postRestart, opts)
+				}
 				return
+			}
+			logging.Printf("Failed to send %s, restarting instead: %v", opts.signalName, err)
+		}
+		r.backend.set(false)
+		running = startProcess(sink, r.task, proc, why, changed)
+		startedAt, reloaded = time.Now(), false
+		pollStats()
+		awaitReady()
+		if running {
+			started = true
+			if restart && opts.postRestart != "" {
+				runHook(ctx, sink, name, "post-restart", opts.postRestart, opts)
+			}
+		}
+	}
 
-			case line, ok := <-proc.Output():
-				if !ok {
-					// Process exited, output channel closed
-					program.Send(ui.StatusUpdateMsg{Status: "Process exited"})
+	// begin starts the process, or the build that has to succeed first.
+	// A restart runs the pre-restart hook before anything else, and if the
+	// hook fails, goes no further.
+	begin := func() {
+		// A reloaded process carries on, output and all
+		if opts.reloadSignal == 0 || !running {
+			sink.ClearLogs(name)
+		}
+		if started && opts.preRestart != "" {
+			if err := runHook(ctx, sink, name, "pre-restart", opts.preRestart, opts); err != nil {
+				if ctx.Err() != nil {
 					return
 				}
-				program.Send(ui.ProcessOutputLineMsg{Line: line.Text})
+				status := "Restart aborted: " + err.Error()
+				if running {
+					status += ", previous run still running"
+				}
+				sink.Status(name, status)
+				return
 			}
 		}
+		if build != nil {
+			building = startBuild(sink, r.task, build)
+			return
+		}
+		launch()
+	}
+
+	// Ensure we always clean up the process on exit
+	defer func() {
+		if building {
+			r.stop.stop(build, opts.killTimeout)
+		}
+		if running {
+			sink.Status(name, "Stopping...")
+			r.stop.stop(proc, opts.killTimeout)
+		}
 	}()
 
+	// Start the initial process
+	sink.Status(name, "Starting process...")
+	begin()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case req := <-r.restarts:
+			// A manual restart also cancels any pending crash restart and
+			// resets the backoff.
+			crashes, backoff, restartTimer = 0, minBackoff, nil
+			if debounced == nil {
+				changed = nil
+			}
+			changed = addPaths(changed, req.files...)
+			why = req.reason
+			if len(req.files) > 0 {
+				why = changedReason(changed)
+			}
+
+			// A build in progress is already out of date
+			if building {
+				build.StopGraceful(opts.killTimeout)
+				building = false
+			}
+
+			if build != nil {
+				// Keep the current process until the new build succeeds
+				sink.Status(name, fmt.Sprintf("Rebuilding (%s)...", why))
+			} else if opts.reloadSignal != 0 && running {
+				// The process stays up and is signalled once changes settle
+				sink.Status(name, fmt.Sprintf("Reloading (%s)...", why))
+			} else {
+				sink.Status(name, fmt.Sprintf("Restarting (%s)...", why))
+
+				// Stop the current process if running. With a pre-restart
+				// hook it keeps running until the hook has finished.
+				if running && opts.preRestart == "" {
+					r.backend.set(false)
+					stopStats()
+					proc.StopGraceful(opts.killTimeout)
+					running = false
+				}
+			}
+
+			// A zero debounce restarts immediately
+			if opts.debounce == 0 {
+				begin()
+				continue
+			}
+
+			// Debounce: wait until changes have settled for a full window.
+			// Each new event pushes the restart back, so a batch of file
+			// operations (git checkout, tsc -b) causes a single restart.
+			if debounceTimer == nil {
+				debounceTimer = time.NewTimer(opts.debounce)
+			} else {
+				debounceTimer.Reset(opts.debounce)
+			}
+			debounced = debounceTimer.C
+
+		case <-debounced:
+			debounced = nil
+			begin()
+
+		case command := <-r.commands:
+			proc.SetCommand(command, directArgs(command))
+			r.trigger(restartRequest{reason: "command changed in " + filepath.Base(opts.configPath)})
+
+		case ex := <-built:
+			if !building || ex.Run != build.Runs() {
+				// Left over from a build that has since been replaced
+				continue
+			}
+			building = false
+
+			if ex.Code != 0 {
+				if running {
+					sink.Status(name, fmt.Sprintf("Build failed (exit %d), previous build still running", ex.Code))
+				} else {
+					sink.Status(name, fmt.Sprintf("Build failed (exit %d)", ex.Code))
+				}
+				continue
+			}
+
+			// Swap in the new build. Its output follows the build's.
+			launch()
+
+		case ex := <-exited:
+			if !running || ex.Run != proc.Runs() {
+				// Left over from a run that has since been replaced
+				continue
+			}
+			running = false
+			stopCheck()
+			stopStats()
+			sink.Exited(name, ex, reloaded || opts.restartOnExit)
+
+			// A process that didn't survive its reload signal gets the
+			// restart the signal stood in for
+			if reloaded {
+				why, changed = "exited after "+opts.signalName, nil
+				sink.Status(name, fmt.Sprintf("Restarting (%s)...", why))
+				launch()
+				continue
+			}
+
+			if !opts.restartOnExit {
+				// Nothing is coming back, so stop holding requests
+				r.backend.set(true)
+				continue
+			}
+			// Hold proxied requests until the crash restart
+			r.backend.set(false)
+
+			// A run that stayed up long enough counts as healthy, so the
+			// next crash starts the backoff from scratch.
+			if time.Since(startedAt) >= stableUptime {
+				crashes, backoff = 0, minBackoff
+			}
+			crashes++
+			delay := backoff
+			backoff = min(backoff*2, maxBackoff)
+
+			sink.Status(name, fmt.Sprintf("Crashed (%d in a row), restarting in %s…", crashes, delay))
+			restartTimer = time.After(delay)
+			// The reason leaves out how long the run lasted
+			status := ui.ExitStatus(process.Exit{Code: ex.Code, Signal: ex.Signal})
+			why, changed = strings.ToLower(status[:1])+status[1:], nil
+
+		case <-restartTimer:
+			// The last build is still good, so only the process restarts
+			restartTimer = nil
+			sink.ClearLogs(name)
+			running = startProcess(sink, r.task, proc, why, changed)
+			startedAt, reloaded = time.Now(), false
+			pollStats()
+			awaitReady()
+
+		case res := <-checked:
+			if !running || res.run != proc.Runs() {
+				// Left over from a run that has since been replaced
+				continue
+			}
+			r.backend.set(true)
+			if errors.Is(res.err, healthcheck.ErrTimeout) {
+				sink.Status(name, "Error: health check timeout")
+			} else if res.err == nil {
+				ready()
+			}
+		}
+	}
+}
+
+// targetPort returns the port the proxy target is served on, filling in
+// the scheme's default.
+func targetPort(target string) (int, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return 0, fmt.Errorf("invalid proxy target %q: %w", target, err)
+	}
+	switch {
+	case u.Port() != "":
+		return strconv.Atoi(u.Port())
+	case u.Scheme == "https":
+		return 443, nil
+	default:
+		return 80, nil
+	}
+}
+
+// startProxy starts the dev proxy on opts.proxyHost and opts.proxyPort,
+// forwarding to opts.proxyTarget, or the target of the longest of
+// opts.proxyRoutes that matches, and streaming request logs to the UI. The
+// server shuts down when the context is cancelled. It returns the proxy's
+// handler and, when capturing bodies, the store of requests that can be
+// replayed.
+func startProxy(ctx context.Context, sink outputSink, opts options) (*proxy.ProxyHandler, *proxy.ReplayStore, error) {
+	var replays *proxy.ReplayStore
+	proxyOpts := []proxy.Option{proxy.WithHoldTimeout(opts.holdTimeout)}
+	if opts.liveReload {
+		proxyOpts = append(proxyOpts, proxy.WithLiveReload())
+	}
+	if opts.captureBodies {
+		replays = proxy.NewReplayStore()
+		proxyOpts = append(proxyOpts, proxy.WithCapture(opts.captureLimit, replays))
+	}
+
+	logChan := make(chan proxy.RequestLog, 100)
+	routes := append([]proxy.RouteRule{{Prefix: "/", Target: opts.proxyTarget}}, opts.proxyRoutes...)
+	handler, err := proxy.NewMultiProxy(routes, logChan, proxyOpts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid proxy target: %w", err)
+	}
+
+	// Bind synchronously so a busy port is reported as a startup error
+	addr := net.JoinHostPort(opts.proxyHost, strconv.Itoa(opts.proxyPort))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to start proxy on %s: %w", addr, err)
+	}
+
+	server := &http.Server{Handler: handler}
+	if opts.rateLimit > 0 {
+		server.Handler = proxy.RateLimitMiddleware(opts.rateLimit, opts.rateBurst)(handler)
+	}
+	if server.TLSConfig, err = proxyTLSConfig(sink, opts); err != nil {
+		listener.Close()
+		return nil, nil, err
+	}
+
+	go func() {
+		var err error
+		if server.TLSConfig != nil {
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			err = server.Serve(listener)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Printf("Proxy server error: %v", err)
+		}
+	}()
+
+	// Shut the server down with the rest of the controller
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	// Forward request logs to the UI
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case reqLog := <-logChan:
+				sink.RequestLog(reqLog)
+			}
+		}
+	}()
+
+	return handler, replays, nil
+}
+
+// proxyURL returns the address clients reach the dev proxy on, e.g.
+// "http://localhost:4000".
+func proxyURL(opts options) string {
+	scheme := "http"
+	if opts.tlsAuto || opts.tlsCert != "" {
+		scheme = "https"
+	}
+	host := opts.proxyHost
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(opts.proxyPort))
+}
+
+// writeHAR writes the requests recorder has seen to path for --har-output.
+func writeHAR(recorder *har.Recorder, path string) {
+	if err := recorder.WriteFile(path); err != nil {
+		logging.Printf("Failed to write HAR file: %v", err)
+		return
+	}
+	logging.Printf("Wrote %d requests to %s", recorder.Len(), path)
+}
+
+// proxyTLSConfig loads the certificate the proxy serves HTTPS with, from
+// --tls-cert and --tls-key or generated for --tls-auto. It returns nil when
+// the proxy serves plain HTTP.
+func proxyTLSConfig(sink outputSink, opts options) (*tls.Config, error) {
+	certFile, keyFile := opts.tlsCert, opts.tlsKey
+	if opts.tlsAuto {
+		dir, err := proxy.DevCertDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find a certificate directory: %w", err)
+		}
+		if certFile, keyFile, err = proxy.DevCert(dir); err != nil {
+			return nil, fmt.Errorf("failed to create a development certificate: %w", err)
+		}
+		sink.ProxyNotice(fmt.Sprintf("Serving HTTPS with a self-signed certificate. To stop browser warnings, trust %s in your system or browser certificate store.", certFile))
+	}
+	if certFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+// runHook runs a hook, such as the pre-restart one, and waits for it to
+// finish, showing its output as hook lines. A hook still running after
+// opts.hookTimeout, or when ctx is done, is stopped. It returns why the
+// hook failed, which is also shown, or nil if it exited with code 0.
+func runHook(ctx context.Context, sink outputSink, name, kind, command string, opts options) error {
+	fail := func(err error) error {
+		sink.HookLine(name, err.Error())
+		return err
+	}
+
+	hook := newManager(command, opts)
+	if err := hook.Start(); err != nil {
+		return fail(fmt.Errorf("%s hook failed to start: %v", kind, err))
+	}
+	defer hook.Stop()
+
+	timeout := time.NewTimer(opts.hookTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case line := <-hook.Output():
+			sink.HookLine(name, line.Text)
+
+		case ex := <-hook.Exits():
+			for len(hook.Output()) > 0 {
+				sink.HookLine(name, (<-hook.Output()).Text)
+			}
+			if ex.Code != 0 {
+				return fail(fmt.Errorf("%s hook failed (exit %d)", kind, ex.Code))
+			}
+			return nil
+
+		case <-timeout.C:
+			return fail(fmt.Errorf("%s hook timed out after %s", kind, opts.hookTimeout))
+		}
+	}
+}
+
+// startProcess starts a new run of the task's command on proc, stopping
+// any run still going, for the given reason ("" for the first run) and
+// changed files. It reports whether the command started; the caller reports
+// it as running once it is ready.
+func startProcess(sink outputSink, t task, proc *process.Manager, reason string, changed []string) bool {
+	proc.SetRunEnv(runEnv(proc.Runs(), changed))
+	if err := proc.Restart(); err != nil {
+		logging.Printf("Failed to start process: %v", err)
+		sink.Status(t.name, "Error: failed to start")
+		sink.Line(t.name, process.Line{Text: fmt.Sprintf("Error: %v", err), Source: process.Stderr})
+		return false
+	}
+
+	startedAt := proc.StartedAt()
+	if startedAt.IsZero() {
+		// The run is already over
+		startedAt = time.Now()
+	}
+	sink.Started(t.name, startedAt, proc.Pid(), reason)
+	return true
+}
+
+// runEnv returns the variables that describe a run to the command: how
+// many restarts came before it, the files whose changes started it, if
+// any, and an ID of its own.
+func runEnv(restarts int, changed []string) map[string]string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	first := ""
+	if len(changed) > 0 {
+		first = changed[0]
+	}
+	return map[string]string{
+		"REFLEX_RESTART_COUNT": strconv.Itoa(restarts),
+		"REFLEX_CHANGED_FILE":  first,
+		"REFLEX_CHANGED_FILES": strings.Join(changed, "\n"),
+		"REFLEX_RUN_ID":        hex.EncodeToString(id),
+	}
+}
+
+// startBuild starts a new run of the task's build command on build. It
+// reports whether the build started.
+func startBuild(sink outputSink, t task, build *process.Manager) bool {
+	if err := build.Restart(); err != nil {
+		logging.Printf("Failed to start build: %v", err)
+		sink.Status(t.name, "Build failed: could not start")
+		sink.Line(t.name, process.Line{Text: fmt.Sprintf("Error: %v", err), Source: process.Stderr})
+		return false
+	}
+
+	sink.Status(t.name, "Building...")
+	return true
+}
+
+// newManager creates a process manager for command with the environment,
+// as the .env file has it at each start, working directory and terminal
+// settings from opts, and any extra options. Commands that need no shell
+// are run directly.
+func newManager(command string, opts options, extra ...process.Option) *process.Manager {
+	procOpts := append([]process.Option{process.WithEnvFunc(func() map[string]string {
+		return opts.envFile.env(opts.env)
+	})}, extra...)
+	if opts.pty {
+		procOpts = append(procOpts, process.WithPTY())
+	}
+	if opts.stopSignal != 0 {
+		procOpts = append(procOpts, process.WithStopSignal(opts.stopSignal))
+	}
+	var proc *process.Manager
+	if args := directArgs(command); args != nil {
+		proc = process.NewManagerArgs(args, opts.killTimeout, procOpts...)
+	} else {
+		proc = process.NewManager(command, opts.killTimeout, procOpts...)
+	}
+	proc.WorkingDir = opts.workingDir
 	return proc
 }
+
+// streamOutput forwards proc's output to the sink across all of its runs,
+// and passes each Exit on to exits once the run's last lines have been
+// forwarded. It returns when the context is cancelled.
+func streamOutput(ctx context.Context, sink outputSink, name string, proc *process.Manager, exits chan<- process.Exit) {
+	output := proc.Output()
+	for {
+		select {
+		case <-ctx.Done():
+			// Shutdown requested, stop streaming
+			return
+
+		case line := <-output:
+			sink.Line(name, line)
+
+		case ex := <-proc.Exits():
+			// The run's output is all buffered by now; forward it first
+		drain:
+			for {
+				select {
+				case line := <-output:
+					sink.Line(name, line)
+				default:
+					break drain
+				}
+			}
+			// Let the controller decide what the exit means
+			select {
+			case exits <- ex:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
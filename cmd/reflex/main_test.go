@@ -0,0 +1,49 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/Codimow/Reflex/internal/watcher"
+)
+
+func TestKeepOps(t *testing.T) {
+	events := []watcher.Event{
+		{Path: "a.go", Op: watcher.Create},
+		{Path: "b.go", Op: watcher.Write},
+		{Path: "c.go", Op: watcher.Remove},
+		{Path: "d.go", Op: watcher.Rename},
+	}
+	tests := []struct {
+		ops  watcher.Op
+		want []string
+	}{
+		{watcher.AllOps, []string{"a.go", "b.go", "c.go", "d.go"}},
+		{watcher.Write, []string{"b.go"}},
+		{watcher.Remove | watcher.Rename, []string{"c.go", "d.go"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, ev := range keepOps(events, tt.ops) {
+			got = append(got, ev.Path)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("keepOps with %b kept %q, want %q", tt.ops, got, tt.want)
+		}
+	}
+}
+
+func TestEnvPrecedence(t *testing.T) {
+	t.Setenv("FROM_OS", "os")
+	f := &envFile{vars: map[string]string{
+		"FROM_OS":   "file",
+		"FROM_FLAG": "file",
+		"FROM_FILE": "file",
+	}}
+	got := f.env(map[string]string{"FROM_OS": "flag", "FROM_FLAG": "flag"})
+	want := map[string]string{"FROM_FLAG": "flag", "FROM_FILE": "file"}
+	if !maps.Equal(got, want) {
+		t.Errorf("env() = %v, want %v", got, want)
+	}
+}
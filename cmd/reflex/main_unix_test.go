@@ -0,0 +1,81 @@
+//go:build !windows
+
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Codimow/Reflex/internal/process"
+)
+
+// runEnvOutput starts a run of proc as a restart for changed and returns its
+// output once it exits.
+func runEnvOutput(t *testing.T, proc *process.Manager, changed []string) string {
+	t.Helper()
+	sink := &plainSink{w: io.Discard, errW: io.Discard}
+	if !startProcess(sink, task{command: "env"}, proc, "", changed) {
+		t.Fatal("env didn't start")
+	}
+	var lines []string
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line := <-proc.Output():
+			lines = append(lines, line.Text)
+		case <-proc.Exits():
+			for len(proc.Output()) > 0 {
+				lines = append(lines, (<-proc.Output()).Text)
+			}
+			return strings.Join(lines, "\n") + "\n"
+		case <-timeout:
+			t.Fatal("env didn't exit")
+		}
+	}
+}
+
+// envValue returns the value of the variable name in the output of env,
+// up to the end of its line.
+func envValue(output, name string) string {
+	for line := range strings.SplitSeq(output, "\n") {
+		if value, ok := strings.CutPrefix(line, name+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+func TestRunEnv(t *testing.T) {
+	proc := process.NewManagerArgs([]string{"env"}, time.Second)
+
+	first := runEnvOutput(t, proc, nil)
+	if got := envValue(first, "REFLEX_RESTART_COUNT"); got != "0" {
+		t.Errorf("first run: REFLEX_RESTART_COUNT = %q, want 0", got)
+	}
+	for _, name := range []string{"REFLEX_CHANGED_FILE", "REFLEX_CHANGED_FILES"} {
+		if !strings.Contains("\n"+first, "\n"+name+"=\n") {
+			t.Errorf("first run: %s isn't set and empty", name)
+		}
+	}
+	firstID := envValue(first, "REFLEX_RUN_ID")
+	if len(firstID) != 16 || strings.Trim(firstID, "0123456789abcdef") != "" {
+		t.Errorf("first run: REFLEX_RUN_ID = %q, want 16 hex digits", firstID)
+	}
+
+	second := runEnvOutput(t, proc, []string{"a.go", "pkg/b.go"})
+	if got := envValue(second, "REFLEX_RESTART_COUNT"); got != "1" {
+		t.Errorf("second run: REFLEX_RESTART_COUNT = %q, want 1", got)
+	}
+	if got := envValue(second, "REFLEX_CHANGED_FILE"); got != "a.go" {
+		t.Errorf("second run: REFLEX_CHANGED_FILE = %q, want a.go", got)
+	}
+	// One file per line, so the second is a line of its own
+	if !strings.Contains("\n"+second, "\nREFLEX_CHANGED_FILES=a.go\npkg/b.go\n") {
+		t.Errorf("second run: REFLEX_CHANGED_FILES isn't the files one per line in:\n%s", second)
+	}
+	if id := envValue(second, "REFLEX_RUN_ID"); id == firstID || len(id) != 16 {
+		t.Errorf("second run: REFLEX_RUN_ID = %q, want a new ID after %q", id, firstID)
+	}
+}
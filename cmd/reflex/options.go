@@ -0,0 +1,1146 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Codimow/Reflex/internal/api"
+	"github.com/Codimow/Reflex/internal/config"
+	"github.com/Codimow/Reflex/internal/healthcheck"
+	"github.com/Codimow/Reflex/internal/logfile"
+	"github.com/Codimow/Reflex/internal/process"
+	"github.com/Codimow/Reflex/internal/proxy"
+	"github.com/Codimow/Reflex/internal/ui"
+	"github.com/Codimow/Reflex/internal/watcher"
+	"github.com/mattn/go-isatty"
+)
+
+// Default file extensions to watch.
+// These cover common web development file types.
+// Note: .json is intentionally excluded because build tools (Next.js, npm, etc.)
+// frequently modify package.json, lock files, and other JSON configs, causing
+// unwanted restarts.
+var defaultExtensions = []string{
+	".js", ".ts", ".jsx", ".tsx",
+	".css", ".scss", ".sass",
+	".mdx", ".md",
+	".html", ".vue", ".svelte",
+}
+
+// defaultDebounce is the delay between detecting a file change and restarting
+// the process. This prevents rapid restarts when multiple files change at once
+// (e.g., during a git checkout or editor save-all).
+const defaultDebounce = 250 * time.Millisecond
+
+// defaultHookTimeout is how long a pre- or post-restart hook may run.
+const defaultHookTimeout = 30 * time.Second
+
+// defaultWaitTimeout is how long a started process may take to become
+// ready before the start counts as failed.
+const defaultWaitTimeout = 30 * time.Second
+
+// maxDebounce bounds --debounce; anything longer is almost certainly a typo.
+const maxDebounce = 60 * time.Second
+
+// task is one command managed by the controller.
+type task struct {
+	name     string   // Label shown in the UI; empty for a single unnamed command
+	command  string   // Shell command to run and restart
+	build    string   // Shell command that must succeed before each (re)start; "" for none
+	patterns []string // Extensions and globs that restart this task
+	serves   bool     // Serves the proxy target, so its restarts hold requests and --wait-for applies to it
+}
+
+// options holds the settings resolved from the config file and command line.
+type options struct {
+	tasks    []task        // Commands to run side by side
+	patterns []string      // Extensions and globs the watcher reports
+	excludes []string      // Regular expressions for paths to skip
+	roots    []string      // Directories to watch recursively
+	debounce time.Duration // Delay before restarting after a change
+
+	ops watcher.Op // Kinds of change that trigger a restart
+
+	configPath string // Config file the commands came from, reloaded when it changes; "" if none
+
+	maxRestartsPerMinute int // Rate of restarts beyond which they pause for stormPause; 0 never pauses
+
+	pollInterval time.Duration // Scan for changes this often instead of using file system events; 0 doesn't poll
+
+	killTimeout time.Duration // Grace period between SIGTERM and SIGKILL
+
+	preRestart  string        // Shell command run before each restart
+	postRestart string        // Shell command run after each restart
+	hookTimeout time.Duration // How long a hook may run before it is stopped
+
+	afterStart string // Shell command run each time the command is up
+
+	waitFor     *url.URL      // Has to be ready before a started process counts as running; nil for none
+	waitTimeout time.Duration // How long to wait for waitFor after each start
+
+	proxyHost   string // Interface the dev proxy listens on; "" means all
+	proxyPort   int    // Port the dev proxy listens on; 0 disables the proxy
+	proxyTarget string // URL the dev proxy forwards requests to
+
+	proxyRoutes []proxy.RouteRule // Path prefixes the dev proxy forwards elsewhere than proxyTarget
+
+	holdTimeout time.Duration // How long the proxy holds requests while the process restarts
+	liveReload  bool          // Reload pages served through the proxy after each restart
+
+	rateLimit float64 // Requests a second the proxy takes from each client IP; 0 for no limit
+	rateBurst int     // Requests a client may make at once under rateLimit
+
+	captureBodies bool // Keep proxied request and response bodies for replay
+	captureLimit  int  // Body bytes to keep per request and response
+
+	harOutput string // Write proxied requests to this HAR file on shutdown; "" disables
+
+	tlsCert string // Certificate file for serving the proxy over HTTPS
+	tlsKey  string // Private key file for tlsCert
+	tlsAuto bool   // Serve the proxy over HTTPS with a generated certificate
+
+	apiPort int // Port the control API listens on; 0 disables the API
+
+	tui         bool // Use the interactive TUI rather than plain output
+	once        bool // Run the command once without watching, then exit with its code
+	listWatched bool // Print what would be watched and exit, without running anything
+	json        bool // Stream JSON lines rather than plain output; implies no TUI
+	maxLogLines int  // Lines of output each TUI pane keeps; negative keeps every line
+	pty         bool // Run the command on a pseudo-terminal so it keeps its colors
+	color       bool // Show colors; off with --no-color or NO_COLOR
+
+	timestamps ui.Timestamps // Prefix output lines with their time; the TUI starts with it
+
+	interactive bool // Pass keys typed into the UI, or Reflex's stdin, to the command
+	quiet       bool // Leave out process output but the stderr of crashed runs
+
+	restartOnExit bool // Restart the process with backoff when it exits on its own
+	gitignore     bool // Skip files and directories listed in .gitignore
+	contentCheck  bool // Ignore writes that leave a file's content unchanged
+
+	followSymlinks bool // Watch the directories and files symlinks point at
+
+	diff bool // Show how text files changed in the UI and JSON events
+
+	reloadSignal syscall.Signal // Sent to reload the running process instead of restarting it; 0 restarts
+	signalName   string         // Name of reloadSignal, e.g. "SIGHUP"
+
+	stopSignal syscall.Signal // First signal of a graceful stop; 0 means SIGTERM
+
+	env        map[string]string // Extra environment variables for the command
+	workingDir string            // Directory the command runs in
+
+	envFile *envFile // .env file with more variables for the command, under env
+
+	logFile    string // Also append process output to this file; "" disables
+	logMaxSize int64  // Size in bytes at which the log file is rotated
+	logKeep    int    // Rotated log files to keep
+
+	debugLog string // Write Reflex's own log messages to this file instead; "" doesn't
+}
+
+// usage is printed when the command line can't be parsed.
+const usage = `usage: reflex [flags] <command>
+       reflex [flags] --build <command> --run <command>
+       reflex [flags] -t name=<command> [-t name=<command> ...]
+       reflex init
+
+Flags:
+  -t name=<command>  Run a named task; repeat to run several side by side
+  --build <command>  Build before each start; restart only if it succeeds
+  --run <command>    The command to run, as an alternative to the argument
+  --pre-restart <command>
+                     Run before each restart, while the old process is still up;
+                     if it fails, skip the restart (alias --before-restart)
+  --post-restart <command>
+                     Run after each restart, once the new process has started
+  --after-start <command>
+                     Run each time the command starts, once it is ready
+  --hook-timeout <d> Stop a hook that runs longer than this (default 30s)
+  --wait-for <url>   Wait for tcp://host:port or an http(s) URL answering 2xx
+                     after each start before showing the command as running
+  --wait-timeout <d> Give up waiting for --wait-for after this long (default 30s)
+  --serve <task>     With several tasks, the one serving the proxy target: its
+                     restarts hold proxied requests and --wait-for applies to it
+  --watch <dir>      Watch this directory instead of the current one (repeatable)
+  --poll[=<d>]       Scan for changes every d (default 500ms) instead of relying on
+                     file system events, e.g. on Docker volumes or NFS
+  --ext <list>       Comma-separated file extensions to watch (repeatable)
+  --pattern <list>   Comma-separated globs to watch, "!" to exclude (repeatable)
+  --ignore <list>    Comma-separated names, paths or globs to ignore (repeatable)
+  --on <list>        Comma-separated kinds of change that trigger a restart:
+                     create, write, remove, rename (default: all of them)
+  --exclude <regex>  Skip paths matching this regular expression (repeatable)
+  --kill-timeout <d> Time to wait after SIGTERM before SIGKILL (default 5s)
+  --stop-signal <name>
+                     Stop the command with this signal instead of SIGTERM:
+                     TERM, INT, QUIT, KILL, HUP, USR1 or USR2
+  --debounce <d>     Delay before restarting after a change, 0 to disable (default 250ms)
+  --max-restarts-per-minute <n>
+                     Pause restarts for 30s when changes restart the command faster
+                     than this, in bursts of 5; 0 never pauses (default 30)
+  --proxy <addr>     Run a dev proxy on this address, e.g. :4000 (requires --target)
+  --target <url>     URL the dev proxy forwards to, e.g. http://localhost:3000
+  --proxy-port <n>   Run a dev proxy on this port, as an alternative to --proxy
+  --proxy-target <u> Alias for --target
+  --route <prefix>=<url>
+                     Forward paths starting with prefix to url rather than --target,
+                     e.g. /api/=http://localhost:8080 (repeatable)
+  --hold-timeout <d> Hold proxied requests this long while restarting (default 15s)
+  --rate-limit <n>   Answer a client IP with 429 beyond n proxied requests a second
+  --rate-burst <n>   Requests a client may make at once under --rate-limit
+                     (default: the rate, rounded up)
+  --live-reload      Reload pages in the browser after each restart (requires --proxy)
+  --capture-bodies   Keep proxied request/response bodies so requests can be replayed
+  --capture-size <n> Kilobytes of each body to keep (default 64)
+  --har-output <path>
+                     Write proxied requests, bodies and headers included, to this
+                     HAR file on exit (implies --capture-bodies)
+  --tls-cert <file>  Serve the dev proxy over HTTPS with this certificate
+  --tls-key <file>   Private key for --tls-cert
+  --tls-auto         Serve the dev proxy over HTTPS with a generated localhost certificate
+  --api              Serve the control API on 127.0.0.1:7878
+  --api-port <n>     Serve the control API on this port (implies --api)
+  --tui, --no-tui    Force the interactive UI on or off (default: on for terminals)
+  --once             Run the command once without watching and exit with its exit code
+  --list-watched     Print the directories that would be watched, with the number
+                     of matching files in each, and exit; no command is needed
+  --json             Write newline-delimited JSON events to stdout instead of the UI
+  --quiet            Show only the status, and stderr when the command crashes
+  --max-log-lines <n>
+                     Lines of output the interactive UI keeps per pane; 0 keeps
+                     every line (default 10000, alias --tail)
+  --no-pty           Run the command on pipes rather than a pseudo-terminal
+  --interactive      Type into the command: the UI passes keys on to it until
+                     ctrl+], and without the UI Reflex's stdin goes to it
+  --no-color         Strip colors from the output (also set by NO_COLOR)
+  --timestamps[=relative]
+                     Prefix output lines with the time they were written, or with
+                     the time since the command started (press t in the UI)
+  --restart-on-exit  Restart the command with backoff when it exits or crashes
+  --signal <name>    Send HUP, USR1 or USR2 to reload the command instead of
+                     restarting it (alias --reload-signal)
+  --no-gitignore     Don't skip files and directories listed in .gitignore
+  --no-content-check Restart on every write, even one that leaves a file unchanged
+  --follow-symlinks  Watch linked directories, e.g. packages added with npm link
+  --diff             Show a diff of each changed text file under the UI header
+                     (press d to fold it away) and in --json events
+  --env KEY=VALUE    Set an environment variable for the command (repeatable)
+  --env-file <path>  Read variables for the command from this file, restarting
+                     it when the file changes (default: .env if present)
+  --working-dir <d>  Run the command in this directory (alias --cwd)
+  --dir <d>          Run the command in this directory and watch it (unless --watch)
+  --log-file <path>  Also append process output to this file, or with "-" write
+                     it to stdout with timestamps instead of plain output
+  --log-max-size <n> Rotate the log file at this many megabytes (default 10,
+                     alias --log-file-max-size)
+  --log-keep <n>     Rotated log files to keep (default 2)
+  --debug-log <path> Write Reflex's own messages to this file rather than
+                     stderr or the interactive UI
+
+Settings can also be declared in reflex.yaml, .reflex.yaml, reflex.toml or
+.reflexrc, found in the current directory or a parent up to the repository
+root; flags take precedence over the file. "reflex init" writes a commented
+reflex.toml to get started.
+
+Example:
+  reflex "npm run dev"
+  reflex --ext .go,.mod "go run ."
+  reflex --pattern "Makefile,!**/*.test.ts" "make dev"`
+
+// listFlag is a flag.Value that accepts comma-separated values and may be
+// repeated, accumulating every value it sees.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// repeatedFlag is a flag.Value that may be repeated, collecting each value
+// verbatim (unlike listFlag, commas are not separators).
+type repeatedFlag []string
+
+func (r *repeatedFlag) String() string {
+	return strings.Join(*r, " ")
+}
+
+func (r *repeatedFlag) Set(value string) error {
+	*r = append(*r, value)
+	return nil
+}
+
+// optionalFlag is a flag.Value for flags such as --poll that take an
+// optional value: "--poll" alone polls at the default rate, "--poll=1s"
+// sets it. Like a boolean flag, its value has to follow an "=". The value
+// is checked after parsing, so a bad one isn't reported as a bad boolean.
+type optionalFlag struct {
+	set   bool
+	value string // "true" when given without a value
+}
+
+func (f *optionalFlag) String() string {
+	return f.value
+}
+
+func (f *optionalFlag) Set(value string) error {
+	f.set, f.value = true, value
+	return nil
+}
+
+// IsBoolFlag lets the flag be given without a value.
+func (f *optionalFlag) IsBoolFlag() bool {
+	return true
+}
+
+// off reports whether the flag wasn't given, or was given as =false.
+func (f *optionalFlag) off() bool {
+	return !f.set || f.value == "false"
+}
+
+// pollInterval returns how often --poll asks to poll, or 0 if it wasn't
+// given.
+func pollInterval(poll optionalFlag) (time.Duration, error) {
+	switch {
+	case poll.off():
+		return 0, nil
+	case poll.value == "true":
+		return watcher.DefaultPollInterval, nil
+	}
+	d, err := time.ParseDuration(poll.value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("--poll must be a positive duration such as 500ms, got %q", poll.value)
+	}
+	return d, nil
+}
+
+// timestampMode returns how --timestamps asks for lines to be prefixed:
+// wall-clock time when given alone or as =wall, or the time since the
+// process started as =relative.
+func timestampMode(timestamps optionalFlag) (ui.Timestamps, error) {
+	switch {
+	case timestamps.off():
+		return ui.TimestampsOff, nil
+	case timestamps.value == "true" || timestamps.value == "wall":
+		return ui.TimestampsWall, nil
+	case timestamps.value == "relative":
+		return ui.TimestampsRelative, nil
+	}
+	return ui.TimestampsOff, fmt.Errorf("--timestamps must be wall or relative, got %q", timestamps.value)
+}
+
+// parseArgs resolves options from the project config file, command line
+// flags, and built-in defaults, in increasing order of precedence:
+// defaults < config file < flags.
+func parseArgs() (options, error) {
+	fs := flag.NewFlagSet("reflex", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var exts, globs, ignores listFlag
+	fs.Var(&exts, "ext", "comma-separated file extensions to watch")
+	fs.Var(&globs, "pattern", "comma-separated glob patterns to watch")
+	fs.Var(&ignores, "ignore", "comma-separated names, paths or globs to ignore")
+	var on listFlag
+	fs.Var(&on, "on", "comma-separated kinds of change that trigger a restart")
+	var envs, excludes, routes, taskFlags, watchRoots repeatedFlag
+	fs.Var(&watchRoots, "watch", "directory to watch (repeatable)")
+	var poll, timestamps optionalFlag
+	fs.Var(&poll, "poll", "scan for changes on a timer, optionally =interval")
+	fs.Var(&timestamps, "timestamps", "prefix output lines with their time, optionally =relative")
+	fs.Var(&taskFlags, "t", "name=command task to run")
+	fs.Var(&taskFlags, "task", "alias for -t")
+	build := fs.String("build", "", "command that must succeed before each restart")
+	runCommand := fs.String("run", "", "command to run")
+	preRestart := fs.String("pre-restart", "", "command to run before each restart")
+	fs.StringVar(preRestart, "before-restart", "", "alias for --pre-restart")
+	postRestart := fs.String("post-restart", "", "command to run after each restart")
+	afterStart := fs.String("after-start", "", "command to run each time the command is ready")
+	hookTimeout := fs.Duration("hook-timeout", defaultHookTimeout, "time a hook may run before it is stopped")
+	serve := fs.String("serve", "", "task that serves the proxy target, with several tasks")
+	waitFor := fs.String("wait-for", "", "tcp:// or http(s):// URL that has to be ready after each start")
+	waitTimeout := fs.Duration("wait-timeout", defaultWaitTimeout, "time to wait for --wait-for after each start")
+	fs.Var(&excludes, "exclude", "regular expression for paths to skip")
+	fs.Var(&envs, "env", "KEY=VALUE environment variable for the command")
+	envFilePath := fs.String("env-file", "", "dotenv file with variables for the command")
+	var workingDir string
+	fs.StringVar(&workingDir, "working-dir", "", "directory the command runs in")
+	fs.StringVar(&workingDir, "cwd", "", "alias for --working-dir")
+	dir := fs.String("dir", "", "directory the command runs in and that is watched")
+	killTimeout := fs.Duration("kill-timeout", process.DefaultKillTimeout, "time to wait after SIGTERM before SIGKILL")
+	debounce := fs.Duration("debounce", defaultDebounce, "delay before restarting after a change")
+	maxRestarts := fs.Int("max-restarts-per-minute", defaultMaxRestartsPerMinute, "pause restarts when changes cause more than this")
+	proxyPort := fs.Int("proxy-port", 0, "port the dev proxy listens on")
+	proxyTarget := fs.String("proxy-target", "", "URL the dev proxy forwards to")
+	fs.StringVar(proxyTarget, "target", "", "alias for --proxy-target")
+	fs.Var(&routes, "route", "prefix=URL the dev proxy forwards paths with that prefix to")
+	proxyAddr := fs.String("proxy", "", "address the dev proxy listens on, e.g. :4000")
+	holdTimeout := fs.Duration("hold-timeout", proxy.DefaultHoldTimeout, "time the proxy holds requests while restarting")
+	rateLimit := fs.Float64("rate-limit", 0, "proxied requests a second allowed from each client IP")
+	rateBurst := fs.Int("rate-burst", 0, "requests a client may make at once under --rate-limit")
+	liveReload := fs.Bool("live-reload", false, "reload pages in the browser after each restart")
+	captureBodies := fs.Bool("capture-bodies", false, "keep proxied bodies for replay")
+	captureLimit := fs.Int("capture-size", proxy.DefaultCaptureLimit>>10, "kilobytes of each body to keep")
+	harOutput := fs.String("har-output", "", "write proxied requests to this HAR file on exit")
+	tlsCert := fs.String("tls-cert", "", "certificate file for serving the proxy over HTTPS")
+	tlsKey := fs.String("tls-key", "", "private key file for --tls-cert")
+	tlsAuto := fs.Bool("tls-auto", false, "serve the proxy over HTTPS with a generated certificate")
+	enableAPI := fs.Bool("api", false, "serve the control API")
+	apiPort := fs.Int("api-port", api.DefaultPort, "port the control API listens on")
+	forceTUI := fs.Bool("tui", false, "always use the interactive UI")
+	noTUI := fs.Bool("no-tui", false, "never use the interactive UI")
+	once := fs.Bool("once", false, "run the command once and exit with its exit code")
+	listWatched := fs.Bool("list-watched", false, "print what would be watched and exit")
+	jsonOutput := fs.Bool("json", false, "write newline-delimited JSON events to stdout")
+	quiet := fs.Bool("quiet", false, "show only the status, and stderr of crashed runs")
+	maxLogLines := fs.Int("max-log-lines", ui.DefaultMaxLogLines, "lines of output the interactive UI keeps per pane")
+	fs.IntVar(maxLogLines, "tail", ui.DefaultMaxLogLines, "alias for --max-log-lines")
+	noPTY := fs.Bool("no-pty", false, "run the command on pipes rather than a pseudo-terminal")
+	interactive := fs.Bool("interactive", false, "pass keys or stdin on to the command")
+	noColor := fs.Bool("no-color", false, "strip colors from the output")
+	restartOnExit := fs.Bool("restart-on-exit", false, "restart the command when it exits")
+	reloadSignal := fs.String("signal", "", "signal that reloads the command instead of restarting it")
+	fs.StringVar(reloadSignal, "reload-signal", "", "alias for --signal")
+	stopSignal := fs.String("stop-signal", "", "signal that asks the command to stop, before SIGKILL")
+	noGitignore := fs.Bool("no-gitignore", false, "don't skip paths listed in .gitignore")
+	noContentCheck := fs.Bool("no-content-check", false, "restart on writes that leave a file unchanged")
+	followSymlinks := fs.Bool("follow-symlinks", false, "watch the directories symlinks point at")
+	diff := fs.Bool("diff", false, "show how changed text files changed")
+	logFile := fs.String("log-file", "", "also append process output to this file")
+	logMaxSize := fs.Int("log-max-size", logfile.DefaultMaxSize>>20, "rotate the log file at this many megabytes")
+	fs.IntVar(logMaxSize, "log-file-max-size", logfile.DefaultMaxSize>>20, "alias for --log-max-size")
+	logKeep := fs.Int("log-keep", logfile.DefaultKeep, "rotated log files to keep")
+	debugLog := fs.String("debug-log", "", "write Reflex's own messages to this file")
+
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return options{}, errors.New(usage)
+		}
+		return options{}, fmt.Errorf("%v\n\n%s", err, usage)
+	}
+
+	// A missing config file is fine; a malformed one is not
+	configPath, err := config.Locate(".")
+	if err != nil {
+		return options{}, err
+	}
+	// Paths in the config file are relative to it, and its directory is
+	// the default watch root and working directory
+	cfg, configDir := &config.Config{}, "."
+	if configPath != "" {
+		if cfg, err = config.Load(configPath); err != nil {
+			return options{}, err
+		}
+		configDir = config.BaseDir(configPath)
+		cfg.ResolvePaths(configDir)
+	}
+
+	opts := options{
+		roots:       []string{configDir},
+		debounce:    defaultDebounce,
+		killTimeout: process.DefaultKillTimeout,
+		proxyPort:   cfg.ProxyPort,
+		proxyTarget: cfg.ProxyTarget,
+		tui:         isatty.IsTerminal(os.Stdout.Fd()),
+		pty:         isatty.IsTerminal(os.Stdout.Fd()) && !*noPTY,
+		color:       !*noColor && os.Getenv("NO_COLOR") == "",
+
+		restartOnExit: cfg.RestartOnExit,
+		gitignore:     !*noGitignore,
+		contentCheck:  !*noContentCheck,
+
+		followSymlinks: *followSymlinks,
+
+		diff: *diff,
+
+		maxRestartsPerMinute: defaultMaxRestartsPerMinute,
+	}
+
+	extensions := defaultExtensions
+	if len(cfg.Extensions) > 0 {
+		extensions = normalizeExtensions(cfg.Extensions)
+	}
+	if len(exts) > 0 {
+		extensions = normalizeExtensions(exts)
+	}
+
+	opts.ops = watcher.AllOps
+	if len(on) > 0 || len(cfg.On) > 0 {
+		names := []string(on)
+		if len(names) == 0 {
+			names = cfg.On
+		}
+		opts.ops = 0
+		for _, name := range names {
+			op, err := watcher.ParseOp(strings.ToLower(strings.TrimSpace(name)))
+			if err != nil {
+				return options{}, err
+			}
+			opts.ops |= op
+		}
+	}
+
+	// Copy so appending globs never aliases defaultExtensions
+	patterns := append([]string{}, extensions...)
+	patterns = append(patterns, globs...)
+	var ignorePatterns []string
+	for _, ignore := range append(cfg.Ignore, ignores...) {
+		ignorePatterns = append(ignorePatterns, ignorePattern(ignore))
+	}
+
+	args := fs.Args()
+	if *runCommand != "" {
+		if len(args) > 0 {
+			return options{}, errors.New("give either a command or --run, not both")
+		}
+		args = []string{*runCommand}
+	}
+
+	tasks, err := resolveTasks(cfg, args, taskFlags)
+	if errors.Is(err, errNoCommand) && *listWatched {
+		// Only the patterns matter; they come from the flags and config
+		tasks, err = []task{{}}, nil
+	}
+	if err != nil {
+		return options{}, err
+	}
+	for i := range tasks {
+		// A task that only excludes narrows the global patterns
+		if !hasInclude(tasks[i].patterns) {
+			tasks[i].patterns = append(append([]string{}, patterns...), tasks[i].patterns...)
+		}
+		tasks[i].patterns = append(append([]string{}, tasks[i].patterns...), ignorePatterns...)
+	}
+	if *build != "" {
+		if len(tasks) > 1 {
+			return options{}, errors.New("--build needs a single command; set build per task in the config file")
+		}
+		tasks[0].build = *build
+	}
+	opts.tasks = tasks
+	opts.patterns = watchPatterns(tasks)
+	if len(args) == 0 && len(taskFlags) == 0 {
+		opts.configPath = configPath
+	}
+	opts.excludes = append(append([]string{}, cfg.Exclude...), excludes...)
+
+	if len(cfg.Watch) > 0 {
+		opts.roots = cfg.Watch
+	}
+	if cfg.Debounce != nil {
+		opts.debounce = time.Duration(*cfg.Debounce)
+	}
+	if isFlagSet(fs, "debounce") {
+		opts.debounce = *debounce
+	}
+	if opts.debounce < 0 || opts.debounce > maxDebounce {
+		return options{}, fmt.Errorf("debounce must be between 0 and %v, got %v", maxDebounce, opts.debounce)
+	}
+
+	if cfg.MaxRestartsPerMinute != nil {
+		opts.maxRestartsPerMinute = *cfg.MaxRestartsPerMinute
+	}
+	if isFlagSet(fs, "max-restarts-per-minute") {
+		opts.maxRestartsPerMinute = *maxRestarts
+	}
+	if opts.maxRestartsPerMinute < 0 {
+		return options{}, fmt.Errorf("max restarts per minute can't be negative, got %d", opts.maxRestartsPerMinute)
+	}
+
+	if cfg.KillTimeout != nil {
+		opts.killTimeout = time.Duration(*cfg.KillTimeout)
+	}
+	if isFlagSet(fs, "kill-timeout") {
+		opts.killTimeout = *killTimeout
+	}
+	if opts.killTimeout <= 0 {
+		return options{}, fmt.Errorf("kill timeout must be positive, got %v", opts.killTimeout)
+	}
+
+	if isFlagSet(fs, "proxy") && isFlagSet(fs, "proxy-port") {
+		return options{}, errors.New("give either --proxy or --proxy-port, not both")
+	}
+	if isFlagSet(fs, "proxy") {
+		if opts.proxyHost, opts.proxyPort, err = parseProxyAddr(*proxyAddr); err != nil {
+			return options{}, err
+		}
+	}
+	if isFlagSet(fs, "proxy-port") {
+		opts.proxyPort = *proxyPort
+	}
+	if isFlagSet(fs, "proxy-target") || isFlagSet(fs, "target") {
+		opts.proxyTarget = *proxyTarget
+	}
+	if (opts.proxyPort != 0) != (opts.proxyTarget != "") {
+		return options{}, errors.New("the proxy address (--proxy) and target (--target) must be set together")
+	}
+	if opts.proxyPort < 0 || opts.proxyPort > 65535 {
+		return options{}, fmt.Errorf("proxy port must be between 1 and 65535, got %d", opts.proxyPort)
+	}
+	if len(routes) > 0 && opts.proxyPort == 0 {
+		return options{}, errors.New("--route needs the dev proxy (--proxy and --target)")
+	}
+	for _, r := range routes {
+		prefix, target, ok := strings.Cut(r, "=")
+		if !ok || !strings.HasPrefix(prefix, "/") || target == "" {
+			return options{}, fmt.Errorf("--route must be /prefix=URL, got %q", r)
+		}
+		if prefix == "/" {
+			return options{}, errors.New("--route can't take over /; give that target with --target")
+		}
+		opts.proxyRoutes = append(opts.proxyRoutes, proxy.RouteRule{Prefix: prefix, Target: target})
+	}
+	if *holdTimeout <= 0 {
+		return options{}, fmt.Errorf("--hold-timeout must be positive, got %v", *holdTimeout)
+	}
+	opts.holdTimeout = *holdTimeout
+	if *rateLimit < 0 || *rateBurst < 0 {
+		return options{}, errors.New("--rate-limit and --rate-burst can't be negative")
+	}
+	if (*rateLimit > 0 || isFlagSet(fs, "rate-burst")) && opts.proxyPort == 0 {
+		return options{}, errors.New("--rate-limit needs the dev proxy (--proxy and --target)")
+	}
+	if isFlagSet(fs, "rate-burst") && *rateLimit == 0 {
+		return options{}, errors.New("--rate-burst needs --rate-limit")
+	}
+	opts.rateLimit, opts.rateBurst = *rateLimit, *rateBurst
+	if opts.rateBurst == 0 {
+		opts.rateBurst = int(math.Ceil(opts.rateLimit))
+	}
+	if *liveReload && opts.proxyPort == 0 {
+		return options{}, errors.New("--live-reload needs the dev proxy (--proxy and --target)")
+	}
+	opts.liveReload = *liveReload
+	if *captureBodies && opts.proxyPort == 0 {
+		return options{}, errors.New("--capture-bodies needs the dev proxy (--proxy and --target)")
+	}
+	if *captureLimit <= 0 {
+		return options{}, fmt.Errorf("--capture-size must be positive, got %d", *captureLimit)
+	}
+	if *harOutput != "" && opts.proxyPort == 0 {
+		return options{}, errors.New("--har-output needs the dev proxy (--proxy and --target)")
+	}
+	// A HAR file without bodies and headers is of little use
+	opts.captureBodies = *captureBodies || *harOutput != ""
+	opts.captureLimit = *captureLimit << 10
+	opts.harOutput = *harOutput
+
+	if (*tlsCert != "") != (*tlsKey != "") {
+		return options{}, errors.New("--tls-cert and --tls-key must be set together")
+	}
+	if *tlsAuto && *tlsCert != "" {
+		return options{}, errors.New("give either --tls-auto or --tls-cert and --tls-key, not both")
+	}
+	if (*tlsAuto || *tlsCert != "") && opts.proxyPort == 0 {
+		return options{}, errors.New("TLS needs the dev proxy (--proxy and --target)")
+	}
+	opts.tlsCert, opts.tlsKey, opts.tlsAuto = *tlsCert, *tlsKey, *tlsAuto
+
+	if isFlagSet(fs, "restart-on-exit") {
+		opts.restartOnExit = *restartOnExit
+	}
+
+	if *reloadSignal != "" {
+		if opts.reloadSignal, err = parseSignal(*reloadSignal); err != nil {
+			return options{}, err
+		}
+		opts.signalName = "SIG" + strings.TrimPrefix(strings.ToUpper(*reloadSignal), "SIG")
+	}
+	if *stopSignal != "" {
+		if opts.stopSignal, err = parseStopSignal(*stopSignal); err != nil {
+			return options{}, err
+		}
+	}
+
+	// Config file variables first, then --env overrides
+	env := make(map[string]string, len(cfg.Env)+len(envs))
+	for k, v := range cfg.Env {
+		env[k] = v
+	}
+	for _, kv := range envs {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return options{}, fmt.Errorf("--env must be KEY=VALUE, got %q", kv)
+		}
+		env[k] = v
+	}
+	opts.env = expandEnv(env)
+
+	opts.workingDir = cfg.WorkingDir
+	if opts.workingDir == "" && configDir != "." {
+		opts.workingDir = configDir
+	}
+	if isFlagSet(fs, "working-dir") || isFlagSet(fs, "cwd") {
+		opts.workingDir = workingDir
+	}
+	// --dir is --working-dir that also moves the default watch root, so
+	// relative ignores and .gitignore files resolve against it too
+	if *dir != "" {
+		if isFlagSet(fs, "working-dir") || isFlagSet(fs, "cwd") {
+			return options{}, errors.New("give either --dir or --working-dir, not both")
+		}
+		opts.workingDir = *dir
+		if len(cfg.Watch) == 0 {
+			opts.roots = []string{*dir}
+		}
+	}
+	if len(watchRoots) > 0 {
+		opts.roots = watchRoots
+	}
+	if opts.pollInterval, err = pollInterval(poll); err != nil {
+		return options{}, err
+	}
+	if opts.timestamps, err = timestampMode(timestamps); err != nil {
+		return options{}, err
+	}
+	if opts.workingDir != "" {
+		if info, err := os.Stat(opts.workingDir); err != nil || !info.IsDir() {
+			return options{}, fmt.Errorf("working directory %q does not exist", opts.workingDir)
+		}
+	}
+
+	// A .env file that was asked for has to exist; the default one may
+	// turn up later
+	envPath, required := cfg.EnvFile, cfg.EnvFile != ""
+	if *envFilePath != "" {
+		envPath, required = *envFilePath, true
+	}
+	if envPath == "" {
+		envPath = filepath.Join(opts.workingDir, ".env")
+	}
+	if opts.envFile, err = loadEnvFile(envPath, required); err != nil {
+		return options{}, err
+	}
+
+	opts.apiPort = cfg.APIPort
+	if *enableAPI || isFlagSet(fs, "api-port") {
+		opts.apiPort = *apiPort
+	}
+	if opts.apiPort < 0 || opts.apiPort > 65535 {
+		return options{}, fmt.Errorf("invalid API port %d", opts.apiPort)
+	}
+
+	if *hookTimeout <= 0 {
+		return options{}, fmt.Errorf("--hook-timeout must be positive, got %v", *hookTimeout)
+	}
+	opts.preRestart, opts.postRestart, opts.hookTimeout = *preRestart, *postRestart, *hookTimeout
+	opts.afterStart = *afterStart
+
+	// The task behind the proxy target; a single one always is
+	serveTask := cfg.Serve
+	if isFlagSet(fs, "serve") {
+		serveTask = *serve
+	}
+	serving := false
+	for i := range opts.tasks {
+		if len(opts.tasks) == 1 || (serveTask != "" && opts.tasks[i].name == serveTask) {
+			opts.tasks[i].serves, serving = true, true
+		}
+	}
+	if serveTask != "" && !serving {
+		return options{}, fmt.Errorf("--serve: no task named %q", serveTask)
+	}
+
+	if *waitFor != "" {
+		if !serving {
+			return options{}, errors.New("--wait-for with several tasks needs --serve to say which one it waits for")
+		}
+		if opts.waitFor, err = healthcheck.ParseTarget(*waitFor); err != nil {
+			return options{}, fmt.Errorf("invalid --wait-for: %w", err)
+		}
+	}
+	if *waitTimeout <= 0 {
+		return options{}, fmt.Errorf("--wait-timeout must be positive, got %v", *waitTimeout)
+	}
+	opts.waitTimeout = *waitTimeout
+
+	// The UI keeps every line for a negative limit, zero being its default
+	switch {
+	case *maxLogLines < 0:
+		return options{}, fmt.Errorf("--max-log-lines must not be negative, got %d", *maxLogLines)
+	case *maxLogLines == 0:
+		opts.maxLogLines = -1
+	default:
+		opts.maxLogLines = *maxLogLines
+	}
+
+	if *logMaxSize <= 0 {
+		return options{}, fmt.Errorf("--log-max-size must be positive, got %d", *logMaxSize)
+	}
+	if *logKeep < 0 {
+		return options{}, fmt.Errorf("--log-keep can't be negative, got %d", *logKeep)
+	}
+	opts.logFile = *logFile
+	opts.logMaxSize = int64(*logMaxSize) << 20
+	opts.logKeep = *logKeep
+	opts.debugLog = *debugLog
+
+	// Without a terminal the TUI only produces escape-sequence garbage
+	if *forceTUI && *noTUI {
+		return options{}, errors.New("--tui and --no-tui are mutually exclusive")
+	}
+	if *forceTUI {
+		opts.tui = true
+	}
+	if *noTUI {
+		opts.tui = false
+	}
+
+	// --once streams plain output and exits with the command
+	if *once && *forceTUI {
+		return options{}, errors.New("--once runs without the interactive UI; drop --tui")
+	}
+	if *once {
+		opts.once, opts.tui = true, false
+	}
+	opts.listWatched = *listWatched
+
+	// --json streams its events in place of the UI
+	if *jsonOutput && *forceTUI {
+		return options{}, errors.New("--json writes to stdout in place of the interactive UI; drop --tui")
+	}
+	if *jsonOutput {
+		opts.json, opts.tui = true, false
+	}
+	if *quiet && opts.json {
+		return options{}, errors.New("--json events carry every line; drop --quiet")
+	}
+	opts.quiet = *quiet
+
+	// "--log-file -" takes the place of plain output too
+	if opts.logFile == logfile.Stdout {
+		if *forceTUI || opts.json {
+			return options{}, errors.New("--log-file - writes to stdout in place of plain output; drop --tui and --json")
+		}
+		opts.tui = false
+	}
+
+	// Without the UI's focus there's no telling which task input is for
+	opts.interactive = *interactive
+	if opts.interactive && !opts.tui && len(opts.tasks) > 1 {
+		return options{}, errors.New("--interactive without the interactive UI needs a single task")
+	}
+
+	return opts, nil
+}
+
+// resolveTasks determines the commands to run. A positional command or -t
+// flags on the command line replace whatever the config file declares.
+// Tasks from -t pick up their patterns from a config task of the same name;
+// a nil patterns field means the task uses the global patterns.
+func resolveTasks(cfg *config.Config, args []string, taskFlags []string) ([]task, error) {
+	if cfg.Command != "" && len(cfg.Tasks) > 0 {
+		return nil, errors.New("config file sets both command and tasks; use one or the other")
+	}
+	if len(cfg.Rules) > 0 && (cfg.Command != "" || len(cfg.Tasks) > 0) {
+		return nil, errors.New("config file sets rules along with command or tasks; use one of them")
+	}
+
+	switch {
+	case len(taskFlags) > 0 && len(args) > 0:
+		return nil, errors.New("give either a command or -t tasks, not both")
+
+	case len(taskFlags) > 0:
+		var tasks []task
+		seen := make(map[string]bool)
+		for _, tf := range taskFlags {
+			name, command, ok := strings.Cut(tf, "=")
+			if !ok || name == "" || command == "" {
+				return nil, fmt.Errorf("-t must be name=command, got %q", tf)
+			}
+			if seen[name] {
+				return nil, fmt.Errorf("task %q given more than once", name)
+			}
+			seen[name] = true
+			ct := cfg.Tasks[name]
+			tasks = append(tasks, task{name: name, command: command, build: ct.Build, patterns: taskPatterns(ct)})
+		}
+		return tasks, nil
+
+	case len(args) > 0:
+		return []task{{command: args[0], build: cfg.Build}}, nil
+
+	case len(cfg.Tasks) > 0:
+		names := make([]string, 0, len(cfg.Tasks))
+		for name := range cfg.Tasks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		tasks := make([]task, 0, len(names))
+		for _, name := range names {
+			ct := cfg.Tasks[name]
+			if ct.Command == "" {
+				return nil, fmt.Errorf("task %q has no command", name)
+			}
+			tasks = append(tasks, task{name: name, command: ct.Command, build: ct.Build, patterns: taskPatterns(ct)})
+		}
+		return tasks, nil
+
+	case len(cfg.Rules) > 0:
+		tasks := make([]task, 0, len(cfg.Rules))
+		seen := make(map[string]bool)
+		for i, rule := range cfg.Rules {
+			name := rule.Name
+			if name == "" {
+				name = fmt.Sprintf("rule %d", i+1)
+			}
+			if seen[name] {
+				return nil, fmt.Errorf("rule %q given more than once", name)
+			}
+			seen[name] = true
+			if rule.Command == "" {
+				return nil, fmt.Errorf("%s has no command", name)
+			}
+			patterns, err := rulePatterns(rule)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			tasks = append(tasks, task{name: name, command: rule.Command, patterns: patterns})
+		}
+		return tasks, nil
+
+	case cfg.Command != "":
+		return []task{{command: cfg.Command, build: cfg.Build}}, nil
+	}
+
+	return nil, errNoCommand
+}
+
+// errNoCommand is returned by resolveTasks when neither the command line
+// nor the config file gives a command to run. It reads as the usage text.
+var errNoCommand = errors.New(usage)
+
+// taskPatterns returns the patterns a config task narrows itself to, or
+// nil if it doesn't set any.
+func taskPatterns(ct config.Task) []string {
+	if len(ct.Extensions) == 0 && len(ct.Patterns) == 0 {
+		return nil
+	}
+	return append(normalizeExtensions(ct.Extensions), ct.Patterns...)
+}
+
+// rulePatterns returns the patterns for a config rule: its extensions,
+// limited to files under its watch_dirs if it has any, then its include
+// globs and its exclude globs negated. It returns nil if the rule sets none
+// of them.
+func rulePatterns(rule config.Rule) ([]string, error) {
+	patterns, err := ruleIncludes(rule)
+	if err != nil {
+		return nil, err
+	}
+	patterns = append(patterns, rule.Include...)
+	for _, p := range rule.Exclude {
+		patterns = append(patterns, "!"+strings.TrimPrefix(p, "!"))
+	}
+	return patterns, nil
+}
+
+// ruleIncludes returns the patterns for a rule's extensions and watch_dirs.
+func ruleIncludes(rule config.Rule) ([]string, error) {
+	extensions := normalizeExtensions(rule.Extensions)
+	if len(rule.WatchDirs) == 0 {
+		if len(extensions) == 0 {
+			return nil, nil
+		}
+		return extensions, nil
+	}
+
+	var patterns []string
+	for _, dir := range rule.WatchDirs {
+		dir = filepath.ToSlash(filepath.Clean(dir))
+		if filepath.IsAbs(dir) || dir == ".." || strings.HasPrefix(dir, "../") {
+			return nil, fmt.Errorf("watch_dirs must be inside the watched directory, got %q", dir)
+		}
+		prefix := dir + "/**/"
+		if dir == "." {
+			prefix = "**/"
+		}
+		if len(extensions) == 0 {
+			patterns = append(patterns, prefix+"*")
+			continue
+		}
+		for _, ext := range extensions {
+			patterns = append(patterns, prefix+"*"+ext)
+		}
+	}
+	return patterns, nil
+}
+
+// hasInclude reports whether patterns has any that aren't "!" excludes.
+func hasInclude(patterns []string) bool {
+	for _, p := range patterns {
+		if !strings.HasPrefix(p, "!") {
+			return true
+		}
+	}
+	return false
+}
+
+// watchPatterns returns the patterns for the shared watcher: every include
+// pattern of any task, plus the excludes that all tasks agree on. Each
+// task still applies its own patterns to the events it receives.
+func watchPatterns(tasks []task) []string {
+	var patterns []string
+	seen := make(map[string]bool)
+	excludes := make(map[string]int)
+	for _, t := range tasks {
+		counted := make(map[string]bool)
+		for _, p := range t.patterns {
+			if strings.HasPrefix(p, "!") {
+				if !counted[p] {
+					counted[p] = true
+					excludes[p]++
+				}
+				continue
+			}
+			if !seen[p] {
+				seen[p] = true
+				patterns = append(patterns, p)
+			}
+		}
+	}
+	// Keep the order of the first task for determinism
+	for _, p := range tasks[0].patterns {
+		if excludes[p] == len(tasks) {
+			patterns = append(patterns, p)
+			excludes[p] = 0
+		}
+	}
+	return patterns
+}
+
+// isFlagSet reports whether the named flag was given on the command line,
+// so an explicit zero value can still override the config file.
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// normalizeExtensions ensures every extension starts with a dot,
+// so "go" and ".go" are treated the same.
+func normalizeExtensions(exts []string) []string {
+	normalized := make([]string, 0, len(exts))
+	for _, ext := range exts {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		normalized = append(normalized, ext)
+	}
+	return normalized
+}
+
+// ignorePattern turns an --ignore value into an exclude pattern for the
+// watcher. Plain names ("tmp") are ignored wherever they appear in the tree,
+// paths ("./generated") are anchored to the watch root, and globs
+// ("**/*.gen.ts") are used as-is. Directories matched this way are pruned
+// from the walk as well as filtered from events.
+func ignorePattern(ignore string) string {
+	if strings.ContainsAny(ignore, "*?[") {
+		return "!" + ignore
+	}
+	cleaned := strings.Trim(filepath.ToSlash(filepath.Clean(ignore)), "/")
+	anchored := strings.HasPrefix(ignore, "./") || strings.HasPrefix(ignore, "/") || strings.Contains(cleaned, "/")
+	if anchored {
+		return "!" + cleaned + "/**"
+	}
+	return "!**/" + cleaned + "/**"
+}
+
+// parseSignal looks up a --signal name, e.g. "HUP" or "SIGUSR1", in any
+// case.
+func parseSignal(name string) (syscall.Signal, error) {
+	if len(reloadSignals) == 0 {
+		return 0, errors.New("--signal isn't supported on this platform")
+	}
+	sig, ok := reloadSignals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return 0, fmt.Errorf("--signal must be HUP, USR1 or USR2, got %q", name)
+	}
+	return sig, nil
+}
+
+// parseStopSignal parses the --stop-signal value, a signal name with or
+// without the "SIG" prefix.
+func parseStopSignal(name string) (syscall.Signal, error) {
+	if len(stopSignals) == 0 {
+		return 0, errors.New("--stop-signal isn't supported on Windows, where commands are stopped with CTRL_BREAK")
+	}
+	sig, ok := stopSignals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return 0, fmt.Errorf("--stop-signal must be TERM, INT, QUIT, KILL, HUP, USR1 or USR2, got %q", name)
+	}
+	return sig, nil
+}
+
+// expandEnv resolves ${NAME} and $NAME references in env values. Names
+// defined in env take precedence over the current environment, and may
+// refer to each other; a reference cycle expands to an empty string.
+func expandEnv(env map[string]string) map[string]string {
+	expanded := make(map[string]string, len(env))
+	expanding := make(map[string]bool)
+
+	var resolve func(name string) string
+	resolve = func(name string) string {
+		if v, ok := expanded[name]; ok {
+			return v
+		}
+		raw, ok := env[name]
+		if !ok {
+			return os.Getenv(name)
+		}
+		if expanding[name] {
+			return ""
+		}
+		expanding[name] = true
+		v := os.Expand(raw, resolve)
+		expanding[name] = false
+		expanded[name] = v
+		return v
+	}
+
+	for name := range env {
+		resolve(name)
+	}
+	return expanded
+}
+
+// parseProxyAddr splits a --proxy address such as ":4000",
+// "127.0.0.1:4000" or a bare "4000" into its host and port.
+func parseProxyAddr(addr string) (host string, port int, err error) {
+	portText := addr
+	if strings.Contains(addr, ":") {
+		if host, portText, err = net.SplitHostPort(addr); err != nil {
+			return "", 0, fmt.Errorf("invalid proxy address %q: %w", addr, err)
+		}
+	}
+	port, err = strconv.Atoi(portText)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid proxy address %q: port must be between 1 and 65535", addr)
+	}
+	return host, port, nil
+}
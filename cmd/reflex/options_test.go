@@ -0,0 +1,238 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Codimow/Reflex/internal/process"
+	"github.com/Codimow/Reflex/internal/watcher"
+)
+
+// parseIn runs parseArgs with args in a new repository holding config as
+// reflex.yaml, or no config file if it is empty.
+func parseIn(t *testing.T, config string, args ...string) options {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if config != "" {
+		if err := os.WriteFile(filepath.Join(dir, "reflex.yaml"), []byte(config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return parseFrom(t, dir, args...)
+}
+
+// parseFrom runs parseArgs with args in dir.
+func parseFrom(t *testing.T, dir string, args ...string) options {
+	t.Helper()
+	opts, err := tryParseFrom(t, dir, args...)
+	if err != nil {
+		t.Fatalf("parseArgs(%q): %v", args, err)
+	}
+	return opts
+}
+
+// tryParseFrom runs parseArgs with args in dir and returns its error.
+func tryParseFrom(t *testing.T, dir string, args ...string) (options, error) {
+	t.Helper()
+	t.Chdir(dir)
+
+	oldArgs := os.Args
+	os.Args = append([]string{"reflex"}, args...)
+	t.Cleanup(func() { os.Args = oldArgs })
+
+	return parseArgs()
+}
+
+func TestOptionPrecedence(t *testing.T) {
+	const config = "command: make\ndebounce: 500ms\nkill_timeout: 2s\n"
+	tests := []struct {
+		name        string
+		config      string
+		args        []string
+		debounce    time.Duration
+		killTimeout time.Duration
+		command     string
+	}{
+		{"defaults", "", []string{"make"}, defaultDebounce, process.DefaultKillTimeout, "make"},
+		{"config over defaults", config, nil, 500 * time.Millisecond, 2 * time.Second, "make"},
+		{"flags over config", config, []string{"--debounce", "1s", "make test"}, time.Second, 2 * time.Second, "make test"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := parseIn(t, tt.config, tt.args...)
+			if opts.debounce != tt.debounce {
+				t.Errorf("debounce = %v, want %v", opts.debounce, tt.debounce)
+			}
+			if opts.killTimeout != tt.killTimeout {
+				t.Errorf("killTimeout = %v, want %v", opts.killTimeout, tt.killTimeout)
+			}
+			if len(opts.tasks) != 1 || opts.tasks[0].command != tt.command {
+				t.Errorf("tasks = %+v, want the one command %q", opts.tasks, tt.command)
+			}
+		})
+	}
+}
+
+func TestConfigFromSubdirectory(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     string
+		roots      []string
+		workingDir string
+	}{
+		{"defaults", "command: make\n", []string{".."}, ".."},
+		{"relative to the file", "command: make\nwatch: [src]\nworking_dir: web\nenv_file: .env.dev\n", []string{filepath.Join("..", "src")}, filepath.Join("..", "web")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, dir := range []string{".git", "sub", "web"} {
+				if err := os.Mkdir(filepath.Join(root, dir), 0o755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.WriteFile(filepath.Join(root, "reflex.yaml"), []byte(tt.config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(root, ".env.dev"), []byte("A=1\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			opts := parseFrom(t, filepath.Join(root, "sub"))
+			if !slices.Equal(opts.roots, tt.roots) {
+				t.Errorf("roots = %q, want %q", opts.roots, tt.roots)
+			}
+			if opts.workingDir != tt.workingDir {
+				t.Errorf("workingDir = %q, want %q", opts.workingDir, tt.workingDir)
+			}
+		})
+	}
+}
+
+func TestServeOption(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		args    []string
+		serves  []string // Names of the tasks that serve the target
+		wantErr string
+	}{
+		{"single command", "", []string{"make"}, []string{""}, ""},
+		{"several tasks", "", []string{"-t", "web=a", "-t", "test=b"}, nil, ""},
+		{"flag", "", []string{"-t", "web=a", "-t", "test=b", "--serve", "web"}, []string{"web"}, ""},
+		{"config", "serve: web\n", []string{"-t", "web=a", "-t", "test=b"}, []string{"web"}, ""},
+		{"unknown task", "", []string{"-t", "web=a", "-t", "test=b", "--serve", "api"}, nil, `no task named "api"`},
+		{"wait-for without serve", "", []string{"-t", "web=a", "-t", "test=b", "--wait-for", "tcp://localhost:3000"}, nil, "needs --serve"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.Mkdir(filepath.Join(dir, ".git"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if tt.config != "" {
+				if err := os.WriteFile(filepath.Join(dir, "reflex.yaml"), []byte(tt.config), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			opts, err := tryParseFrom(t, dir, tt.args...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseArgs() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var serves []string
+			for _, task := range opts.tasks {
+				if task.serves {
+					serves = append(serves, task.name)
+				}
+			}
+			if !slices.Equal(serves, tt.serves) {
+				t.Errorf("serving tasks = %q, want %q", serves, tt.serves)
+			}
+		})
+	}
+}
+
+func TestOnOption(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		args   []string
+		want   watcher.Op
+	}{
+		{"default", "", []string{"make"}, watcher.AllOps},
+		{"flag", "", []string{"--on", "remove, Rename", "make"}, watcher.Remove | watcher.Rename},
+		{"config", "command: make\non: [create, write]\n", nil, watcher.Create | watcher.Write},
+		{"flag over config", "command: make\non: [create]\n", []string{"--on", "remove"}, watcher.Remove},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseIn(t, tt.config, tt.args...).ops; got != tt.want {
+				t.Errorf("ops = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnorePattern(t *testing.T) {
+	tests := []struct {
+		ignore string
+		want   string
+	}{
+		{"tmp", "!**/tmp/**"},
+		{"tmp/", "!**/tmp/**"},
+		{"./generated", "!generated/**"},
+		{"/generated", "!generated/**"},
+		{"web/dist", "!web/dist/**"},
+		{"**/*.gen.ts", "!**/*.gen.ts"},
+		{"*.log", "!*.log"},
+	}
+	for _, tt := range tests {
+		if got := ignorePattern(tt.ignore); got != tt.want {
+			t.Errorf("ignorePattern(%q) = %q, want %q", tt.ignore, got, tt.want)
+		}
+	}
+}
+
+// TestPatternFlags checks how --ext, --pattern and --ignore combine into
+// the files a task restarts for.
+func TestPatternFlags(t *testing.T) {
+	opts := parseIn(t, "", "--ext", "go", "--pattern", "web/**/*.ts", "--ignore", "tmp,./gen", "--ignore", "**/*_string.go", "make")
+	filter := watcher.NewFilter(opts.tasks[0].patterns)
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"main.go", true},
+		{"internal/watcher/pattern.go", true},
+		{"README.md", false},
+		{"web/app.ts", true},
+		{"web/src/components/app.ts", true},
+		{"src/app.ts", false},
+		{"tmp/scratch.go", false},
+		{"pkg/tmp/scratch.go", false},
+		{"pkg/tmpl.go", true},
+		{"gen/api.go", false},
+		{"pkg/gen/api.go", true},
+		{"op_string.go", false},
+		{"internal/watcher/op_string.go", false},
+	}
+	for _, tt := range tests {
+		ev := watcher.Event{Root: "/repo", Path: filepath.Join("/repo", filepath.FromSlash(tt.path))}
+		if got := filter.Match(ev); got != tt.want {
+			t.Errorf("%s: match = %v, want %v with patterns %q", tt.path, got, tt.want, opts.tasks[0].patterns)
+		}
+	}
+}
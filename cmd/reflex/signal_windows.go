@@ -0,0 +1,12 @@
+//go:build windows
+
+package main
+
+import "syscall"
+
+// reloadSignals is empty: Windows programs can't be sent signals, so
+// --signal isn't available.
+var reloadSignals = map[string]syscall.Signal{}
+
+// stopSignals is empty for the same reason, so --stop-signal isn't either.
+var stopSignals = map[string]syscall.Signal{}
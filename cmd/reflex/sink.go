@@ -0,0 +1,543 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Codimow/Reflex/internal/api"
+	"github.com/Codimow/Reflex/internal/har"
+	"github.com/Codimow/Reflex/internal/logfile"
+	"github.com/Codimow/Reflex/internal/logging"
+	"github.com/Codimow/Reflex/internal/metrics"
+	"github.com/Codimow/Reflex/internal/process"
+	"github.com/Codimow/Reflex/internal/proxy"
+	"github.com/Codimow/Reflex/internal/ui"
+	"github.com/Codimow/Reflex/internal/watcher"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// outputSink is where the controller reports what is happening. The TUI and
+// the plain (non-TUI) mode each provide an implementation. task names the
+// task concerned; it is empty when a single unnamed command is running.
+type outputSink interface {
+	// Status reports a change in a task's state, e.g. "Running".
+	Status(task, status string)
+	// Line reports a single line of process output.
+	Line(task string, line process.Line)
+	// HookLine reports a line of output from a restart hook.
+	HookLine(task, text string)
+	// ClearLogs is called before a restarted process produces output.
+	ClearLogs(task string)
+	// Started reports that the task's process was (re)started at the given
+	// time with the given PID (0 if it already ended), and why: what
+	// changed, or "" for the first start.
+	Started(task string, at time.Time, pid int, reason string)
+	// Exited reports that the task's process exited on its own, and
+	// whether it is restarted straight away rather than on the next change.
+	Exited(task string, ex process.Exit, restarting bool)
+	// Stats reports a sample of the memory and CPU the task's process uses.
+	Stats(task string, stats metrics.Stats)
+	// Watching reports what the watcher found when it first walked the
+	// watch roots.
+	Watching(stats watcher.Stats)
+	// WatchLimit reports that the watcher ran out of watches, leaving
+	// some directories unwatched.
+	WatchLimit(limit watcher.WatchLimit)
+	// Changed reports a batch of file changes, before they are routed to
+	// the tasks they concern.
+	Changed(events []watcher.Event)
+	// RequestLog reports a request handled by the dev proxy.
+	RequestLog(rl proxy.RequestLog)
+	// ProxyNotice reports a message about the dev proxy itself.
+	ProxyNotice(text string)
+}
+
+// tuiSink forwards controller output to the Bubbletea program.
+type tuiSink struct {
+	program *tea.Program
+}
+
+func (s tuiSink) Status(task, status string) {
+	s.program.Send(ui.StatusUpdateMsg{Task: task, Status: status})
+}
+
+func (s tuiSink) Line(task string, line process.Line) {
+	s.program.Send(ui.ProcessOutputLineMsg{Task: task, Line: line.Text, Stderr: line.Source == process.Stderr, Time: line.Time})
+}
+
+func (s tuiSink) HookLine(task, text string) {
+	s.program.Send(ui.ProcessOutputLineMsg{Task: task, Line: text, Hook: true})
+}
+
+func (s tuiSink) ClearLogs(task string) {
+	s.program.Send(ui.ClearLogsMsg{Task: task})
+}
+
+func (s tuiSink) Started(task string, at time.Time, pid int, reason string) {
+	s.program.Send(ui.ProcessStartedMsg{Task: task, StartedAt: at})
+	if pid != 0 {
+		s.program.Send(ui.ProcessPIDMsg{Task: task, PID: pid})
+	}
+	s.program.Send(ui.LifecycleEventMsg{Task: task, Kind: ui.LifecycleStarted, At: at, Detail: reason})
+}
+
+func (s tuiSink) Exited(task string, ex process.Exit, restarting bool) {
+	s.program.Send(ui.ProcessExitedMsg{Task: task, Exit: ex, Restarting: restarting})
+	kind := ui.LifecycleExited
+	if ex.Code != 0 {
+		kind = ui.LifecycleCrashed
+	}
+	s.program.Send(ui.LifecycleEventMsg{Task: task, Kind: kind, At: time.Now(), Detail: ui.ExitStatus(ex)})
+}
+
+func (s tuiSink) Stats(task string, stats metrics.Stats) {
+	s.program.Send(ui.ProcessStatsMsg{Task: task, Stats: stats})
+}
+
+func (s tuiSink) Watching(stats watcher.Stats) {
+	s.program.Send(ui.WatchingMsg{Stats: stats})
+}
+
+func (s tuiSink) WatchLimit(limit watcher.WatchLimit) {
+	s.program.Send(ui.WatchLimitMsg{Limit: limit})
+}
+
+// Changed shows the diffs of the changed files, with --diff; the restart
+// status already says which files changed.
+func (s tuiSink) Changed(events []watcher.Event) {
+	s.program.Send(ui.ChangesMsg{Events: events})
+}
+
+func (s tuiSink) RequestLog(rl proxy.RequestLog) {
+	s.program.Send(ui.RequestLogMsg{Log: rl})
+}
+
+func (s tuiSink) ProxyNotice(text string) {
+	s.program.Send(ui.ProxyNoticeMsg{Text: text})
+}
+
+// plainSink writes process output straight to a writer, with status changes
+// on their own "[reflex]" prefixed lines. Output of named tasks is prefixed
+// with the task name. Lines the process wrote to stderr go to errW, so shell
+// redirection still separates the streams. It is used when stdout isn't a
+// terminal (CI, pipes) or when --no-tui is passed.
+type plainSink struct {
+	mu   sync.Mutex
+	w    io.Writer
+	errW io.Writer
+
+	timestamps ui.Timestamps        // Prefix for output lines, from --timestamps
+	dim        bool                 // Dim the prefix with an escape code
+	started    map[string]time.Time // When each task's process last started
+
+	omitOutput bool // Leave the command's output to "--log-file -"
+}
+
+func (s *plainSink) Status(task, status string) {
+	s.printf("[reflex] %s\n", taskStatus(task, status))
+}
+
+func (s *plainSink) Line(task string, line process.Line) {
+	if s.omitOutput {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.w
+	if line.Source == process.Stderr {
+		w = s.errW
+	}
+	fmt.Fprintf(w, "%s%s\n", s.timePrefix(task, line.Time), taskPrefix(task, line.Text))
+}
+
+func (s *plainSink) HookLine(task, text string) {
+	if s.omitOutput {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.w, "%s%s\n", s.timePrefix(task, time.Now()), taskPrefix(task, "[hook] "+text))
+}
+
+// timePrefix returns the --timestamps prefix for a line of task's output
+// written at at, or just now if at is zero. Until a start is reported, as
+// with --once, relative times count from the task's first line. s.mu must
+// be held.
+func (s *plainSink) timePrefix(task string, at time.Time) string {
+	if s.timestamps == ui.TimestampsOff {
+		return ""
+	}
+	if at.IsZero() {
+		at = time.Now()
+	}
+	if _, ok := s.started[task]; !ok {
+		s.recordStart(task, at)
+	}
+	prefix := s.timestamps.Prefix(at, s.started[task])
+	if prefix == "" || !s.dim {
+		return prefix
+	}
+	return "\x1b[2m" + prefix + "\x1b[22m"
+}
+
+// ClearLogs is a no-op: earlier output stays in the scrollback.
+func (s *plainSink) ClearLogs(task string) {}
+
+// Started only records the start for relative timestamps: the "Running"
+// status line already marks it.
+func (s *plainSink) Started(task string, at time.Time, pid int, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recordStart(task, at)
+}
+
+// recordStart sets when task's process started. s.mu must be held.
+func (s *plainSink) recordStart(task string, at time.Time) {
+	if s.started == nil {
+		s.started = make(map[string]time.Time)
+	}
+	s.started[task] = at
+}
+
+func (s *plainSink) Exited(task string, ex process.Exit, restarting bool) {
+	s.Status(task, ui.ExitStatus(ex))
+}
+
+// Stats is a no-op: a line every second would drown out the output.
+func (s *plainSink) Stats(task string, stats metrics.Stats) {}
+
+func (s *plainSink) Watching(stats watcher.Stats) {
+	s.printf("[reflex] %s\n", ui.WatchSummary(stats))
+}
+
+func (s *plainSink) WatchLimit(limit watcher.WatchLimit) {
+	s.printf("[reflex] Warning: %s\n", ui.WatchLimitWarning(limit))
+}
+
+// Changed is a no-op: the controller logs changes to stderr.
+func (s *plainSink) Changed(events []watcher.Event) {}
+
+func (s *plainSink) RequestLog(rl proxy.RequestLog) {
+	method := rl.Method
+	if rl.Protocol != "" {
+		method = strings.ToUpper(rl.Protocol)
+	}
+	s.printf("[proxy] #%s %s %s %d %s\n", rl.ID, method, rl.Path, rl.StatusCode, rl.Duration.Round(time.Millisecond))
+}
+
+func (s *plainSink) ProxyNotice(text string) {
+	s.printf("[proxy] %s\n", text)
+}
+
+func (s *plainSink) printf(format string, args ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.w, format, args...)
+}
+
+// jsonSink writes one JSON object per line for everything the controller
+// reports, for --json. Every object has an "event" naming what happened
+// and a "ts" timestamp, and "task" when a named task is concerned.
+type jsonSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newJSONSink(w io.Writer) *jsonSink {
+	return &jsonSink{enc: json.NewEncoder(w)}
+}
+
+// jsonHeader starts every object a jsonSink writes.
+type jsonHeader struct {
+	Event string    `json:"event"`
+	TS    time.Time `json:"ts"`
+	Task  string    `json:"task,omitempty"`
+}
+
+func (s *jsonSink) Status(task, status string) {
+	s.write(struct {
+		jsonHeader
+		Status string `json:"status"`
+	}{jsonHeader{"status", time.Now(), task}, status})
+}
+
+// Line stamps the line with when it was read, not when it is written out.
+func (s *jsonSink) Line(task string, line process.Line) {
+	at := line.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	s.write(struct {
+		jsonHeader
+		Stream string `json:"stream"`
+		Line   string `json:"line"`
+	}{jsonHeader{"process_output", at, task}, line.Source.String(), line.Text})
+}
+
+func (s *jsonSink) HookLine(task, text string) {
+	s.write(struct {
+		jsonHeader
+		Line string `json:"line"`
+	}{jsonHeader{"hook_output", time.Now(), task}, text})
+}
+
+// ClearLogs is a no-op: "process_started" already marks the new run.
+func (s *jsonSink) ClearLogs(task string) {}
+
+func (s *jsonSink) Started(task string, at time.Time, pid int, reason string) {
+	s.write(struct {
+		jsonHeader
+		PID    int    `json:"pid,omitempty"`
+		Reason string `json:"reason,omitempty"`
+	}{jsonHeader{"process_started", at, task}, pid, reason})
+}
+
+func (s *jsonSink) Exited(task string, ex process.Exit, restarting bool) {
+	s.write(struct {
+		jsonHeader
+		Code     int    `json:"code"`
+		Signal   string `json:"signal,omitempty"`
+		UptimeMS int64  `json:"uptime_ms"`
+	}{jsonHeader{"process_exited", time.Now(), task}, ex.Code, ex.Signal, ex.Uptime.Milliseconds()})
+}
+
+// Stats is a no-op, as for plainSink.
+func (s *jsonSink) Stats(task string, stats metrics.Stats) {}
+
+func (s *jsonSink) Watching(stats watcher.Stats) {
+	s.write(struct {
+		jsonHeader
+		Dirs        int `json:"dirs"`
+		Files       int `json:"files"`
+		IgnoredDirs int `json:"ignored_dirs"`
+	}{jsonHeader{Event: "watching", TS: time.Now()}, stats.WatchedDirs, stats.WatchedFiles, stats.IgnoredDirs})
+}
+
+func (s *jsonSink) WatchLimit(limit watcher.WatchLimit) {
+	s.write(struct {
+		jsonHeader
+		Dirs          int `json:"dirs"`
+		UnwatchedDirs int `json:"unwatched_dirs"`
+	}{jsonHeader{Event: "watch_limit", TS: time.Now()}, limit.Watched, limit.Unwatched})
+}
+
+func (s *jsonSink) Changed(events []watcher.Event) {
+	now := time.Now()
+	for _, ev := range events {
+		s.write(struct {
+			jsonHeader
+			Path string `json:"path"`
+			Op   string `json:"op"`
+			Diff string `json:"diff,omitempty"`
+		}{jsonHeader{Event: "file_change", TS: now}, ev.Path, ev.Op.String(), ev.Diff})
+	}
+}
+
+func (s *jsonSink) RequestLog(rl proxy.RequestLog) {
+	s.write(struct {
+		jsonHeader
+		proxy.RequestLog
+	}{jsonHeader{Event: "request", TS: rl.Timestamp}, rl})
+}
+
+func (s *jsonSink) ProxyNotice(text string) {
+	s.write(struct {
+		jsonHeader
+		Text string `json:"text"`
+	}{jsonHeader{Event: "proxy_notice", TS: time.Now()}, text})
+}
+
+func (s *jsonSink) write(v any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.enc.Encode(v); err != nil {
+		logging.Printf("Failed to write JSON output: %v", err)
+	}
+}
+
+// harSink passes everything through to another sink, recording proxied
+// requests for --har-output on the way.
+type harSink struct {
+	outputSink
+	recorder *har.Recorder
+}
+
+func (s harSink) RequestLog(rl proxy.RequestLog) {
+	s.outputSink.RequestLog(rl)
+	s.recorder.Add(rl)
+}
+
+// noColorSink passes everything through to another sink with the escape
+// sequences stripped from output lines, for --no-color.
+type noColorSink struct {
+	outputSink
+}
+
+func (s noColorSink) Line(task string, line process.Line) {
+	line.Text = ansi.Strip(line.Text)
+	s.outputSink.Line(task, line)
+}
+
+func (s noColorSink) HookLine(task, text string) {
+	s.outputSink.HookLine(task, ansi.Strip(text))
+}
+
+// quietKeep is how many stderr lines of a run quietSink keeps to show
+// if it crashes.
+const quietKeep = 200
+
+// quietSink drops process and hook output for --quiet in plain output,
+// except that it keeps the last quietKeep lines a run writes to stderr and
+// passes them on if the run exits with a non-zero code.
+type quietSink struct {
+	outputSink
+
+	mu     sync.Mutex
+	stderr map[string][]process.Line // The current run's stderr by task
+}
+
+func (s *quietSink) Line(task string, line process.Line) {
+	if line.Source != process.Stderr {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stderr == nil {
+		s.stderr = make(map[string][]process.Line)
+	}
+	lines := append(s.stderr[task], line)
+	if len(lines) > quietKeep {
+		lines = lines[len(lines)-quietKeep:]
+	}
+	s.stderr[task] = lines
+}
+
+func (s *quietSink) HookLine(task, text string) {}
+
+func (s *quietSink) ClearLogs(task string) {
+	s.mu.Lock()
+	delete(s.stderr, task)
+	s.mu.Unlock()
+	s.outputSink.ClearLogs(task)
+}
+
+func (s *quietSink) Exited(task string, ex process.Exit, restarting bool) {
+	s.mu.Lock()
+	lines := s.stderr[task]
+	delete(s.stderr, task)
+	s.mu.Unlock()
+	if ex.Code != 0 {
+		for _, line := range lines {
+			s.outputSink.Line(task, line)
+		}
+	}
+	s.outputSink.Exited(task, ex, restarting)
+}
+
+// logFileSink passes everything through to another sink and also records
+// process output in a log file. Unlike the UI, the file is never cleared.
+type logFileSink struct {
+	outputSink
+	file *logfile.Writer
+
+	mu     sync.Mutex
+	runs   map[string]int // Number of times each task has started
+	failed bool           // Writing has failed and was reported
+}
+
+func (s *logFileSink) Line(task string, line process.Line) {
+	s.outputSink.Line(task, line)
+	s.check(s.file.Line(taskPrefix(task, line.Text)))
+}
+
+func (s *logFileSink) HookLine(task, text string) {
+	s.outputSink.HookLine(task, text)
+	s.check(s.file.Line(taskPrefix(task, "[hook] "+text)))
+}
+
+func (s *logFileSink) Started(task string, at time.Time, pid int, reason string) {
+	s.outputSink.Started(task, at, pid, reason)
+
+	s.mu.Lock()
+	if s.runs == nil {
+		s.runs = make(map[string]int)
+	}
+	run := s.runs[task]
+	s.runs[task]++
+	s.mu.Unlock()
+
+	s.check(s.file.Session(task, run, reason, at))
+}
+
+// close writes out the rest of the log file and closes it.
+func (s *logFileSink) close() {
+	s.check(s.file.Close())
+}
+
+// check reports the first error writing the log file. The writer gives up
+// after it, and the session carries on without the file.
+func (s *logFileSink) check(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.failed {
+		s.failed = true
+		logging.Printf("Failed to write log file, no longer writing to it: %v", err)
+	}
+}
+
+// apiSink passes everything through to another sink and also records it in
+// the API server's state. With several tasks the API reports them combined.
+type apiSink struct {
+	outputSink
+	server *api.Server
+}
+
+func (s apiSink) Status(task, status string) {
+	s.outputSink.Status(task, status)
+	s.server.SetStatus(taskStatus(task, status))
+}
+
+func (s apiSink) Line(task string, line process.Line) {
+	s.outputSink.Line(task, line)
+	s.server.AddLine(taskPrefix(task, line.Text))
+}
+
+func (s apiSink) HookLine(task, text string) {
+	s.outputSink.HookLine(task, text)
+	s.server.AddLine(taskPrefix(task, "[hook] "+text))
+}
+
+func (s apiSink) Exited(task string, ex process.Exit, restarting bool) {
+	s.outputSink.Exited(task, ex, restarting)
+	s.server.SetStatus(taskStatus(task, ui.ExitStatus(ex)))
+	s.server.Exited()
+}
+
+func (s apiSink) Started(task string, at time.Time, pid int, reason string) {
+	s.outputSink.Started(task, at, pid, reason)
+	s.server.Started(task, at, pid)
+}
+
+// taskStatus prefixes status with the task name, if any.
+func taskStatus(task, status string) string {
+	if task == "" {
+		return status
+	}
+	return task + ": " + status
+}
+
+// taskPrefix prefixes line with the task name, if any.
+func taskPrefix(task, line string) string {
+	if task == "" {
+		return line
+	}
+	return "[" + task + "] " + line
+}
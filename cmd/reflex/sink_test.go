@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Codimow/Reflex/internal/process"
+)
+
+func TestJSONSinkLineTime(t *testing.T) {
+	read := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name string
+		at   time.Time
+	}{
+		{"when read", read},
+		{"unknown", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			before := time.Now()
+			newJSONSink(&buf).Line("web", process.Line{Text: "hello", Source: process.Stdout, Time: tt.at})
+
+			var got struct{ TS time.Time }
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatalf("%v in %q", err, buf.String())
+			}
+			if !tt.at.IsZero() {
+				if !got.TS.Equal(tt.at) {
+					t.Errorf("ts = %v, want the time the line was read, %v", got.TS, tt.at)
+				}
+			} else if got.TS.Before(before) {
+				t.Errorf("ts = %v for a line with no time, want the time it was written", got.TS)
+			}
+		})
+	}
+}
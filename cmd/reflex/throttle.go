@@ -0,0 +1,64 @@
+package main
+
+import "time"
+
+// Restart storms: a command that writes into a directory it watches, e.g. a
+// code generator, restarts itself forever. More than stormRestarts restarts
+// within the window set by --max-restarts-per-minute pause restarts for
+// stormPause.
+const (
+	stormRestarts               = 5
+	stormPause                  = 30 * time.Second
+	defaultMaxRestartsPerMinute = 30 // stormRestarts in 10 seconds
+)
+
+// restartThrottle counts the restarts file changes cause over a sliding
+// window to detect restart storms. A nil *restartThrottle never detects one.
+type restartThrottle struct {
+	window   time.Duration // Span that may hold at most stormRestarts restarts
+	debounce time.Duration // Changes closer together than this share a restart
+	last     time.Time     // Most recent change
+	restarts []time.Time   // Restarts within window, oldest first
+}
+
+// newRestartThrottle returns a throttle allowing perMinute restarts a
+// minute in bursts of stormRestarts, or nil if perMinute is 0.
+func newRestartThrottle(perMinute int, debounce time.Duration) *restartThrottle {
+	if perMinute == 0 {
+		return nil
+	}
+	return &restartThrottle{
+		window:   stormRestarts * time.Minute / time.Duration(perMinute),
+		debounce: debounce,
+	}
+}
+
+// storm records a change at now that restarts a task, and reports whether
+// it makes one restart too many. A change within the debounce of the one
+// before it only pushes that restart back, so it doesn't count again.
+func (t *restartThrottle) storm(now time.Time) bool {
+	if t == nil {
+		return false
+	}
+	joined := !t.last.IsZero() && now.Sub(t.last) < t.debounce
+	t.last = now
+	if joined {
+		return false
+	}
+
+	cutoff := now.Add(-t.window)
+	for len(t.restarts) > 0 && !t.restarts[0].After(cutoff) {
+		t.restarts = t.restarts[1:]
+	}
+	t.restarts = append(t.restarts, now)
+	return len(t.restarts) > stormRestarts
+}
+
+// reset forgets past restarts, once a storm pause is over.
+func (t *restartThrottle) reset() {
+	if t == nil {
+		return
+	}
+	t.last = time.Time{}
+	t.restarts = nil
+}
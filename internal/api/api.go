@@ -0,0 +1,217 @@
+// Package api serves a small JSON-over-HTTP API for querying Reflex and
+// triggering restarts from editor plugins and scripts.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Codimow/Reflex/internal/logging"
+)
+
+// DefaultPort is the port the API listens on when none is given.
+const DefaultPort = 7878
+
+// maxLogLines bounds the output kept for GET /logs.
+const maxLogLines = 1000
+
+// defaultLogLines is how many lines GET /logs returns without ?n=.
+const defaultLogLines = 100
+
+// Status is the body of GET /status.
+type Status struct {
+	Status    string    `json:"status"`
+	Restarts  int       `json:"restarts"`
+	StartedAt time.Time `json:"started_at,omitzero"`
+	Uptime    string    `json:"uptime"`
+	PID       int       `json:"pid,omitempty"`
+}
+
+// Server tracks the controller's state and serves it over HTTP. The
+// controller reports through the Set/Add methods and receives restart
+// requests from Restarts.
+type Server struct {
+	// Replay, if set before ListenAndServe, serves POST /replay/{id} by
+	// sending the captured proxy request with that ID again.
+	Replay func(id string) error
+
+	mu        sync.RWMutex
+	status    string
+	restarts  int
+	started   map[string]bool // Tasks that have started at least once
+	startedAt time.Time
+	pid       int // 0 while no process is running
+	logs      []string
+
+	restart chan struct{}
+}
+
+// NewServer creates a Server with no recorded state.
+func NewServer() *Server {
+	return &Server{
+		status:  "Initializing",
+		started: make(map[string]bool),
+		restart: make(chan struct{}, 1),
+	}
+}
+
+// SetStatus records the controller's current status.
+func (s *Server) SetStatus(status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// Started records that the process of task was (re)started at the given
+// time with the given PID. Only a task starting again counts as a restart,
+// so several tasks starting for the first time count as none.
+func (s *Server) Started(task string, at time.Time, pid int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started[task] {
+		s.restarts++
+	}
+	s.started[task] = true
+	s.startedAt = at
+	s.pid = pid
+}
+
+// Exited records that the process exited on its own.
+func (s *Server) Exited() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pid = 0
+}
+
+// AddLine records a line of process output, keeping the most recent
+// maxLogLines.
+func (s *Server) AddLine(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.logs) == maxLogLines {
+		s.logs = append(s.logs[:0], s.logs[1:]...)
+	}
+	s.logs = append(s.logs, line)
+}
+
+// Restarts delivers a value for every POST /restart. Requests made while
+// one is already pending are merged.
+func (s *Server) Restarts() <-chan struct{} {
+	return s.restart
+}
+
+// ListenAndServe binds to addr and serves the API until ctx is cancelled.
+// Binding happens before it returns so a busy port is reported as an error.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: s.Handler()}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Printf("API server error: %v", err)
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	return nil
+}
+
+// Handler returns the handler that serves the API's endpoints.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", s.handleStatus)
+	mux.HandleFunc("POST /restart", sameOrigin(s.handleRestart))
+	mux.HandleFunc("GET /logs", s.handleLogs)
+	if s.Replay != nil {
+		mux.HandleFunc("POST /replay/{id}", sameOrigin(s.handleReplay))
+	}
+	return mux
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	status := Status{
+		Status:    s.status,
+		Restarts:  s.restarts,
+		StartedAt: s.startedAt,
+		PID:       s.pid,
+	}
+	s.mu.RUnlock()
+
+	if !status.StartedAt.IsZero() {
+		status.Uptime = time.Since(status.StartedAt).Truncate(time.Second).String()
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) handleRestart(w http.ResponseWriter, r *http.Request) {
+	select {
+	case s.restart <- struct{}{}:
+	default:
+		// A restart is already pending
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "restarting"})
+}
+
+func (s *Server) handleReplay(w http.ResponseWriter, r *http.Request) {
+	if err := s.Replay(r.PathValue("id")); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "replayed"})
+}
+
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	n := defaultLogLines
+	if v := r.URL.Query().Get("n"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid n %q", v)})
+			return
+		}
+		n = parsed
+	}
+
+	s.mu.RLock()
+	n = min(n, len(s.logs))
+	lines := append([]string{}, s.logs[len(s.logs)-n:]...)
+	s.mu.RUnlock()
+
+	writeJSON(w, http.StatusOK, map[string][]string{"lines": lines})
+}
+
+// sameOrigin wraps a handler that acts on the developer's behalf so it
+// refuses requests a web page on another origin makes. Browsers send such
+// simple POSTs without a CORS preflight, so without this any open page could
+// trigger them; scripts and editor plugins send no Origin and are let through.
+func sameOrigin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" && origin != "http://"+r.Host {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": fmt.Sprintf("cross-origin request from %s", origin)})
+			return
+		}
+		h(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// do sends a request to the server's handler and returns the response.
+func do(t *testing.T, s *Server, method, target string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestStatus(t *testing.T) {
+	s := NewServer()
+	at := time.Now().Add(-time.Minute)
+
+	getStatus := func() Status {
+		t.Helper()
+		rec := do(t, s, "GET", "/status", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /status: %d", rec.Code)
+		}
+		var status Status
+		if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+
+	if got := getStatus(); got.Status != "Initializing" || got.Uptime != "" || got.PID != 0 {
+		t.Errorf("before starting: %+v", got)
+	}
+
+	// Each task starting for the first time is not a restart
+	s.Started("web", at, 10)
+	s.Started("worker", at, 11)
+	s.SetStatus("Running")
+	got := getStatus()
+	if got.Status != "Running" || got.Restarts != 0 || got.PID != 11 || !got.StartedAt.Equal(at) {
+		t.Errorf("after two tasks started: %+v", got)
+	}
+	if got.Uptime != "1m0s" {
+		t.Errorf("Uptime = %q, want 1m0s", got.Uptime)
+	}
+
+	s.Started("web", at, 12)
+	if got := getStatus(); got.Restarts != 1 || got.PID != 12 {
+		t.Errorf("after web restarted: %+v", got)
+	}
+
+	s.Exited()
+	if got := getStatus(); got.PID != 0 {
+		t.Errorf("PID after exit = %d, want 0", got.PID)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	s := NewServer()
+
+	// Requests made while one is pending are merged into it
+	for range 3 {
+		if rec := do(t, s, "POST", "/restart", nil); rec.Code != http.StatusAccepted {
+			t.Fatalf("POST /restart: %d", rec.Code)
+		}
+	}
+	select {
+	case <-s.Restarts():
+	default:
+		t.Fatal("no restart delivered")
+	}
+	select {
+	case <-s.Restarts():
+		t.Fatal("a second restart was delivered")
+	default:
+	}
+
+	if rec := do(t, s, "GET", "/restart", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /restart: %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestCrossOrigin(t *testing.T) {
+	s := NewServer()
+	replayed := 0
+	s.Replay = func(id string) error {
+		replayed++
+		return nil
+	}
+
+	tests := []struct {
+		origin string
+		want   int
+	}{
+		{"", http.StatusAccepted},
+		{"http://example.com", http.StatusAccepted}, // httptest.NewRequest's Host
+		{"http://evil.example", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			var header http.Header
+			if tt.origin != "" {
+				header = http.Header{"Origin": {tt.origin}}
+			}
+			if rec := do(t, s, "POST", "/restart", header); rec.Code != tt.want {
+				t.Errorf("POST /restart: %d, want %d", rec.Code, tt.want)
+			}
+			select {
+			case <-s.Restarts():
+				if tt.want == http.StatusForbidden {
+					t.Error("a forbidden request restarted")
+				}
+			default:
+				if tt.want != http.StatusForbidden {
+					t.Error("no restart delivered")
+				}
+			}
+
+			before := replayed
+			wantReplay := http.StatusOK
+			if tt.want == http.StatusForbidden {
+				wantReplay = http.StatusForbidden
+			}
+			if rec := do(t, s, "POST", "/replay/1", header); rec.Code != wantReplay {
+				t.Errorf("POST /replay/1: %d, want %d", rec.Code, wantReplay)
+			}
+			if ran := replayed > before; ran != (wantReplay == http.StatusOK) {
+				t.Errorf("replayed = %v", ran)
+			}
+		})
+	}
+}
+
+func TestLogs(t *testing.T) {
+	s := NewServer()
+	for i := range maxLogLines + 10 {
+		s.AddLine(fmt.Sprint(i))
+	}
+
+	tests := []struct {
+		query     string
+		wantCode  int
+		wantLines int
+		wantFirst string
+	}{
+		{"", http.StatusOK, defaultLogLines, fmt.Sprint(maxLogLines + 10 - defaultLogLines)},
+		{"?n=2", http.StatusOK, 2, fmt.Sprint(maxLogLines + 8)},
+		{"?n=0", http.StatusOK, 0, ""},
+		{"?n=5000", http.StatusOK, maxLogLines, "10"},
+		{"?n=-1", http.StatusBadRequest, 0, ""},
+		{"?n=abc", http.StatusBadRequest, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := do(t, s, "GET", "/logs"+tt.query, nil)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("GET /logs%s: %d, want %d", tt.query, rec.Code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var body struct{ Lines []string }
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if len(body.Lines) != tt.wantLines {
+				t.Fatalf("got %d lines, want %d", len(body.Lines), tt.wantLines)
+			}
+			if tt.wantLines > 0 && body.Lines[0] != tt.wantFirst {
+				t.Errorf("first line %q, want %q", body.Lines[0], tt.wantFirst)
+			}
+		})
+	}
+}
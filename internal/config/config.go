@@ -0,0 +1,233 @@
+// Package config loads Reflex settings from a project configuration file.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// FileNames lists the config file names looked up in the project root,
+// in order of preference. .reflexrc uses TOML syntax.
+var FileNames = []string{"reflex.yaml", ".reflex.yaml", "reflex.toml", ".reflexrc"}
+
+// Config holds the settings that can be declared in a config file.
+// Zero values mean "not set" so CLI flags and defaults can fill them in.
+type Config struct {
+	Command       string    `yaml:"command" toml:"command"`                 // Shell command to run and restart
+	Build         string    `yaml:"build" toml:"build"`                     // Shell command that must succeed before each restart
+	Extensions    []string  `yaml:"extensions" toml:"extensions"`           // File extensions that trigger a restart
+	Ignore        []string  `yaml:"ignore" toml:"ignore"`                   // Extra names, paths or globs to ignore
+	Exclude       []string  `yaml:"exclude" toml:"exclude"`                 // Regular expressions for paths to skip
+	On            []string  `yaml:"on" toml:"on"`                           // Kinds of change that trigger a restart, e.g. "write"
+	Debounce      *Duration `yaml:"debounce" toml:"debounce"`               // Delay before restarting, e.g. "500ms"; 0 disables
+	Watch         []string  `yaml:"watch" toml:"watch"`                     // Root directories to watch
+	KillTimeout   *Duration `yaml:"kill_timeout" toml:"kill_timeout"`       // Grace period between SIGTERM and SIGKILL
+	ProxyPort     int       `yaml:"proxy_port" toml:"proxy_port"`           // Port the dev proxy listens on
+	ProxyTarget   string    `yaml:"proxy_target" toml:"proxy_target"`       // URL the dev proxy forwards to
+	Serve         string    `yaml:"serve" toml:"serve"`                     // Task that serves ProxyTarget, with several tasks
+	RestartOnExit bool      `yaml:"restart_on_exit" toml:"restart_on_exit"` // Restart with backoff when the command exits
+	APIPort       int       `yaml:"api_port" toml:"api_port"`               // Port the control API listens on
+	WorkingDir    string    `yaml:"working_dir" toml:"working_dir"`         // Directory the command runs in
+
+	// MaxRestartsPerMinute is the rate of restarts caused by changes beyond
+	// which restarts pause for 30 seconds; 0 never pauses.
+	MaxRestartsPerMinute *int `yaml:"max_restarts_per_minute" toml:"max_restarts_per_minute"`
+
+	// EnvFile is the .env file the command's variables are read from, and
+	// restarted on changes to. It defaults to .env in WorkingDir.
+	EnvFile string `yaml:"env_file" toml:"env_file"`
+
+	// Tasks declares several named commands to run side by side, in place
+	// of Command. Each task may narrow the files that restart it.
+	Tasks map[string]Task `yaml:"tasks" toml:"tasks"`
+
+	// Rules declares commands by the files that restart them, as an
+	// alternative to Tasks. They run side by side in the order given.
+	Rules []Rule `yaml:"rule" toml:"rule"`
+
+	// Env holds extra environment variables for the command. Values may
+	// reference other variables as ${NAME}, resolved at startup.
+	Env map[string]string `yaml:"env" toml:"env"`
+}
+
+// Task is one named command in a multi-task config. Without Extensions or
+// Patterns, a task restarts on the same files as a single command would.
+type Task struct {
+	Command    string   `yaml:"command" toml:"command"`       // Shell command to run and restart
+	Build      string   `yaml:"build" toml:"build"`           // Shell command that must succeed before each restart
+	Extensions []string `yaml:"extensions" toml:"extensions"` // File extensions that restart this task
+	Patterns   []string `yaml:"patterns" toml:"patterns"`     // Globs that restart this task, "!" to exclude
+}
+
+// Rule is one [[rule]] entry: a command restarted by changes to files with
+// its extensions, optionally only within WatchDirs, or matching its Include
+// globs. Files matching an Exclude glob never restart it.
+type Rule struct {
+	Name       string   `yaml:"name" toml:"name"`             // Label shown in the UI; defaults to "rule N"
+	Extensions []string `yaml:"extensions" toml:"extensions"` // File extensions that restart this rule's command
+	Command    string   `yaml:"command" toml:"command"`       // Shell command to run and restart
+	WatchDirs  []string `yaml:"watch_dirs" toml:"watch_dirs"` // Directories, relative to the watch root, the files must be in
+	Include    []string `yaml:"include" toml:"include"`       // Globs that restart this rule's command too
+	Exclude    []string `yaml:"exclude" toml:"exclude"`       // Globs that never restart it
+}
+
+// Duration is a time.Duration written as a Go duration string ("500ms", "2s").
+// A bare 0 is accepted as well.
+type Duration time.Duration
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	v, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration %q", node.Line, node.Value)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, used for TOML.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", text)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Locate looks for a config file in dir and returns the absolute path of
+// the first one found. If dir has none, parent directories are searched up
+// to and including the repository root (the first directory containing
+// .git). Outside a repository only dir itself is searched, so a stray file
+// in a home or temporary directory doesn't configure every project below
+// it. It returns "" and no error when no config file exists.
+func Locate(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	root := repoRoot(dir)
+	if root == "" {
+		root = dir
+	}
+	for {
+		for _, name := range FileNames {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return path, nil
+		}
+
+		// Don't wander out of the repository
+		if dir == root {
+			return "", nil
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// repoRoot returns the closest directory at or above the absolute path dir
+// that contains .git, or "" if there is none.
+func repoRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// BaseDir returns the directory of the config file at path, which its
+// relative paths are resolved against. It is relative to the current
+// directory where possible, "." when the file is right there.
+func BaseDir(path string) string {
+	dir := filepath.Dir(path)
+	if cwd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(cwd, dir); err == nil {
+			return rel
+		}
+	}
+	return dir
+}
+
+// ResolvePaths makes the relative Watch, WorkingDir and EnvFile paths,
+// which are written relative to the config file, relative to the current
+// directory instead. dir is the config file's directory, from BaseDir.
+func (c *Config) ResolvePaths(dir string) {
+	resolve := func(path string) string {
+		if path == "" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+	for i, root := range c.Watch {
+		c.Watch[i] = resolve(root)
+	}
+	c.WorkingDir = resolve(c.WorkingDir)
+	c.EnvFile = resolve(c.EnvFile)
+}
+
+// Load reads and parses the config file at path. Files ending in .yaml or
+// .yml are parsed as YAML, everything else as TOML.
+// Unknown keys are rejected so typos don't go unnoticed.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		err = decodeYAML(data, &cfg)
+	default:
+		err = decodeTOML(data, &cfg)
+	}
+	if err != nil {
+		// Decoder errors already carry the offending line number
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &cfg, nil
+}
+
+func decodeYAML(data []byte, cfg *Config) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+func decodeTOML(data []byte, cfg *Config) error {
+	md, err := toml.Decode(string(data), cfg)
+	if err != nil {
+		return err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, key := range undecoded {
+			keys[i] = key.String()
+		}
+		sort.Strings(keys)
+		return fmt.Errorf("unknown keys: %s", strings.Join(keys, ", "))
+	}
+	return nil
+}
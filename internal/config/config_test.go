@@ -0,0 +1,177 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes content to name in dir and returns its path.
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newRepo returns an empty directory marked as a repository root, so
+// Locate doesn't search above it.
+func newRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLocateMissingFile(t *testing.T) {
+	path, err := Locate(newRepo(t))
+	if err != nil || path != "" {
+		t.Errorf("Locate() = %q, %v; want \"\", nil", path, err)
+	}
+}
+
+func TestLocateSearchesParents(t *testing.T) {
+	root := newRepo(t)
+	want := writeFile(t, root, "reflex.yaml", "command: make\n")
+	sub := filepath.Join(root, "cmd", "server")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Locate(sub)
+	if err != nil || got != want {
+		t.Errorf("Locate() = %q, %v; want %q, nil", got, err, want)
+	}
+}
+
+func TestLocateOutsideRepo(t *testing.T) {
+	outer := t.TempDir()
+	want := writeFile(t, outer, "reflex.yaml", "command: make\n")
+	sub := filepath.Join(outer, "project")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a .git, a config file in a parent directory is ignored
+	if got, err := Locate(sub); err != nil || got != "" {
+		t.Errorf("Locate(sub) = %q, %v; want \"\", nil", got, err)
+	}
+	// but one in the directory itself is found
+	if got, err := Locate(outer); err != nil || got != want {
+		t.Errorf("Locate(outer) = %q, %v; want %q, nil", got, err, want)
+	}
+}
+
+func TestResolvePathsFromSubdirectory(t *testing.T) {
+	root := newRepo(t)
+	abs := filepath.Join(root, "shared")
+	writeFile(t, root, "reflex.toml", `command = "make"
+watch = ["src", "`+filepath.ToSlash(abs)+`"]
+working_dir = "web"
+env_file = ".env.dev"
+`)
+	sub := filepath.Join(root, "cmd", "server")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(sub)
+
+	path, err := Locate(".")
+	if err != nil || path == "" {
+		t.Fatalf("Locate() = %q, %v", path, err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := BaseDir(path)
+	if want := filepath.Join("..", ".."); dir != want {
+		t.Fatalf("BaseDir() = %q, want %q", dir, want)
+	}
+	cfg.ResolvePaths(dir)
+
+	up := filepath.Join("..", "..")
+	if want := []string{filepath.Join(up, "src"), abs}; strings.Join(cfg.Watch, ",") != strings.Join(want, ",") {
+		t.Errorf("Watch = %q, want %q", cfg.Watch, want)
+	}
+	if want := filepath.Join(up, "web"); cfg.WorkingDir != want {
+		t.Errorf("WorkingDir = %q, want %q", cfg.WorkingDir, want)
+	}
+	if want := filepath.Join(up, ".env.dev"); cfg.EnvFile != want {
+		t.Errorf("EnvFile = %q, want %q", cfg.EnvFile, want)
+	}
+}
+
+func TestLocatePrefersFirstName(t *testing.T) {
+	root := newRepo(t)
+	writeFile(t, root, ".reflexrc", `command = "b"`)
+	want := writeFile(t, root, "reflex.yaml", "command: a\n")
+
+	if got, _ := Locate(root); got != want {
+		t.Errorf("Locate() = %q, want %q", got, want)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name, content string
+	}{
+		{"reflex.yaml", "command: go run .\nextensions: [.go]\ndebounce: 500ms\n"},
+		{".reflexrc", "command = \"go run .\"\nextensions = [\".go\"]\ndebounce = \"500ms\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(writeFile(t, dir, tt.name, tt.content))
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Command != "go run ." {
+				t.Errorf("Command = %q", cfg.Command)
+			}
+			if len(cfg.Extensions) != 1 || cfg.Extensions[0] != ".go" {
+				t.Errorf("Extensions = %q", cfg.Extensions)
+			}
+			if cfg.Debounce == nil || time.Duration(*cfg.Debounce) != 500*time.Millisecond {
+				t.Errorf("Debounce = %v, want 500ms", cfg.Debounce)
+			}
+		})
+	}
+}
+
+func TestLoadErrorsHaveLineNumbers(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name, content, line string
+	}{
+		{"malformed YAML", "command: make\n\textensions: [.go]\n", "line 2"},
+		{"unknown YAML key", "command: make\ncomand: make\n", "line 2"},
+		{"bad YAML duration", "command: make\n\ndebounce: soon\n", "line 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, dir, "reflex.yaml", tt.content)
+			_, err := Load(path)
+			if err == nil {
+				t.Fatal("Load succeeded")
+			}
+			if !strings.Contains(err.Error(), tt.line) || !strings.Contains(err.Error(), path) {
+				t.Errorf("error %q doesn't name %s and %s", err, path, tt.line)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsUnknownTOMLKeys(t *testing.T) {
+	path := writeFile(t, t.TempDir(), ".reflexrc", "command = \"make\"\ncomand = \"make\"\n")
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "comand") {
+		t.Errorf("Load() error = %v, want one naming the unknown key", err)
+	}
+}
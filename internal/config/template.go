@@ -0,0 +1,123 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// TemplateFileName is the file written by WriteTemplate.
+const TemplateFileName = "reflex.toml"
+
+// Template is a commented starter config written by `reflex init`.
+const Template = `# Reflex configuration.
+# Command line flags take precedence over values in this file.
+
+# Shell command to run and restart on changes.
+command = "npm run dev"
+
+# Build command run before each restart. The old process keeps running
+# until the build succeeds; if it fails, the errors are shown instead.
+# build = "go build -o ./tmp/app ."
+
+# File extensions that trigger a restart.
+# extensions = [".js", ".ts", ".jsx", ".tsx", ".css"]
+
+# Extra names, paths or globs to ignore, in addition to node_modules, .git, etc.
+# ignore = ["coverage", "tmp"]
+
+# Kinds of change that trigger a restart: create, write, remove and rename.
+# on = ["create", "write", "remove"]
+
+# Regular expressions matched against the full path of files and directories
+# to skip.
+# exclude = ['/storybook-static(/|$)', '\.generated\.ts$']
+
+# Directory the command runs in, relative to where Reflex is started.
+# working_dir = "./packages/api"
+
+# .env file to read variables for the command from, restarting it when the
+# file changes. Defaults to .env in the working directory.
+# env_file = ".env.local"
+
+# Root directories to watch.
+# watch = ["."]
+
+# Delay before restarting after a change. "0" restarts immediately.
+# debounce = "250ms"
+
+# Pause restarts for 30s when changes restart the command faster than this,
+# e.g. when it writes files it watches. 0 never pauses.
+# max_restarts_per_minute = 30
+
+# Time to wait after SIGTERM before sending SIGKILL.
+# kill_timeout = "5s"
+
+# Restart the command with backoff when it exits or crashes.
+# restart_on_exit = false
+
+# Dev proxy: listen on proxy_port and forward to proxy_target.
+# proxy_port = 4000
+# proxy_target = "http://localhost:3000"
+# With several tasks, the one serving proxy_target; only its restarts hold
+# proxied requests.
+# serve = "web"
+
+# Serve a JSON API on 127.0.0.1 for status, logs and manual restarts.
+# api_port = 7878
+
+# Tables such as [tasks.*], [[rule]] and [env] must come after all top-level keys.
+
+# Run several named commands side by side instead of "command". Each task
+# restarts only on changes matching its own extensions or patterns, if set.
+# [tasks.web]
+# command = "npm run dev"
+# extensions = [".ts", ".tsx", ".css"]
+#
+# [tasks.api]
+# build = "go build -o ./tmp/api ./cmd/api"
+# command = "./tmp/api"
+# patterns = ["**/*.go", "go.mod"]
+
+# Or declare commands by the files that restart them, in place of
+# "command" or tasks. watch_dirs narrows a rule to files in those directories;
+# include and exclude add and remove files by glob.
+# [[rule]]
+# extensions = [".go"]
+# exclude = ["*_test.go"]
+# command = "go run ./cmd/server"
+# watch_dirs = ["cmd", "internal"]
+#
+# [[rule]]
+# name = "tests"
+# include = ["*_test.go"]
+# command = "go test ./..."
+#
+# [[rule]]
+# name = "assets"
+# extensions = [".html", ".css"]
+# command = "npm run build:assets"
+
+# Extra environment variables for the command. ${NAME} expands to other
+# variables defined here or in the environment.
+# [env]
+# PORT = "3000"
+# API_URL = "http://localhost:${PORT}/api"
+`
+
+// WriteTemplate writes Template to path, refusing to overwrite an
+// existing file.
+func WriteTemplate(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%s already exists", path)
+		}
+		return err
+	}
+	if _, err := f.WriteString(Template); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,149 @@
+// Package dotenv reads environment variables from .env files.
+package dotenv
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Load reads the variables in the .env file at path. Errors name the file
+// and, for a malformed file, the line at fault.
+func Load(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return vars, nil
+}
+
+// Parse reads variables from the contents of a .env file. Each line is
+// KEY=VALUE, optionally preceded by "export". Blank lines and lines
+// starting with # are skipped. An unquoted value ends at a # that follows
+// whitespace and has surrounding whitespace trimmed. A value in single
+// quotes is taken as it is; one in double quotes has \n, \r, \t, \", \\
+// and \$ escapes replaced. Quoted values may span lines. Values are not
+// expanded, and a later line replaces an earlier one for the same key.
+func Parse(text string) (map[string]string, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	vars := make(map[string]string)
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "export"); ok && rest != "" && (rest[0] == ' ' || rest[0] == '\t') {
+			line = strings.TrimSpace(rest)
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE, got %q", lineNo, line)
+		}
+		key = strings.TrimSpace(key)
+		if !validKey(key) {
+			return nil, fmt.Errorf("line %d: invalid variable name %q", lineNo, key)
+		}
+		value = strings.TrimLeft(value, " \t")
+
+		if value == "" || (value[0] != '\'' && value[0] != '"') {
+			vars[key] = unquoted(value)
+			continue
+		}
+
+		// Gather lines until the closing quote
+		quote := value[0]
+		value = value[1:]
+		end := closingQuote(value, quote)
+		for end < 0 && i+1 < len(lines) {
+			i++
+			value += "\n" + lines[i]
+			end = closingQuote(value, quote)
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("line %d: unterminated quoted value for %s", lineNo, key)
+		}
+		if after := strings.TrimSpace(value[end+1:]); after != "" && !strings.HasPrefix(after, "#") {
+			return nil, fmt.Errorf("line %d: unexpected %q after the quoted value for %s", lineNo, after, key)
+		}
+		value = value[:end]
+		if quote == '"' {
+			value = unescape(value)
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+// validKey reports whether key is a usable variable name: letters, digits
+// and underscores, not starting with a digit.
+func validKey(key string) bool {
+	if key == "" || (key[0] >= '0' && key[0] <= '9') {
+		return false
+	}
+	for _, c := range key {
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// unquoted returns an unquoted value without its trailing comment and
+// surrounding whitespace.
+func unquoted(value string) string {
+	for i := 1; i < len(value); i++ {
+		if value[i] == '#' && (value[i-1] == ' ' || value[i-1] == '\t') {
+			value = value[:i]
+			break
+		}
+	}
+	return strings.TrimSpace(value)
+}
+
+// closingQuote returns the index in value of the quote that ends it, or -1
+// if there is none. In double quotes, a quote after a backslash doesn't
+// count.
+func closingQuote(value string, quote byte) int {
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && quote == '"':
+			i++
+		case value[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// unescape replaces the escapes allowed in a double-quoted value. Other
+// backslashes are kept.
+func unescape(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			b.WriteByte(value[i])
+			continue
+		}
+		switch value[i+1] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '"', '\\', '$':
+			b.WriteByte(value[i+1])
+		default:
+			b.WriteByte('\\')
+			continue
+		}
+		i++
+	}
+	return b.String()
+}
@@ -0,0 +1,65 @@
+package dotenv
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want map[string]string
+	}{
+		{"plain", "A=1\nB = two \n", map[string]string{"A": "1", "B": "two"}},
+		{"blank lines and comments", "\n# comment\n  # indented\nA=1\n", map[string]string{"A": "1"}},
+		{"export prefix", "export A=1\nexport\tB=2\nexported=3", map[string]string{"A": "1", "B": "2", "exported": "3"}},
+		{"inline comment", "A=1 # note\nB=a#b\nC=x\t# tab", map[string]string{"A": "1", "B": "a#b", "C": "x"}},
+		{"single quotes", `A='kept as $written\n' # note`, map[string]string{"A": `kept as $written\n`}},
+		{"double quotes", `A="a # not a comment"`, map[string]string{"A": "a # not a comment"}},
+		{"escapes", `A="l1\nl2\t\"q\" \\ \$HOME \x"`, map[string]string{"A": "l1\nl2\t\"q\" \\ $HOME \\x"}},
+		{"multi-line double", "A=\"one\ntwo\"\nB=3", map[string]string{"A": "one\ntwo", "B": "3"}},
+		{"multi-line single", "A='one\n\ntwo'", map[string]string{"A": "one\n\ntwo"}},
+		{"CRLF", "A=1\r\nB=\"x\r\ny\"\r\n", map[string]string{"A": "1", "B": "x\ny"}},
+		{"empty value", "A=\nB=''", map[string]string{"A": "", "B": ""}},
+		{"later wins", "A=1\nA=2", map[string]string{"A": "2"}},
+		{"not expanded", "A=1\nB=${A}", map[string]string{"A": "1", "B": "${A}"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.text)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("Parse() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string // Start of the error
+	}{
+		{"no equals", "A=1\n\nJUSTAKEY", "line 3: expected KEY=VALUE"},
+		{"invalid name", "# c\n1A=1", "line 2: invalid variable name"},
+		{"name with dash", "MY-VAR=1", "line 1: invalid variable name"},
+		{"unterminated double", "A=1\nB=\"open\nC=2", "line 2: unterminated quoted value for B"},
+		{"unterminated single", "A='open", "line 1: unterminated quoted value for A"},
+		{"after quote", "A=1\nB=\"x\" y", `line 2: unexpected "y" after the quoted value for B`},
+		{"after multi-line quote", "A=\"x\ny\"z\nB=1", `line 1: unexpected "z" after the quoted value for A`},
+		{"line after multi-line value", "A=\"x\ny\"\nBAD", "line 3: expected KEY=VALUE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.text)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("Parse() error = %v, want one starting %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+// Package har records the requests passing through the dev proxy and writes
+// them out in the HTTP Archive (HAR 1.2) format, which browsers' developer
+// tools and API clients such as Postman can import.
+package har
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Codimow/Reflex/internal/proxy"
+)
+
+// MaxEntries is how many requests a Recorder keeps; older ones are dropped.
+// With the default capture limit, that is at most around 128 MB of bodies.
+const MaxEntries = 1000
+
+// Recorder accumulates request logs until they are flushed as a HAR file.
+// Logs carry bodies and headers only when the proxy is capturing (see
+// proxy.WithCapture); without them, entries record just the request line
+// and status. It is safe for concurrent use.
+type Recorder struct {
+	mu      sync.Mutex
+	baseURL string // Scheme and host the proxy was reached on
+	entries []proxy.RequestLog
+}
+
+// NewRecorder creates an empty Recorder. baseURL, e.g.
+// "http://localhost:4000", is put in front of each request's path to make
+// the full URL the client requested.
+func NewRecorder(baseURL string) *Recorder {
+	return &Recorder{baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// Add records a request.
+func (r *Recorder) Add(rl proxy.RequestLog) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.entries) == MaxEntries {
+		r.entries = r.entries[1:]
+	}
+	r.entries = append(r.entries, rl)
+}
+
+// Len returns how many requests have been recorded.
+func (r *Recorder) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.entries)
+}
+
+// Flush writes the recorded requests to w as a HAR document, in the order
+// they started.
+func (r *Recorder) Flush(w io.Writer) error {
+	r.mu.Lock()
+	logs := append([]proxy.RequestLog(nil), r.entries...)
+	r.mu.Unlock()
+
+	sort.SliceStable(logs, func(i, j int) bool {
+		return logs[i].Timestamp.Before(logs[j].Timestamp)
+	})
+	doc := document{Log: harLog{
+		Version: "1.2",
+		Creator: creator{Name: "Reflex", Version: version()},
+		Entries: make([]entry, len(logs)),
+	}}
+	for i, rl := range logs {
+		doc.Log.Entries[i] = r.entry(rl)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// WriteFile flushes the recorded requests to a HAR file at path, replacing
+// it if it exists.
+func (r *Recorder) WriteFile(path string) error {
+	var buf bytes.Buffer
+	if err := r.Flush(&buf); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// entry converts a request log to a HAR entry.
+func (r *Recorder) entry(rl proxy.RequestLog) entry {
+	proto := rl.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	u := r.baseURL + rl.Path
+	if rl.Query != "" {
+		u += "?" + rl.Query
+	}
+	ms := float64(rl.Duration) / float64(time.Millisecond)
+
+	req := request{
+		Method:      rl.Method,
+		URL:         u,
+		HTTPVersion: proto,
+		Cookies:     []nameValue{},
+		Headers:     headers(rl.RequestHeader),
+		QueryString: queryString(rl.Query),
+		HeadersSize: -1,
+		BodySize:    len(rl.RequestBody),
+	}
+	if len(rl.RequestBody) > 0 {
+		req.PostData = &postData{MimeType: rl.RequestHeader.Get("Content-Type"), Text: string(rl.RequestBody)}
+	}
+
+	body := decodeBody(rl.ResponseBody, rl.ResponseHeader.Get("Content-Encoding"))
+	text, encoding := bodyText(body)
+	resp := response{
+		Status:      rl.StatusCode,
+		StatusText:  http.StatusText(rl.StatusCode),
+		HTTPVersion: proto,
+		Cookies:     []nameValue{},
+		Headers:     headers(rl.ResponseHeader),
+		Content: content{
+			Size:     len(body),
+			MimeType: rl.ResponseHeader.Get("Content-Type"),
+			Text:     text,
+			Encoding: encoding,
+		},
+		RedirectURL: rl.ResponseHeader.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    len(rl.ResponseBody),
+	}
+
+	return entry{
+		StartedDateTime: rl.Timestamp.Format("2006-01-02T15:04:05.000Z07:00"),
+		Time:            ms,
+		Request:         req,
+		Response:        resp,
+		Cache:           struct{}{},
+		Timings:         timings{Send: 0, Wait: ms, Receive: 0},
+	}
+}
+
+// version returns the version Reflex was built as, e.g. "v1.2.0" when
+// installed with go install, or "devel".
+func version() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "devel"
+}
+
+// headers lists h sorted by name, for a stable file.
+func headers(h http.Header) []nameValue {
+	list := []nameValue{}
+	for name, values := range h {
+		for _, v := range values {
+			list = append(list, nameValue{Name: name, Value: v})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// queryString splits a raw query into its parameters, in order.
+func queryString(raw string) []nameValue {
+	list := []nameValue{}
+	for _, pair := range strings.Split(raw, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		if n, err := url.QueryUnescape(name); err == nil {
+			name = n
+		}
+		if v, err := url.QueryUnescape(value); err == nil {
+			value = v
+		}
+		list = append(list, nameValue{Name: name, Value: value})
+	}
+	return list
+}
+
+// decodeBody undoes gzip content encoding, so the archive holds the body
+// the page saw. A body that doesn't decode, e.g. because capturing cut it
+// short, is kept as it was sent.
+func decodeBody(body []byte, encoding string) []byte {
+	if len(body) == 0 || !strings.EqualFold(encoding, "gzip") {
+		return body
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return body
+	}
+	decoded, err := io.ReadAll(zr)
+	if err != nil {
+		return body
+	}
+	return decoded
+}
+
+// bodyText returns body as HAR text: as is if it is valid UTF-8, otherwise
+// base64-encoded, with "base64" as the encoding to report.
+func bodyText(body []byte) (text, encoding string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+// The HAR 1.2 document, as far as Reflex fills it in. See
+// http://www.softwareishard.com/blog/har-12-spec/.
+
+type document struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string  `json:"version"`
+	Creator creator `json:"creator"`
+	Entries []entry `json:"entries"`
+}
+
+type creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type entry struct {
+	StartedDateTime string   `json:"startedDateTime"`
+	Time            float64  `json:"time"` // Milliseconds
+	Request         request  `json:"request"`
+	Response        response `json:"response"`
+	Cache           struct{} `json:"cache"`
+	Timings         timings  `json:"timings"`
+}
+
+type request struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []nameValue `json:"cookies"`
+	Headers     []nameValue `json:"headers"`
+	QueryString []nameValue `json:"queryString"`
+	PostData    *postData   `json:"postData,omitempty"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []nameValue `json:"cookies"`
+	Headers     []nameValue `json:"headers"`
+	Content     content     `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type nameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type postData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type content struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type timings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
@@ -0,0 +1,119 @@
+// Package healthcheck waits for a started process to be ready to serve.
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ErrTimeout is returned when a check doesn't pass within its timeout.
+var ErrTimeout = errors.New("health check timeout")
+
+// attemptTimeout bounds a single attempt, so a server that accepts
+// connections but is slow to answer its first request still gets a chance.
+const attemptTimeout = 5 * time.Second
+
+// ParseTarget parses a readiness target for WaitFor: tcp://host:port, or an
+// http:// or https:// URL.
+func ParseTarget(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "tcp":
+		if u.Port() == "" {
+			return nil, fmt.Errorf("%q has no port", s)
+		}
+	case "http", "https":
+		if u.Host == "" {
+			return nil, fmt.Errorf("%q has no host", s)
+		}
+	default:
+		return nil, fmt.Errorf("%q must start with tcp://, http:// or https://", s)
+	}
+	return u, nil
+}
+
+// PortTarget returns the target that checks port on localhost.
+func PortTarget(port int) *url.URL {
+	return &url.URL{Scheme: "tcp", Host: net.JoinHostPort("localhost", strconv.Itoa(port))}
+}
+
+// Describe names target briefly for a status line: ":3000" for a local TCP
+// port, the whole URL otherwise.
+func Describe(target *url.URL) string {
+	if target.Scheme == "tcp" {
+		switch target.Hostname() {
+		case "localhost", "127.0.0.1", "::1", "":
+			return ":" + target.Port()
+		}
+		return target.Host
+	}
+	return target.String()
+}
+
+// WaitForPort polls port on localhost every interval until it accepts a TCP
+// connection. It returns an error wrapping ErrTimeout if the port is still
+// closed after timeout, or ctx's error if ctx is done first.
+func WaitForPort(ctx context.Context, port int, interval, timeout time.Duration) error {
+	return WaitFor(ctx, PortTarget(port), interval, timeout)
+}
+
+// WaitFor polls target every interval until it is ready: a tcp:// target
+// once it accepts a connection, an http:// or https:// one once a GET
+// answers with a 2xx status. It returns an error wrapping ErrTimeout if
+// target still isn't ready after timeout, or ctx's error if ctx is done
+// first.
+func WaitFor(ctx context.Context, target *url.URL, interval, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if ready(ctx, target) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			return fmt.Errorf("%w: %s not ready after %v", ErrTimeout, Describe(target), timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// ready makes a single attempt at target.
+func ready(ctx context.Context, target *url.URL) bool {
+	if target.Scheme == "tcp" {
+		dialer := net.Dialer{Timeout: attemptTimeout}
+		conn, err := dialer.DialContext(ctx, "tcp", target.Host)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, attemptTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
@@ -0,0 +1,105 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const interval = 10 * time.Millisecond
+
+// closedPort returns a local port nothing listens on.
+func closedPort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	return port
+}
+
+func TestWaitForListener(t *testing.T) {
+	port := closedPort(t)
+
+	// The port opens after a few attempts
+	errc := make(chan error, 1)
+	go func() {
+		errc <- WaitForPort(t.Context(), port, interval, 5*time.Second)
+	}()
+	time.Sleep(5 * interval)
+	l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if err := <-errc; err != nil {
+		t.Errorf("WaitForPort() = %v, want nil", err)
+	}
+}
+
+func TestWaitForTimeout(t *testing.T) {
+	port := closedPort(t)
+	start := time.Now()
+	err := WaitFor(t.Context(), &url.URL{Scheme: "tcp", Host: net.JoinHostPort("127.0.0.1", strconv.Itoa(port))}, interval, 100*time.Millisecond)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("WaitFor() = %v, want it to wrap ErrTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("gave up after %v, before the timeout", elapsed)
+	}
+}
+
+func TestWaitForCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	err := WaitForPort(ctx, closedPort(t), interval, 5*time.Second)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("WaitForPort() = %v, want context.Canceled", err)
+	}
+}
+
+func TestWaitForHTTP(t *testing.T) {
+	// Answers 503 until it has been asked three times
+	var asked atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if asked.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	target, err := ParseTarget(srv.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WaitFor(t.Context(), target, interval, 5*time.Second); err != nil {
+		t.Errorf("WaitFor() = %v, want nil", err)
+	}
+	if got := asked.Load(); got != 3 {
+		t.Errorf("asked %d times, want 3", got)
+	}
+}
+
+func TestWaitForHTTPNot2xx(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "warming up", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	target, _ := ParseTarget(srv.URL)
+
+	// The server is up, but never answers with a 2xx
+	err := WaitFor(t.Context(), target, interval, 100*time.Millisecond)
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("WaitFor() = %v, want it to wrap ErrTimeout", err)
+	}
+}
@@ -0,0 +1,216 @@
+// Package logfile writes process output to a size-rotated file on disk.
+package logfile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultMaxSize is the size at which the log file is rotated.
+const DefaultMaxSize = 10 << 20 // 10 MB
+
+// DefaultKeep is how many rotated files (path.1, path.2) are kept.
+const DefaultKeep = 2
+
+// Stdout is the path that makes Open write to standard output, which is
+// never rotated, and written out line by line so it keeps its place among
+// whatever else goes to standard output.
+const Stdout = "-"
+
+// flushInterval is how often buffered lines are written out.
+const flushInterval = time.Second
+
+// timeFormat prefixes every line written to the file, in local time, and
+// dates the session markers.
+const timeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// Option configures optional Writer behaviour.
+type Option func(*Writer)
+
+// WithKeep keeps n rotated files instead of DefaultKeep. With 0, the file
+// is truncated when it reaches its maximum size.
+func WithKeep(n int) Option {
+	return func(w *Writer) {
+		w.keep = n
+	}
+}
+
+// Writer appends timestamped lines to a log file, rotating it once it grows
+// past maxSize. Lines are buffered and written out every second and on
+// Close. Once writing fails, e.g. because the disk is full, the Writer
+// stops trying: every later call returns the same error. It is safe for
+// concurrent use.
+type Writer struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	keep    int
+	file    *os.File
+	buf     *bufio.Writer
+	size    int64
+	err     error // First write error; sticky
+
+	done chan struct{} // Closed by Close to stop the flush loop
+}
+
+// Open opens path for appending, creating it if needed, or standard output
+// if path is Stdout. A maxSize of zero or less means DefaultMaxSize.
+func Open(path string, maxSize int64, opts ...Option) (*Writer, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	w := &Writer{path: path, maxSize: maxSize, keep: DefaultKeep, done: make(chan struct{})}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if path == Stdout {
+		w.buf = bufio.NewWriter(os.Stdout)
+	} else if err := w.open(); err != nil {
+		return nil, err
+	}
+	go w.flushLoop()
+	return w, nil
+}
+
+// Line writes a single line of output with a timestamp prefix.
+func (w *Writer) Line(text string) error {
+	return w.write(fmt.Sprintf("%s %s\n", time.Now().Format(timeFormat), text))
+}
+
+// Session writes a marker separating runs of a process. Run 0 is the
+// initial start; later runs are numbered restarts, labelled with their
+// reason if it isn't empty. A non-empty name labels the marker, for when
+// several processes share the file. at is written in the same local time
+// and format as the line prefixes.
+func (w *Writer) Session(name string, run int, reason string, at time.Time) error {
+	label := "start"
+	if run > 0 {
+		label = fmt.Sprintf("restart #%d", run)
+		if reason != "" {
+			label += " (" + reason + ")"
+		}
+	}
+	if name != "" {
+		label = name + ": " + label
+	}
+	return w.write(fmt.Sprintf("--- %s at %s ---\n", label, at.Local().Format(timeFormat)))
+}
+
+// Close writes out any buffered lines and closes the underlying file.
+func (w *Writer) Close() error {
+	close(w.done)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.flush()
+	if w.file != nil {
+		if closeErr := w.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// flushLoop writes buffered lines out every flushInterval until Close.
+func (w *Writer) flushLoop() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			w.flush()
+			w.mu.Unlock()
+		}
+	}
+}
+
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = info.Size()
+	w.buf = bufio.NewWriter(f)
+	return nil
+}
+
+func (w *Writer) write(s string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+
+	if w.file != nil && w.size+int64(len(s)) > w.maxSize && w.size > 0 {
+		if err := w.rotate(); err != nil {
+			w.err = err
+			return err
+		}
+	}
+
+	n, err := io.WriteString(w.buf, s)
+	w.size += int64(n)
+	if err != nil {
+		w.err = err
+		return err
+	}
+	if w.file == nil {
+		return w.flush()
+	}
+	return nil
+}
+
+// flush writes out buffered lines, recording any error. Callers must hold
+// w.mu.
+func (w *Writer) flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.buf.Flush(); err != nil {
+		w.err = err
+	}
+	return w.err
+}
+
+// rotate shifts path → path.1 → path.2, dropping the oldest file, and
+// reopens an empty file at path. Callers must hold w.mu.
+func (w *Writer) rotate() error {
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	if w.keep == 0 {
+		if err := os.Truncate(w.path, 0); err != nil {
+			return err
+		}
+		return w.open()
+	}
+	for i := w.keep; i > 0; i-- {
+		src := w.path
+		if i > 1 {
+			src = fmt.Sprintf("%s.%d", w.path, i-1)
+		}
+		// A missing intermediate file just means we haven't rotated that far yet
+		if err := os.Rename(src, fmt.Sprintf("%s.%d", w.path, i)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return w.open()
+}
@@ -0,0 +1,160 @@
+package logfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readFile returns the content of path, or "" if it doesn't exist.
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// writeLines writes the lines numbered from up to, but not including, to
+// and closes w.
+func writeLines(t *testing.T, w *Writer, from, to int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		if err := w.Line(fmt.Sprintf("line %02d", i)); err != nil {
+			t.Fatalf("Line: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reflex.log")
+	// Each line, with its timestamp, is 33 to 38 bytes long, so three fit
+	w, err := Open(path, 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLines(t, w, 0, 12)
+
+	for name, want := range map[string]string{
+		path:        "line 09\nline 10\nline 11\n",
+		path + ".1": "line 06\nline 07\nline 08\n",
+		path + ".2": "line 03\nline 04\nline 05\n",
+		path + ".3": "",
+	} {
+		if got := stripTimes(readFile(t, name)); got != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), got, want)
+		}
+	}
+}
+
+func TestRotateKeepNone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reflex.log")
+	w, err := Open(path, 120, WithKeep(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLines(t, w, 0, 8)
+
+	if got, want := stripTimes(readFile(t, path)), "line 06\nline 07\n"; got != want {
+		t.Errorf("content = %q, want only the lines since the last truncation, %q", got, want)
+	}
+	if _, err := os.Stat(path + ".1"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("%s.1 exists with keep 0", filepath.Base(path))
+	}
+}
+
+func TestWriteErrorIsSticky(t *testing.T) {
+	w, err := Open(filepath.Join(t.TempDir(), "reflex.log"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.file.Close()
+
+	// Longer than the buffer, so it is written through at once
+	first := w.Line(strings.Repeat("x", 8192))
+	if first == nil {
+		t.Fatal("Line to a closed file succeeded")
+	}
+	if err := w.Line("after"); err != first {
+		t.Errorf("Line after a failure = %v, want the first error %v", err, first)
+	}
+	if err := w.Session("", 1, "", time.Now()); err != first {
+		t.Errorf("Session after a failure = %v, want the first error %v", err, first)
+	}
+}
+
+func TestStdout(t *testing.T) {
+	r, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = pw
+	w, err := Open(Stdout, 1)
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lines are written out at once, and never rotated however small maxSize
+	if err := w.Line("one"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Line("two"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	pw.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stripTimes(string(out)), "one\ntwo\n"; got != want {
+		t.Errorf("standard output = %q, want %q", got, want)
+	}
+}
+
+func TestSessionTimeMatchesLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reflex.log")
+	w, err := Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := w.Session("web", 2, "main.go changed", at); err != nil {
+		t.Fatal(err)
+	}
+	writeLines(t, w, 0, 1)
+
+	lines := strings.Split(readFile(t, path), "\n")
+	want := fmt.Sprintf("--- web: restart #2 (main.go changed) at %s ---", at.Local().Format(timeFormat))
+	if lines[0] != want {
+		t.Errorf("marker = %q, want %q", lines[0], want)
+	}
+	stamp, _, _ := strings.Cut(lines[1], " ")
+	if _, err := time.Parse(timeFormat, stamp); err != nil || len(stamp) != len(at.Local().Format(timeFormat)) {
+		t.Errorf("line prefix %q is not in the marker's format: %v", stamp, err)
+	}
+}
+
+// stripTimes removes the timestamp prefix from every line in s.
+func stripTimes(s string) string {
+	var b strings.Builder
+	for line := range strings.SplitAfterSeq(s, "\n") {
+		if _, text, ok := strings.Cut(line, " "); ok {
+			b.WriteString(text)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,74 @@
+// Package logging carries Reflex's own messages, such as which file changed
+// or why the proxy failed a request, apart from the output of the commands
+// it runs. They go to stderr unless redirected with SetOutput, which the
+// interactive UI does so that nothing writes over its screen.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Output receives each message, without a trailing newline. It may be
+// called from several goroutines at once.
+type Output func(text string)
+
+var (
+	mu     sync.Mutex
+	output = ToWriter(os.Stderr)
+)
+
+// SetOutput sends messages to out from now on; nil restores stderr.
+func SetOutput(out Output) {
+	if out == nil {
+		out = ToWriter(os.Stderr)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	output = out
+}
+
+// ToWriter returns an Output that writes each message to w as a line
+// prefixed with the date and time, like the standard logger.
+func ToWriter(w io.Writer) Output {
+	l := log.New(w, "", log.LstdFlags)
+	return func(text string) {
+		l.Println(text)
+	}
+}
+
+// Printf logs a message, with arguments handled as in fmt.Printf.
+func Printf(format string, args ...any) {
+	emit(fmt.Sprintf(format, args...))
+}
+
+// Println logs a message, with arguments handled as in fmt.Println.
+func Println(args ...any) {
+	emit(strings.TrimSuffix(fmt.Sprintln(args...), "\n"))
+}
+
+// Writer returns a writer that logs each line written to it, to pass
+// messages from the standard logger or an http.Server along.
+func Writer() io.Writer {
+	return writer{}
+}
+
+type writer struct{}
+
+func (writer) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimSuffix(string(p), "\n"), "\n") {
+		emit(line)
+	}
+	return len(p), nil
+}
+
+func emit(text string) {
+	mu.Lock()
+	out := output
+	mu.Unlock()
+	out(text)
+}
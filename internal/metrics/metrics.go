@@ -0,0 +1,65 @@
+// Package metrics samples the memory and CPU use of a running process.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// DefaultInterval is how often a Poller samples unless told otherwise.
+const DefaultInterval = time.Second
+
+// errNotFound is returned by a sample once the process group is gone.
+var errNotFound = errors.New("process not found")
+
+// errUnsupported is returned by a sample on platforms without a way to
+// read process usage.
+var errUnsupported = errors.New("process metrics not supported on this platform")
+
+// Stats is the usage of a process and the rest of its process group, so a
+// command run through a shell or a launcher like npm counts its children.
+type Stats struct {
+	MemoryMB   float64 // Resident memory
+	CPUPercent float64 // Share of one CPU since the previous sample
+}
+
+// Poller samples a process group at a fixed interval.
+type Poller struct {
+	interval time.Duration
+	sampler  *sampler
+}
+
+// NewPoller creates a Poller for the process group led by pid. An interval
+// of zero or less means DefaultInterval.
+func NewPoller(pid int, interval time.Duration) *Poller {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Poller{interval: interval, sampler: newSampler(pid)}
+}
+
+// Run passes a sample to send every interval until ctx is done or the
+// process group has exited. The first sample is taken one interval after
+// Run is called, so its CPU share covers a whole interval.
+func (p *Poller) Run(ctx context.Context, send func(Stats)) {
+	if _, err := p.sampler.sample(); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stats, err := p.sampler.sample()
+		if err != nil || ctx.Err() != nil {
+			return
+		}
+		send(stats)
+	}
+}
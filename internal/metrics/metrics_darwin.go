@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// sampler asks ps about the process group. macOS has no /proc, and ps
+// already reports a CPU share, so there's nothing to remember between
+// samples.
+type sampler struct {
+	pgid int
+}
+
+func newSampler(pid int) *sampler {
+	return &sampler{pgid: pid}
+}
+
+// sample adds up the processes in the group from a single ps run. ps's
+// %cpu is a decaying average rather than the share since the last sample,
+// which is close enough for a status line.
+func (s *sampler) sample() (Stats, error) {
+	out, err := exec.Command("ps", "-A", "-o", "pgid=,rss=,%cpu=").Output()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	var stats Stats
+	found := false
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		if pgid, err := strconv.Atoi(fields[0]); err != nil || pgid != s.pgid {
+			continue
+		}
+		rssKB, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		cpu, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			continue
+		}
+		found = true
+		stats.MemoryMB += rssKB / 1024
+		stats.CPUPercent += cpu
+	}
+	if !found {
+		return Stats{}, errNotFound
+	}
+	return stats, nil
+}
@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// clockTicks is the kernel's USER_HZ, the unit of CPU times in
+// /proc/<pid>/stat. It is 100 on every architecture Linux supports.
+const clockTicks = 100
+
+// sampler reads the process group from /proc, and remembers the CPU time
+// it had used at the last sample.
+type sampler struct {
+	pgid int
+
+	lastTicks uint64
+	lastAt    time.Time
+}
+
+func newSampler(pid int) *sampler {
+	return &sampler{pgid: pid}
+}
+
+// sample adds up the processes in the group. A process that exited since
+// the last sample takes its CPU time with it, so the share is clamped at
+// zero rather than going negative.
+func (s *sampler) sample() (Stats, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return Stats{}, err
+	}
+
+	var rssPages, ticks uint64
+	found := false
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		st, err := readStat(pid)
+		if err != nil || st.pgrp != s.pgid || st.zombie {
+			// Processes come and go while we read, and a zombie has
+			// already exited
+			continue
+		}
+		found = true
+		rssPages += st.rss
+		ticks += st.utime + st.stime
+	}
+	if !found {
+		return Stats{}, errNotFound
+	}
+
+	now := time.Now()
+	stats := Stats{MemoryMB: float64(rssPages*uint64(os.Getpagesize())) / (1 << 20)}
+	if !s.lastAt.IsZero() && ticks > s.lastTicks {
+		elapsed := now.Sub(s.lastAt).Seconds()
+		stats.CPUPercent = float64(ticks-s.lastTicks) / clockTicks / elapsed * 100
+	}
+	s.lastTicks, s.lastAt = ticks, now
+	return stats, nil
+}
+
+// procStat is the part of /proc/<pid>/stat a sample needs.
+type procStat struct {
+	zombie       bool
+	pgrp         int
+	utime, stime uint64 // CPU time in clock ticks
+	rss          uint64 // Resident set size in pages
+}
+
+// readStat parses /proc/<pid>/stat. The command name in the second field
+// is in parentheses and may contain spaces, so fields are counted from the
+// last closing parenthesis.
+func readStat(pid int) (procStat, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return procStat{}, err
+	}
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return procStat{}, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	// fields[0] is field 3 (state) in proc(5)
+	fields := bytes.Fields(data[i+1:])
+	if len(fields) < 22 {
+		return procStat{}, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+
+	st := procStat{zombie: string(fields[0]) == "Z"}
+	if st.pgrp, err = strconv.Atoi(string(fields[2])); err != nil {
+		return procStat{}, err
+	}
+	if st.utime, err = strconv.ParseUint(string(fields[11]), 10, 64); err != nil {
+		return procStat{}, err
+	}
+	if st.stime, err = strconv.ParseUint(string(fields[12]), 10, 64); err != nil {
+		return procStat{}, err
+	}
+	if st.rss, err = strconv.ParseUint(string(fields[21]), 10, 64); err != nil {
+		return procStat{}, err
+	}
+	return st, nil
+}
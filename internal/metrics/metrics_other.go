@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package metrics
+
+// sampler has no way to read process usage here, so a Poller stops
+// straight away.
+type sampler struct{}
+
+func newSampler(pid int) *sampler {
+	return &sampler{}
+}
+
+func (s *sampler) sample() (Stats, error) {
+	return Stats{}, errUnsupported
+}
@@ -2,122 +2,705 @@ package process
 
 import (
 	"bufio"
+	"errors"
 	"io"
+	"os"
 	"os/exec"
+	"sort"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 )
 
+// DefaultKillTimeout is how long Stop waits after SIGTERM before
+// escalating to SIGKILL.
+const DefaultKillTimeout = 5 * time.Second
+
 // Line represents a single line of output from the process.
 type Line struct {
-	Text string
+	Text   string
+	Source Source    // The stream the line was written to
+	Time   time.Time // When the line was read
+}
+
+// Source identifies the output stream a Line came from.
+type Source int
+
+const (
+	Stdout Source = iota
+	Stderr
+)
+
+// String returns "stdout" or "stderr".
+func (s Source) String() string {
+	if s == Stderr {
+		return "stderr"
+	}
+	return "stdout"
+}
+
+// Exit reports a run of the command that ended on its own, rather than
+// being stopped.
+type Exit struct {
+	Run    int           // Which run ended, counting from 1 as Runs does
+	Code   int           // Exit code, or -1 if the process was killed by a signal
+	Signal string        // Signal that killed the process, e.g. "SIGSEGV"; "" if it exited
+	Uptime time.Duration // How long the run lasted
 }
 
+// state is where a Manager is in the lifecycle of its current run.
+// Transitions happen under Manager.mu:
+//
+//	idle → starting → running → stopping → stopped
+//
+// A run that exits on its own goes from running (or starting) straight to
+// stopped. A failed start returns to idle, and Restart takes a stopped
+// Manager back to idle before starting again.
+type state int
+
+const (
+	stateIdle     state = iota // Not started yet
+	stateStarting              // Start is launching the command
+	stateRunning               // The command is running
+	stateStopping              // Stop has signalled the command and is waiting for it
+	stateStopped               // The command has exited and been reaped
+)
+
 // Manager manages a child process.
 type Manager struct {
-	command string
-	cmd     *exec.Cmd
-	output  chan Line
-	done    chan struct{}
+	// WorkingDir is the directory the command runs in. Empty means the
+	// current directory. It must be set before Start.
+	WorkingDir string
+
+	command     string
+	args        []string // Program and arguments run directly instead of command; nil runs command
+	killTimeout time.Duration
+	env         map[string]string // Extra environment variables for the child
+	usePTY      bool              // Run the child on a pseudo-terminal
+
+	envFunc func() map[string]string // Replaces env, called before each run
+	stdin   io.Reader                // Fed to the live run; nil leaves stdin empty
+
+	stopSignal syscall.Signal // Sent first by StopGraceful; zero means SIGTERM
+
 	mu      sync.Mutex
-	started bool
+	runEnv  map[string]string // Variables describing the next run, from SetRunEnv
+	input   io.Writer         // Standard input of the live run, when there is stdin
+	state   state
+	settled chan struct{} // Closed when a start attempt has finished, either way
+	cmd     *exec.Cmd
+	group   *processGroup // The processes of the current run, for stopping them
+	output  chan Line     // Shared by every run; never closed
+	exits   chan Exit     // Shared by every run; holds at most the latest Exit
+	done    chan struct{} // Closed by Stop to release the output readers
+	exited  *runExit      // How the current run ended, once it has
+	exitCh  chan int      // Gets the run's exit code, then is closed; see WaitForExit
+
+	runs     int           // Runs started so far
+	runStart time.Time     // When the current run started; zero once it has ended
+	uptime   time.Duration // Time spent running by runs that have ended
+}
+
+// runExit is the result of cmd.Wait for one run. The goroutine that reaps
+// the run holds on to it, so a restart can't mix up one run's result with
+// the next.
+type runExit struct {
+	done chan struct{} // Closed once cmd.Wait has returned
+	err  error         // Result of cmd.Wait, valid after done is closed
+}
+
+func newRunExit() *runExit {
+	return &runExit{done: make(chan struct{})}
 }
 
-// NewManager creates a new Manager for the given command.
-func NewManager(command string) *Manager {
-	return &Manager{
-		command: command,
-		output:  make(chan Line, 100),
-		done:    make(chan struct{}),
+// Option configures optional Manager behaviour.
+type Option func(*Manager)
+
+// WithEnv adds environment variables to the child's environment. They are
+// merged over the current process environment, replacing any variable of
+// the same name.
+func WithEnv(env map[string]string) Option {
+	return func(m *Manager) {
+		m.env = env
+	}
+}
+
+// WithEnvFunc is like WithEnv, but calls env for the variables before each
+// run, so they can change from one run to the next.
+func WithEnvFunc(env func() map[string]string) Option {
+	return func(m *Manager) {
+		m.envFunc = env
+	}
+}
+
+// WithStdin feeds what is read from r to the standard input of the live
+// run, so one reader serves every run. Input read between runs is dropped
+// rather than left for the next. Without it the child's standard input is
+// empty.
+func WithStdin(r io.Reader) Option {
+	return func(m *Manager) {
+		m.stdin = r
+	}
+}
+
+// WithPTY runs the child on a pseudo-terminal rather than pipes, so tools
+// that check for a terminal keep their colors and formatting. Where no
+// pseudo-terminal can be allocated the Manager falls back to pipes.
+func WithPTY() Option {
+	return func(m *Manager) {
+		m.usePTY = true
+	}
+}
+
+// WithStopSignal makes StopGraceful, and so Stop, ask the process group to
+// exit with sig instead of SIGTERM, for children that drain slowly on
+// SIGTERM or dump state on SIGQUIT. It has no effect on Windows, where
+// processes can't be sent signals.
+func WithStopSignal(sig syscall.Signal) Option {
+	return func(m *Manager) {
+		m.stopSignal = sig
 	}
 }
 
-// Start runs the command via sh -c and captures stdout/stderr.
+// NewManager creates a new Manager for the given command. killTimeout is how
+// long Stop waits for the process to exit after SIGTERM before sending
+// SIGKILL; zero or negative means DefaultKillTimeout.
+func NewManager(command string, killTimeout time.Duration, opts ...Option) *Manager {
+	if killTimeout <= 0 {
+		killTimeout = DefaultKillTimeout
+	}
+	m := &Manager{
+		command:     command,
+		killTimeout: killTimeout,
+		output:      make(chan Line, 100),
+		exits:       make(chan Exit, 1),
+		done:        make(chan struct{}),
+		exited:      newRunExit(),
+		exitCh:      make(chan int, 1),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.stdin != nil {
+		go m.feedStdin()
+	}
+	return m
+}
+
+// feedStdin copies the WithStdin reader to the live run's standard input
+// until the reader is done.
+func (m *Manager) feedStdin() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := m.stdin.Read(buf)
+		if n > 0 {
+			m.mu.Lock()
+			input := m.input
+			m.mu.Unlock()
+			if input != nil {
+				// Fails once the run has ended, losing only its input
+				input.Write(buf[:n])
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// NewManagerArgs creates a Manager that runs args[0] with the rest of args
+// as its arguments, without a shell in between. It panics if args is empty.
+// killTimeout and opts are as for NewManager.
+func NewManagerArgs(args []string, killTimeout time.Duration, opts ...Option) *Manager {
+	if len(args) == 0 {
+		panic("process: NewManagerArgs needs a program to run")
+	}
+	m := NewManager(strings.Join(args, " "), killTimeout, opts...)
+	m.args = args
+	return m
+}
+
+// Start runs the command through the shell, or the program NewManagerArgs
+// was given directly, and captures stdout/stderr. It does
+// nothing if the Manager has already been started; use Restart to run the
+// command again.
 func (m *Manager) Start() error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	if m.started {
+	if m.state != stateIdle {
+		m.mu.Unlock()
 		return nil
 	}
+	m.state = stateStarting
+	m.settled = make(chan struct{})
+	m.mu.Unlock()
 
-	m.cmd = exec.Command("sh", "-c", m.command)
-
-	// Create a process group for clean termination
-	m.cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	// While starting, only this goroutine touches cmd and the channels;
+	// Stop and Wait block on settled until it is done.
+	err := m.launch()
 
-	stdout, err := m.cmd.StdoutPipe()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	close(m.settled)
 	if err != nil {
+		m.state = stateIdle
 		return err
 	}
+	// The command may already have exited and been marked stopped
+	if m.state == stateStarting {
+		m.state = stateRunning
+	}
+	return nil
+}
 
-	stderr, err := m.cmd.StderrPipe()
-	if err != nil {
-		return err
+// launch starts the command and the goroutines that read its output and
+// reap it.
+func (m *Manager) launch() error {
+	m.mu.Lock()
+	command, args := m.command, m.args
+	m.mu.Unlock()
+	if args != nil {
+		m.cmd = exec.Command(args[0], args[1:]...)
+	} else {
+		m.cmd = shellCommand(command)
+	}
+	m.cmd.Dir = m.WorkingDir
+	env := m.env
+	if m.envFunc != nil {
+		env = m.envFunc()
+	}
+	m.mu.Lock()
+	runEnv := m.runEnv
+	m.mu.Unlock()
+	if len(env) > 0 || len(runEnv) > 0 {
+		m.cmd.Env = mergeEnv(mergeEnv(os.Environ(), runEnv), env)
+	}
+
+	readers := make(map[io.Reader]Source)
+	var ptmx, errPtmx *os.File
+	if m.usePTY {
+		var tty *os.File
+		var err error
+		if ptmx, tty, err = openPTY(); err == nil {
+			defer tty.Close() // The child keeps its own copy
+			m.cmd.Stdin, m.cmd.Stdout, m.cmd.Stderr = tty, tty, tty
+			// stderr gets a terminal of its own so the streams stay apart.
+			// Without one, both share the first and count as stdout.
+			if p, errTTY, err := openPTY(); err == nil {
+				defer errTTY.Close()
+				errPtmx = p
+				m.cmd.Stderr = errTTY
+				readers[errPtmx] = Stderr
+			}
+			setGroupAttrs(m.cmd, true)
+			readers[ptmx] = Stdout
+		}
+	}
+
+	// Input goes to the terminal like keys typed into it, or down a pipe
+	var input io.Writer
+	if m.stdin != nil && ptmx != nil {
+		input = ptmx
+	}
+
+	if ptmx == nil {
+		// Create a process group for clean termination
+		setGroupAttrs(m.cmd, false)
+
+		if m.stdin != nil {
+			stdin, err := m.cmd.StdinPipe()
+			if err != nil {
+				return err
+			}
+			input = stdin
+		}
+
+		stdout, err := m.cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+
+		stderr, err := m.cmd.StderrPipe()
+		if err != nil {
+			return err
+		}
+		readers[stdout] = Stdout
+		readers[stderr] = Stderr
 	}
 
 	if err := m.cmd.Start(); err != nil {
+		closePTYs(ptmx, errPtmx)
 		return err
 	}
 
-	m.started = true
+	group := startGroup(m.cmd)
+
+	m.mu.Lock()
+	m.runs++
+	m.runStart = time.Now()
+	m.group = group
+	m.input = input
+	run := m.runs
+	m.mu.Unlock()
+
+	// The goroutines below outlive this run's share of the Manager if it is
+	// restarted, so they hold on to this run's channels rather than the fields.
+	cmd, output, done, exited, exitCh := m.cmd, m.output, m.done, m.exited, m.exitCh
 
 	// Combine stdout and stderr
 	var wg sync.WaitGroup
-	wg.Add(2)
+	wg.Add(len(readers))
 
-	readLines := func(r io.Reader) {
+	readLines := func(r io.Reader, source Source) {
 		defer wg.Done()
 		scanner := bufio.NewScanner(r)
 		for scanner.Scan() {
+			// Terminals end lines with \r\n
+			text := strings.TrimSuffix(scanner.Text(), "\r")
 			select {
-			case <-m.done:
+			case <-done:
 				return
-			case m.output <- Line{Text: scanner.Text()}:
+			case output <- Line{Text: text, Source: source, Time: time.Now()}:
 			}
 		}
+		// Reading a pty fails with EIO once the child has gone; that's
+		// just the end of its output.
 	}
 
-	go readLines(stdout)
-	go readLines(stderr)
+	for r, source := range readers {
+		go readLines(r, source)
+	}
 
-	// Close output channel when both readers finish
+	// Reap the process once both readers have finished. This is the only
+	// place cmd.Wait is called: os/exec forbids calling it twice, so Stop
+	// and Wait block on the run's exited and read its err instead.
 	go func() {
 		wg.Wait()
-		m.cmd.Wait()
-		close(m.output)
+		closePTYs(ptmx, errPtmx)
+		exited.err = cmd.Wait()
+		group.release()
+
+		m.mu.Lock()
+		ran := time.Since(m.runStart)
+		m.uptime += ran
+		m.runStart = time.Time{}
+		m.input = nil
+		if m.state == stateStarting || m.state == stateRunning {
+			// Exited on its own; Stop marks the runs it stops itself.
+			// Only the latest Exit matters, so replace one nobody took.
+			m.state = stateStopped
+			select {
+			case <-m.exits:
+			default:
+			}
+			m.exits <- Exit{
+				Run:    run,
+				Code:   cmd.ProcessState.ExitCode(),
+				Signal: exitSignal(cmd.ProcessState),
+				Uptime: ran,
+			}
+		}
+		m.mu.Unlock()
+
+		exitCh <- cmd.ProcessState.ExitCode()
+		close(exitCh)
+		close(exited.done)
 	}()
 
 	return nil
 }
 
-// Stop kills the process and all its children.
+// Restart stops the process if it is still running and starts the command
+// again on the same Manager. Output and Exits keep their channels, so a
+// reader can follow every run without noticing the restart.
+func (m *Manager) Restart() error {
+	// The old run's exit status is no reason not to start a new one
+	m.Stop()
+
+	m.mu.Lock()
+	if m.state == stateStopped {
+		m.state = stateIdle
+		m.cmd = nil
+		m.done = make(chan struct{})
+		m.exited = newRunExit()
+		m.exitCh = make(chan int, 1)
+	}
+	m.mu.Unlock()
+
+	return m.Start()
+}
+
+// Stop terminates the process and all its children, allowing the kill
+// timeout the Manager was created with. See StopGraceful.
 func (m *Manager) Stop() error {
+	return m.StopGraceful(m.killTimeout)
+}
+
+// StopGraceful terminates the process and all its children. It sends SIGTERM,
+// or the signal given to WithStopSignal, to the process group so the child
+// can flush buffers and release ports, and escalates to SIGKILL if the
+// process hasn't exited within timeout.
+//
+// Stopping a Manager that was never started does nothing. Stopping one that
+// is already stopping or stopped waits for the process to be gone, so every
+// caller returns the same result from cmd.Wait.
+func (m *Manager) StopGraceful(timeout time.Duration) error {
+	if sig := m.stopSignal; sig != 0 {
+		return m.stop(func(g *processGroup) { g.signal(sig) }, timeout)
+	}
+	return m.stop((*processGroup).terminate, timeout)
+}
+
+// Interrupt stops the process like StopGraceful, but with SIGINT, as if the
+// user had pressed Ctrl+C in its terminal. Dev servers often only clean up
+// after themselves on SIGINT. On Windows it is the same as StopGraceful.
+func (m *Manager) Interrupt(timeout time.Duration) error {
+	return m.stop((*processGroup).interrupt, timeout)
+}
+
+// Kill ends the process and all its children with SIGKILL straight away,
+// including one a StopGraceful or Interrupt is still waiting for.
+func (m *Manager) Kill() error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.awaitStart()
+	if m.state == stateStopping {
+		group, exited := m.group, m.exited
+		m.mu.Unlock()
+		group.kill()
+		<-exited.done
+		return exited.err
+	}
+	m.mu.Unlock()
+
+	return m.stop((*processGroup).kill, 0)
+}
 
-	if !m.started || m.cmd == nil || m.cmd.Process == nil {
+// stop asks the process group to exit with ask, and kills it if it hasn't
+// within timeout.
+func (m *Manager) stop(ask func(*processGroup), timeout time.Duration) error {
+	m.mu.Lock()
+	m.awaitStart()
+
+	switch m.state {
+	case stateIdle:
+		m.mu.Unlock()
 		return nil
+	case stateStopping, stateStopped:
+		exited := m.exited
+		m.mu.Unlock()
+		<-exited.done
+		return exited.err
 	}
 
-	// Signal done to stop readers
+	m.state = stateStopping
+	group, done, exited := m.group, m.done, m.exited
+	m.mu.Unlock()
+
+	// Signal done to stop readers. Only the transition to stopping gets
+	// here, so it is closed exactly once.
+	close(done)
+
+	// Ask the entire process group to exit
+	ask(group)
+
 	select {
-	case <-m.done:
-		// Already closed
+	case <-exited.done:
+	case <-time.After(timeout):
+		// Didn't exit in time, kill the entire process group
+		group.kill()
+		<-exited.done
+	}
+
+	m.mu.Lock()
+	m.state = stateStopped
+	m.mu.Unlock()
+
+	return exited.err
+}
+
+// Signal sends sig to the process group of the current run, for servers
+// that reload on a signal such as SIGHUP rather than needing a restart. It
+// returns an error if no run is live.
+func (m *Manager) Signal(sig syscall.Signal) error {
+	m.mu.Lock()
+	m.awaitStart()
+	if m.state != stateRunning {
+		m.mu.Unlock()
+		return errors.New("process not running")
+	}
+	group := m.group
+	m.mu.Unlock()
+
+	return group.signal(sig)
+}
+
+// awaitStart waits, with m.mu held, for a Start in progress to finish.
+func (m *Manager) awaitStart() {
+	for m.state == stateStarting {
+		settled := m.settled
+		m.mu.Unlock()
+		<-settled
+		m.mu.Lock()
+	}
+}
+
+// ExitCode returns the exit code of the process once it has exited. It
+// returns -1 while the process is running, if it never started, or if it
+// was killed by a signal.
+func (m *Manager) ExitCode() int {
+	m.mu.Lock()
+	if m.state == stateIdle || m.state == stateStarting {
+		m.mu.Unlock()
+		return -1
+	}
+	cmd, exited := m.cmd, m.exited
+	m.mu.Unlock()
+
+	select {
+	case <-exited.done:
+		return cmd.ProcessState.ExitCode()
 	default:
-		close(m.done)
+		return -1
 	}
+}
 
-	// Kill the entire process group
-	pgid, err := syscall.Getpgid(m.cmd.Process.Pid)
-	if err == nil {
-		syscall.Kill(-pgid, syscall.SIGKILL)
+// Wait blocks until the process has exited and reports how it ended: its
+// exit code (-1 if it was killed by a signal) and the error from cmd.Wait,
+// which is non-nil for any unsuccessful exit. It doesn't stop the process.
+// Wait returns an error immediately if the process was never started.
+func (m *Manager) Wait() (exitCode int, err error) {
+	m.mu.Lock()
+	m.awaitStart()
+	if m.state == stateIdle {
+		m.mu.Unlock()
+		return -1, errors.New("process not started")
 	}
+	cmd, exited := m.cmd, m.exited
+	m.mu.Unlock()
 
-	return m.cmd.Wait()
+	<-exited.done
+	return cmd.ProcessState.ExitCode(), exited.err
 }
 
-// Output returns a channel of output lines.
+// WaitForExit returns a channel that receives the exit code of the current
+// run (-1 if it was killed by a signal) once it has ended, for whatever
+// reason, and is then closed. Before the run has started, it is the channel
+// of the run to come; after a Restart, that of the new run. Every call
+// during a run returns the same channel, so only one receiver gets the
+// code: the others find the channel closed and can ask ExitCode instead.
+func (m *Manager) WaitForExit() <-chan int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.exitCh
+}
+
+// Output returns a channel of output lines. Every run of the command writes
+// to the same channel, and it is never closed; use Exits or Wait to learn
+// when a run is over.
 func (m *Manager) Output() <-chan Line {
 	return m.output
 }
+
+// Exits returns a channel that receives an Exit whenever a run ends on its
+// own. Runs ended by Stop or Restart aren't reported. By the time an Exit is
+// sent, all of the run's output has been sent on Output. If an Exit isn't
+// taken before the next one, only the newer is kept.
+func (m *Manager) Exits() <-chan Exit {
+	return m.exits
+}
+
+// SetRunEnv sets variables to add to the environment of the runs started
+// from now on, such as what caused the next one. They are merged over the
+// current process environment, and the WithEnv variables over them.
+func (m *Manager) SetRunEnv(env map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runEnv = env
+}
+
+// SetCommand replaces the command for the runs started from now on. As
+// with NewManagerArgs, a non-nil args is run directly rather than command
+// through the shell.
+func (m *Manager) SetCommand(command string, args []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if args != nil {
+		command = strings.Join(args, " ")
+	}
+	m.command, m.args = command, args
+}
+
+// Runs returns how many times the command has been started.
+func (m *Manager) Runs() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.runs
+}
+
+// Restarts returns how many times the command has been started again after
+// its first run.
+func (m *Manager) Restarts() int {
+	return max(m.Runs()-1, 0)
+}
+
+// Pid returns the process ID of the current run, or 0 if no run is live.
+// The process leads its own process group, so this is also the group ID.
+func (m *Manager) Pid() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.runStart.IsZero() {
+		return 0
+	}
+	return m.cmd.Process.Pid
+}
+
+// StartedAt returns when the current run started, or the zero time if no
+// run is live. Every line of the run's output is read after it.
+func (m *Manager) StartedAt() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.runStart
+}
+
+// Uptime returns the total time the command has spent running, across all
+// of its runs.
+func (m *Manager) Uptime() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.runStart.IsZero() {
+		return m.uptime
+	}
+	return m.uptime + time.Since(m.runStart)
+}
+
+// closePTYs closes the pseudo-terminal masters that were opened, if any.
+func closePTYs(ptys ...*os.File) {
+	for _, p := range ptys {
+		if p != nil {
+			p.Close()
+		}
+	}
+}
+
+// mergeEnv returns base with the variables in extra added, replacing any
+// existing entries of the same name. Extra variables are appended in sorted
+// order so the result is deterministic.
+func mergeEnv(base []string, extra map[string]string) []string {
+	merged := make([]string, 0, len(base)+len(extra))
+	for _, kv := range base {
+		name, _, _ := strings.Cut(kv, "=")
+		if _, ok := extra[name]; !ok {
+			merged = append(merged, kv)
+		}
+	}
+
+	keys := make([]string, 0, len(extra))
+	for k := range extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		merged = append(merged, k+"="+extra[k])
+	}
+	return merged
+}
@@ -0,0 +1,78 @@
+package process
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestStartStopCycles restarts a Manager many times while other goroutines
+// wait on its runs, which go test -race checks for unsynchronized access
+// to the result of each run.
+func TestStartStopCycles(t *testing.T) {
+	m := NewManager(sleepCommand, time.Second)
+	if err := m.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Wait()
+			m.ExitCode()
+		}()
+		if err := m.Restart(); err != nil {
+			t.Fatalf("Restart: %v", err)
+		}
+	}
+	m.Stop()
+	wg.Wait()
+
+	if got := m.Runs(); got != 101 {
+		t.Errorf("Runs() = %d, want 101", got)
+	}
+}
+
+// TestConcurrentStartStop calls Start, Stop and Restart from many
+// goroutines at once. Whatever order they land in, every call must return,
+// and a final Stop must leave the command stopped.
+func TestConcurrentStartStop(t *testing.T) {
+	m := NewManager(sleepCommand, time.Second)
+
+	var wg sync.WaitGroup
+	for i := range 30 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch i % 3 {
+			case 0:
+				m.Start()
+			case 1:
+				m.Stop()
+			default:
+				m.Restart()
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Start, Stop and Restart didn't all return")
+	}
+
+	m.Stop()
+	m.mu.Lock()
+	state := m.state
+	m.mu.Unlock()
+	if state != stateIdle && state != stateStopped {
+		t.Errorf("state after Stop = %d, want idle or stopped", state)
+	}
+}
@@ -0,0 +1,89 @@
+//go:build !windows
+
+package process
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// shellCommand returns the command that runs command through the shell.
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("sh", "-c", command)
+}
+
+// processGroup is the process group a run's command starts, so stopping
+// the run reaches the children the shell spawned too.
+type processGroup struct {
+	pgid int // 0 if the group couldn't be looked up
+}
+
+// setGroupAttrs makes cmd start a process group of its own. With a pty,
+// it starts a new session instead, with the tty as its controlling
+// terminal; the session leader leads a new process group as well.
+func setGroupAttrs(cmd *exec.Cmd, pty bool) {
+	if pty {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+		return
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// startGroup returns the group of cmd, which has just been started.
+func startGroup(cmd *exec.Cmd) *processGroup {
+	pgid, err := syscall.Getpgid(cmd.Process.Pid)
+	if err != nil {
+		return &processGroup{}
+	}
+	return &processGroup{pgid: pgid}
+}
+
+// terminate asks every process in the group to exit with SIGTERM.
+func (g *processGroup) terminate() {
+	if g.pgid != 0 {
+		syscall.Kill(-g.pgid, syscall.SIGTERM)
+	}
+}
+
+// interrupt asks every process in the group to exit with SIGINT.
+func (g *processGroup) interrupt() {
+	if g.pgid != 0 {
+		syscall.Kill(-g.pgid, syscall.SIGINT)
+	}
+}
+
+// kill ends every process in the group with SIGKILL.
+func (g *processGroup) kill() {
+	if g.pgid != 0 {
+		syscall.Kill(-g.pgid, syscall.SIGKILL)
+	}
+}
+
+// signal sends sig to every process in the group.
+func (g *processGroup) signal(sig syscall.Signal) error {
+	if g.pgid == 0 {
+		return errors.New("process group unknown")
+	}
+	return syscall.Kill(-g.pgid, sig)
+}
+
+// release frees what the group holds once the command has been reaped.
+// Process groups need no cleanup.
+func (g *processGroup) release() {}
+
+// exitSignal names the signal that killed the process, e.g. "SIGSEGV", or
+// returns "" if it exited.
+func exitSignal(state *os.ProcessState) string {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return ""
+	}
+	if name := unix.SignalName(status.Signal()); name != "" {
+		return name
+	}
+	return status.Signal().String()
+}
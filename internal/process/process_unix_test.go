@@ -0,0 +1,144 @@
+//go:build !windows
+
+package process
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// sleepCommand runs until it is stopped, for as long as any test needs.
+const sleepCommand = "sleep 30"
+
+// startReady starts command and waits for its first line of output, by
+// which time it has set up any traps.
+func startReady(t *testing.T, command string) *Manager {
+	t.Helper()
+	m := NewManager(command, time.Second)
+	if err := m.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	select {
+	case <-m.Output():
+	case <-time.After(5 * time.Second):
+		t.Fatal("command printed nothing")
+	}
+	return m
+}
+
+func TestStopGracefulTerminates(t *testing.T) {
+	m := startReady(t, "echo ready; sleep 30")
+
+	start := time.Now()
+	m.StopGraceful(5 * time.Second)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("StopGraceful took %v for a command that exits on SIGTERM", elapsed)
+	}
+	if sig := exitSignal(m.cmd.ProcessState); sig != "SIGTERM" {
+		t.Errorf("command ended by %q, want SIGTERM", sig)
+	}
+}
+
+func TestStopGracefulEscalatesToKill(t *testing.T) {
+	// An ignored signal stays ignored across exec, so sleep ignores it too
+	m := startReady(t, "trap '' TERM; echo ready; sleep 30")
+
+	const timeout = 300 * time.Millisecond
+	start := time.Now()
+	m.StopGraceful(timeout)
+	if elapsed := time.Since(start); elapsed < timeout {
+		t.Errorf("StopGraceful returned after %v, before the %v timeout", elapsed, timeout)
+	}
+	if sig := exitSignal(m.cmd.ProcessState); sig != "SIGKILL" {
+		t.Errorf("command ended by %q, want SIGKILL", sig)
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		output  string
+	}{
+		{"echo hello", "hello\n"},
+		{`echo "a  b" 'c  d'`, "a  b c  d\n"},
+		{"echo one && echo two | tr a-z A-Z", "one\nTWO\n"},
+		{"X=1; echo $X $((X + 1))", "1 2\n"},
+	}
+	for _, tt := range tests {
+		cmd := shellCommand(tt.command)
+		if want := []string{"sh", "-c", tt.command}; !slices.Equal(cmd.Args, want) {
+			t.Errorf("shellCommand(%q).Args = %q, want %q", tt.command, cmd.Args, want)
+		}
+		if filepath.Base(cmd.Path) != "sh" {
+			t.Errorf("shellCommand(%q) runs %s, want sh", tt.command, cmd.Path)
+		}
+		out, err := cmd.Output()
+		if err != nil || string(out) != tt.output {
+			t.Errorf("shellCommand(%q) printed %q, %v; want %q", tt.command, out, err, tt.output)
+		}
+	}
+}
+
+// exitCode receives from ch, failing the test if nothing arrives in time.
+func exitCode(t *testing.T, ch <-chan int) int {
+	t.Helper()
+	select {
+	case code, ok := <-ch:
+		if !ok {
+			t.Fatal("WaitForExit channel closed without an exit code")
+		}
+		return code
+	case <-time.After(5 * time.Second):
+		t.Fatal("no exit code from WaitForExit")
+		return 0
+	}
+}
+
+func TestWaitForExit(t *testing.T) {
+	m := NewManager("sleep 0.2; exit 3", time.Second)
+	before := m.WaitForExit()
+	if err := m.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer m.Stop()
+
+	// Every call during the run, and the one before it, gets the same channel
+	ch := m.WaitForExit()
+	if ch != before || m.WaitForExit() != ch {
+		t.Fatal("WaitForExit returned different channels for the same run")
+	}
+	if got := exitCode(t, ch); got != 3 {
+		t.Errorf("exit code = %d, want 3", got)
+	}
+	if _, ok := <-ch; ok {
+		t.Error("WaitForExit channel not closed after the exit code")
+	}
+
+	// A restart gives the new run a new channel
+	m.SetCommand("exit 5", nil)
+	if err := m.Restart(); err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+	next := m.WaitForExit()
+	if next == ch {
+		t.Fatal("WaitForExit returned the old run's channel after Restart")
+	}
+	if got := exitCode(t, next); got != 5 {
+		t.Errorf("exit code after Restart = %d, want 5", got)
+	}
+
+	// A run ended by a restart reports -1 for the signal that killed it
+	m.SetCommand(sleepCommand, nil)
+	if err := m.Restart(); err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+	killed := m.WaitForExit()
+	if err := m.Restart(); err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+	if got := exitCode(t, killed); got != -1 {
+		t.Errorf("exit code of a killed run = %d, want -1", got)
+	}
+}
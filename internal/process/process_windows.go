@@ -0,0 +1,124 @@
+//go:build windows
+
+package process
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// shellCommand returns the command that runs command through cmd.exe. The
+// command line is passed as is: cmd.exe does its own parsing, which the
+// quoting os/exec applies to arguments would get in the way of.
+func shellCommand(command string) *exec.Cmd {
+	shell := os.Getenv("ComSpec")
+	if shell == "" {
+		shell = "cmd.exe"
+	}
+	cmd := exec.Command(shell)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CmdLine: `"` + shell + `" /D /S /C "` + command + `"`,
+	}
+	return cmd
+}
+
+// processGroup is the Job Object a run's command is assigned to, so
+// stopping the run reaches the children the shell spawned too. Windows has
+// no process groups that can be signalled like Unix ones.
+type processGroup struct {
+	pid int
+	job windows.Handle // 0 if the job couldn't be set up
+}
+
+// setGroupAttrs makes cmd start a console process group of its own, so a
+// Ctrl+Break can be sent to it without reaching Reflex. Pseudo-terminals
+// aren't supported on Windows, so pty is never set here.
+func setGroupAttrs(cmd *exec.Cmd, pty bool) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= windows.CREATE_NEW_PROCESS_GROUP
+}
+
+// startGroup puts cmd, which has just been started, in a new Job Object
+// that kills everything in it once closed. Children the shell spawns
+// join the job too.
+func startGroup(cmd *exec.Cmd) *processGroup {
+	g := &processGroup{pid: cmd.Process.Pid}
+
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return g
+	}
+	info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{
+		BasicLimitInformation: windows.JOBOBJECT_BASIC_LIMIT_INFORMATION{
+			LimitFlags: windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE,
+		},
+	}
+	if _, err := windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))); err != nil {
+		windows.CloseHandle(job)
+		return g
+	}
+
+	proc, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(g.pid))
+	if err != nil {
+		windows.CloseHandle(job)
+		return g
+	}
+	defer windows.CloseHandle(proc)
+	if err := windows.AssignProcessToJobObject(job, proc); err != nil {
+		windows.CloseHandle(job)
+		return g
+	}
+
+	g.job = job
+	return g
+}
+
+// terminate asks the command to exit with a Ctrl+Break, the closest thing
+// console programs have to SIGTERM.
+func (g *processGroup) terminate() {
+	windows.GenerateConsoleCtrlEvent(windows.CTRL_BREAK_EVENT, uint32(g.pid))
+}
+
+// interrupt is terminate: a Ctrl+C can't be sent to a single process group.
+func (g *processGroup) interrupt() {
+	g.terminate()
+}
+
+// kill ends every process in the job. Without a job, only the shell itself
+// can be killed.
+func (g *processGroup) kill() {
+	if g.job != 0 {
+		windows.TerminateJobObject(g.job, 1)
+		return
+	}
+	if p, err := os.FindProcess(g.pid); err == nil {
+		p.Kill()
+	}
+}
+
+// signal fails: Windows has no signals to send to a running program.
+func (g *processGroup) signal(sig syscall.Signal) error {
+	return fmt.Errorf("cannot send %v on Windows", sig)
+}
+
+// release closes the job once the command has been reaped, which also
+// ends any children it left behind.
+func (g *processGroup) release() {
+	if g.job != 0 {
+		windows.CloseHandle(g.job)
+		g.job = 0
+	}
+}
+
+// exitSignal returns "": on Windows, processes always exit with a code.
+func exitSignal(state *os.ProcessState) string {
+	return ""
+}
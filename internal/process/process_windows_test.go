@@ -0,0 +1,43 @@
+//go:build windows
+
+package process
+
+import (
+	"os"
+	"testing"
+)
+
+// sleepCommand runs until it is stopped, for as long as any test needs.
+const sleepCommand = "ping -n 30 127.0.0.1 >NUL"
+
+func TestShellCommand(t *testing.T) {
+	shell := os.Getenv("ComSpec")
+	if shell == "" {
+		t.Skip("ComSpec isn't set")
+	}
+	tests := []struct {
+		command string
+		output  string
+	}{
+		{"echo hello", "hello\r\n"},
+		{`echo "a  b"`, "\"a  b\"\r\n"},
+		{"echo one && echo two", "one \r\ntwo\r\n"},
+	}
+	for _, tt := range tests {
+		cmd := shellCommand(tt.command)
+		// The command goes to cmd.exe untouched, quotes and all
+		if want := `"` + shell + `" /D /S /C "` + tt.command + `"`; cmd.SysProcAttr.CmdLine != want {
+			t.Errorf("shellCommand(%q) command line = %s, want %s", tt.command, cmd.SysProcAttr.CmdLine, want)
+		}
+		out, err := cmd.Output()
+		if err != nil || string(out) != tt.output {
+			t.Errorf("shellCommand(%q) printed %q, %v; want %q", tt.command, out, err, tt.output)
+		}
+	}
+
+	// Without ComSpec, cmd.exe is looked up in the path
+	t.Setenv("ComSpec", "")
+	if got, want := shellCommand("ver").SysProcAttr.CmdLine, `"cmd.exe" /D /S /C "ver"`; got != want {
+		t.Errorf("command line without ComSpec = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package process
+
+import (
+	"errors"
+	"os"
+)
+
+// openPTY is only implemented on Linux; elsewhere the Manager falls back
+// to pipes.
+func openPTY() (ptmx, tty *os.File, err error) {
+	return nil, nil, errors.New("pseudo-terminals are not supported on this platform")
+}
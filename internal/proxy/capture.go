@@ -0,0 +1,174 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// DefaultCaptureLimit is the number of body bytes kept per request and
+// response when capturing.
+const DefaultCaptureLimit = 64 << 10 // 64 KB
+
+// maxReplays is how many captured requests a ReplayStore keeps.
+const maxReplays = 100
+
+// capturedRequest is what ReplayStore needs to send a request again.
+type capturedRequest struct {
+	method    string
+	url       *url.URL // Path and query, as the client sent them
+	header    http.Header
+	body      []byte
+	truncated bool // The body exceeded the capture limit
+}
+
+// ReplayStore keeps the most recent captured requests so they can be sent to
+// the upstream again, e.g. to reproduce a 500 after fixing the code.
+// It is safe for concurrent use.
+type ReplayStore struct {
+	mu       sync.Mutex
+	targets  func(path string) *url.URL // The target for a path; set by NewProxy
+	requests map[string]capturedRequest
+	order    []string // IDs, oldest first
+}
+
+// NewReplayStore creates an empty ReplayStore. Pass it to NewProxy with
+// WithCapture to fill it.
+func NewReplayStore() *ReplayStore {
+	return &ReplayStore{requests: make(map[string]capturedRequest)}
+}
+
+func (s *ReplayStore) add(id string, req capturedRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.order) == maxReplays {
+		delete(s.requests, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.requests[id] = req
+	s.order = append(s.order, id)
+}
+
+// Replay sends the captured request with the given ID to the upstream again
+// using http.DefaultClient. The response is discarded; use the process
+// output to see what happened. It fails if the request is no longer kept or
+// its body was too large to capture in full.
+func (s *ReplayStore) Replay(id string) error {
+	s.mu.Lock()
+	captured, ok := s.requests[id]
+	targets := s.targets
+	s.mu.Unlock()
+
+	if !ok || targets == nil {
+		return fmt.Errorf("no captured request %q", id)
+	}
+	if captured.truncated {
+		return fmt.Errorf("request %q: body exceeded the capture limit", id)
+	}
+
+	target := targets(captured.url.Path)
+	if target == nil {
+		return fmt.Errorf("request %q: no proxy route matches %s", id, captured.url.Path)
+	}
+	req, err := http.NewRequest(captured.method, replayURL(target, captured.url).String(), bytes.NewReader(captured.body))
+	if err != nil {
+		return err
+	}
+	req.Header = captured.header.Clone()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
+
+// replayURL returns the URL a request for u goes to at target, built the
+// way httputil.NewSingleHostReverseProxy builds it: the paths are joined and
+// the host is always the target's. Resolving u as a reference instead would
+// send a path like "//other.example/x" to another host.
+func replayURL(target, u *url.URL) *url.URL {
+	out := *target
+	out.Path, out.RawPath = joinURLPath(target, u)
+	if target.RawQuery == "" || u.RawQuery == "" {
+		out.RawQuery = target.RawQuery + u.RawQuery
+	} else {
+		out.RawQuery = target.RawQuery + "&" + u.RawQuery
+	}
+	return &out
+}
+
+// joinURLPath joins the paths of a and b with a single slash between them,
+// keeping their escaped forms when they have one. It matches the unexported
+// helper in net/http/httputil.
+func joinURLPath(a, b *url.URL) (path, rawpath string) {
+	if a.RawPath == "" && b.RawPath == "" {
+		return singleJoiningSlash(a.Path, b.Path), ""
+	}
+	apath := a.EscapedPath()
+	bpath := b.EscapedPath()
+
+	aslash := strings.HasSuffix(apath, "/")
+	bslash := strings.HasPrefix(bpath, "/")
+
+	switch {
+	case aslash && bslash:
+		return a.Path + b.Path[1:], apath + bpath[1:]
+	case !aslash && !bslash:
+		return a.Path + "/" + b.Path, apath + "/" + bpath
+	}
+	return a.Path + b.Path, apath + bpath
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+// limitedBuffer keeps the first limit bytes written to it and records
+// whether anything was dropped.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:max(room, 0)])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// Bytes returns a copy of the captured bytes, or nil if there are none.
+func (b *limitedBuffer) Bytes() []byte {
+	if b.buf.Len() == 0 {
+		return nil
+	}
+	return bytes.Clone(b.buf.Bytes())
+}
+
+// teeReadCloser copies everything read from the body into a limitedBuffer.
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func newTeeReadCloser(rc io.ReadCloser, w io.Writer) io.ReadCloser {
+	return teeReadCloser{Reader: io.TeeReader(rc, w), Closer: rc}
+}
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// startCapturingProxy serves a capturing proxy to backend and returns its
+// handler, the store it fills and the channel its request logs arrive on.
+func startCapturingProxy(t *testing.T, backend http.Handler, limit int) (*ProxyHandler, *ReplayStore, <-chan RequestLog) {
+	t.Helper()
+	target := httptest.NewServer(backend)
+	t.Cleanup(target.Close)
+	logs := make(chan RequestLog, 10)
+	store := NewReplayStore()
+	h, err := NewProxy(target.URL, logs, WithCapture(limit, store))
+	if err != nil {
+		t.Fatalf("NewProxy: %v", err)
+	}
+	return h, store, logs
+}
+
+func TestCaptureTruncatesBodies(t *testing.T) {
+	h, store, logs := startCapturingProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		io.WriteString(w, "response body")
+	}), 4)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/submit", strings.NewReader("request body")))
+	if got := rec.Body.String(); got != "response body" {
+		t.Errorf("client got %q, want the whole response", got)
+	}
+
+	rl := nextLog(t, logs)
+	if got := string(rl.RequestBody); got != "requ" {
+		t.Errorf("RequestBody = %q, want %q", got, "requ")
+	}
+	if got := string(rl.ResponseBody); got != "resp" {
+		t.Errorf("ResponseBody = %q, want %q", got, "resp")
+	}
+
+	err := store.Replay(rl.ID)
+	if err == nil || !strings.Contains(err.Error(), "capture limit") {
+		t.Errorf("Replay of a truncated body: err = %v, want a capture limit error", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	type received struct {
+		method, host, uri, body, cookie string
+	}
+	got := make(chan received, 2)
+	h, store, logs := startCapturingProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- received{r.Method, r.Host, r.URL.RequestURI(), string(body), r.Header.Get("Cookie")}
+	}), DefaultCaptureLimit)
+	backendHost := h.routes[0].target.Host
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		body    string
+		wantURI string
+	}{
+		{"post", "POST", "/api/users?page=2", `{"name":"x"}`, "/api/users?page=2"},
+		// Resolved as a reference, this path would name another host
+		{"scheme-relative path", "GET", "//evil.example/x?a=1", "", "//evil.example/x?a=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Cookie", "session=1")
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			proxied := <-got
+			rl := nextLog(t, logs)
+
+			if err := store.Replay(rl.ID); err != nil {
+				t.Fatalf("Replay: %v", err)
+			}
+			replayed := <-got
+			// The proxy passes the client's Host on; the replay uses the target's
+			proxied.host = backendHost
+			if replayed != proxied {
+				t.Errorf("replayed %+v, want it to match the proxied %+v", replayed, proxied)
+			}
+			if replayed.host != backendHost || replayed.uri != tt.wantURI {
+				t.Errorf("replay went to %s%s, want %s%s", replayed.host, replayed.uri, backendHost, tt.wantURI)
+			}
+		})
+	}
+}
+
+func TestReplayStoreEvictsOldest(t *testing.T) {
+	store := NewReplayStore()
+	for i := 1; i <= maxReplays+1; i++ {
+		store.add(strconv.Itoa(i), capturedRequest{method: "GET"})
+	}
+	if len(store.requests) != maxReplays || len(store.order) != maxReplays {
+		t.Fatalf("store keeps %d requests (%d in order), want %d", len(store.requests), len(store.order), maxReplays)
+	}
+	if _, ok := store.requests["1"]; ok {
+		t.Error("the oldest request is still kept")
+	}
+	if err := store.Replay("1"); err == nil || !strings.Contains(err.Error(), "no captured request") {
+		t.Errorf("Replay of an evicted request: err = %v", err)
+	}
+	for _, id := range []string{"2", strconv.Itoa(maxReplays + 1)} {
+		if _, ok := store.requests[id]; !ok {
+			t.Errorf("request %s was evicted", id)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultHoldTimeout is how long a request waits for the backend to come
+// back while it is restarting, before the proxy gives up with a 503.
+const DefaultHoldTimeout = 15 * time.Second
+
+// probeInterval is how often BackendUp checks whether the target accepts
+// connections yet.
+const probeInterval = 100 * time.Millisecond
+
+// backendGate holds requests while the backend is down. up is closed while
+// the backend is up and replaced with a fresh channel when it goes down.
+type backendGate struct {
+	mu  sync.Mutex
+	up  chan struct{}
+	gen int // Bumped by every change, so a stale probe knows to give up
+}
+
+func newBackendGate() *backendGate {
+	up := make(chan struct{})
+	close(up)
+	return &backendGate{up: up}
+}
+
+// isUp reports whether the backend is up, with g.mu held.
+func (g *backendGate) isUp() bool {
+	select {
+	case <-g.up:
+		return true
+	default:
+		return false
+	}
+}
+
+// WithHoldTimeout sets how long requests wait for the backend while it is
+// down. Zero or negative means DefaultHoldTimeout.
+func WithHoldTimeout(d time.Duration) Option {
+	return func(h *ProxyHandler) {
+		if d > 0 {
+			h.holdTimeout = d
+		}
+	}
+}
+
+// BackendDown tells the proxy the target is going away, e.g. because the
+// process behind it is restarting. Until BackendUp, requests are held
+// rather than failed.
+func (h *ProxyHandler) BackendDown() {
+	g := h.gate
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.gen++
+	if g.isUp() {
+		g.up = make(chan struct{})
+	}
+}
+
+// BackendUp tells the proxy the process behind the managed target has
+// started. Held requests are released once that target accepts
+// connections, or after the hold timeout if it never does. With live
+// reload, pages reload when the requests are released.
+func (h *ProxyHandler) BackendUp() {
+	g := h.gate
+	g.mu.Lock()
+	if g.isUp() {
+		g.mu.Unlock()
+		return
+	}
+	g.gen++
+	gen, up := g.gen, g.up
+	g.mu.Unlock()
+
+	go func() {
+		deadline := time.Now().Add(h.holdTimeout)
+		for {
+			err := h.probe()
+			if err == nil || time.Now().After(deadline) {
+				g.mu.Lock()
+				current := g.gen == gen
+				if current {
+					close(up)
+				}
+				g.mu.Unlock()
+				if current && h.reloads != nil {
+					h.reloads.broadcast()
+				}
+				return
+			}
+
+			time.Sleep(probeInterval)
+			g.mu.Lock()
+			stale := g.gen != gen
+			g.mu.Unlock()
+			if stale {
+				return
+			}
+		}
+	}()
+}
+
+// probe checks that the managed target accepts connections. The other
+// targets are up or down regardless of restarts, so they aren't waited for.
+func (h *ProxyHandler) probe() error {
+	conn, err := net.DialTimeout("tcp", targetAddr(h.managed), probeInterval)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// waitForBackend blocks while the backend is down. It reports false if the
+// backend didn't come back within the hold timeout or the request was
+// cancelled first.
+func (h *ProxyHandler) waitForBackend(ctx context.Context) bool {
+	h.gate.mu.Lock()
+	up := h.gate.up
+	h.gate.mu.Unlock()
+
+	select {
+	case <-up:
+		return true
+	default:
+	}
+
+	timeout := time.NewTimer(h.holdTimeout)
+	defer timeout.Stop()
+	select {
+	case <-up:
+		return true
+	case <-timeout.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// restartingPage is served when the backend stays down past the hold
+// timeout. It reloads itself so the page recovers once the server is back.
+const restartingPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="2">
+<title>Restarting…</title>
+<style>body{font-family:system-ui,sans-serif;margin:4rem auto;max-width:32rem;color:#333}</style>
+</head>
+<body>
+<h1>⚡ Restarting…</h1>
+<p>Reflex is restarting the dev server and it isn't accepting requests yet.
+This page reloads automatically.</p>
+</body>
+</html>
+`
+
+// serveRestarting answers a request that timed out waiting for the backend.
+func serveRestarting(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Retry-After", "2")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte(restartingPage))
+}
@@ -0,0 +1,166 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newHoldingProxy creates a proxy to a backend answering "ok" that holds
+// requests for up to holdTimeout, and returns it with its request logs.
+func newHoldingProxy(t *testing.T, holdTimeout time.Duration) (*ProxyHandler, <-chan RequestLog) {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(backend.Close)
+	logs := make(chan RequestLog, 10)
+	h, err := NewProxy(backend.URL, logs, WithHoldTimeout(holdTimeout))
+	if err != nil {
+		t.Fatalf("NewProxy: %v", err)
+	}
+	return h, logs
+}
+
+func TestHoldWhileBackendDown(t *testing.T) {
+	h, logs := newHoldingProxy(t, 5*time.Second)
+	h.BackendDown()
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		done <- rec
+	}()
+
+	const held = 200 * time.Millisecond
+	select {
+	case <-done:
+		t.Fatal("request answered while the backend was down")
+	case <-time.After(held):
+	}
+
+	h.BackendUp()
+	var rec *httptest.ResponseRecorder
+	select {
+	case rec = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request still held after BackendUp")
+	}
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Errorf("got %d %q, want the backend's 200 ok", rec.Code, rec.Body)
+	}
+
+	rl := nextLog(t, logs)
+	if rl.StatusCode != http.StatusOK {
+		t.Errorf("logged status %d, want %d", rl.StatusCode, http.StatusOK)
+	}
+	if rl.Duration < held {
+		t.Errorf("logged duration %v, want at least the %v spent held", rl.Duration, held)
+	}
+}
+
+func TestHoldTimeout(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	h, logs := newHoldingProxy(t, timeout)
+	h.BackendDown()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want %q", got, "2")
+	}
+	if rec.Body.String() != restartingPage {
+		t.Errorf("body %q, want the restarting page", rec.Body)
+	}
+
+	rl := nextLog(t, logs)
+	if rl.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("logged status %d, want %d", rl.StatusCode, http.StatusServiceUnavailable)
+	}
+	if rl.Duration < timeout {
+		t.Errorf("logged duration %v, want at least the %v hold timeout", rl.Duration, timeout)
+	}
+
+	// Once the backend is back, requests go straight through again
+	h.BackendUp()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		if rec.Code == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status %d after BackendUp, want %d", rec.Code, http.StatusOK)
+		}
+	}
+}
+
+func TestHoldOnlyManagedTarget(t *testing.T) {
+	managed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer managed.Close()
+	// An unmanaged service that isn't running
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	h, err := NewMultiProxy([]RouteRule{
+		{Prefix: "/", Target: managed.URL},
+		{Prefix: "/api/", Target: down.URL},
+	}, make(chan RequestLog, 10), WithHoldTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("NewMultiProxy: %v", err)
+	}
+	h.BackendDown()
+
+	// Requests for the other target aren't held
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/api/users", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("status %d for the unmanaged target, want %d", rec.Code, http.StatusBadGateway)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("request for the unmanaged target took %v", elapsed)
+	}
+
+	// and don't keep the managed target's requests waiting once it is up
+	h.BackendUp()
+	start = time.Now()
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status %d for the managed target, want %d", rec.Code, http.StatusOK)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("request for the managed target was held %v", elapsed)
+	}
+}
+
+func TestReloadAfterHoldTimeout(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	h, err := NewProxy(down.URL, make(chan RequestLog, 10), WithHoldTimeout(100*time.Millisecond), WithLiveReload())
+	if err != nil {
+		t.Fatalf("NewProxy: %v", err)
+	}
+	reloads := h.reloads.subscribe()
+
+	// The target never comes back, but pages still reload once requests
+	// are let through
+	h.BackendDown()
+	h.BackendUp()
+	select {
+	case <-reloads:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload after the hold timeout")
+	}
+}
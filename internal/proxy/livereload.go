@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// LiveReloadPath is where the proxy serves the event stream that tells
+// pages to reload. Requests to it never reach the target.
+const LiveReloadPath = "/__reflex/events"
+
+// liveReloadScript is injected into HTML pages. It listens on the event
+// stream and reloads the page when told to; EventSource reconnects on its
+// own if the stream drops.
+const liveReloadScript = `<script>(function(){` +
+	`var s=new EventSource("` + LiveReloadPath + `");` +
+	`s.addEventListener("reload",function(){location.reload()});` +
+	`})();</script>`
+
+// WithLiveReload injects a script into HTML responses that reloads the
+// page each time the backend comes back up after a restart.
+func WithLiveReload() Option {
+	return func(h *ProxyHandler) {
+		h.reloads = &reloadHub{}
+	}
+}
+
+// reloadHub tracks the pages listening for reloads.
+type reloadHub struct {
+	mu      sync.Mutex
+	clients map[chan struct{}]bool
+}
+
+func (b *reloadHub) subscribe() chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.clients == nil {
+		b.clients = make(map[chan struct{}]bool)
+	}
+	ch := make(chan struct{}, 1)
+	b.clients[ch] = true
+	return ch
+}
+
+func (b *reloadHub) unsubscribe(ch chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.clients, ch)
+}
+
+// broadcast tells every listening page to reload. It never blocks; a page
+// that hasn't taken the last reload yet doesn't need another.
+func (b *reloadHub) broadcast() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.clients {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// serveReloadEvents streams a "reload" Server-Sent Event to the page each
+// time the backend comes back up, until the page goes away.
+func (h *ProxyHandler) serveReloadEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ch := h.reloads.subscribe()
+	defer h.reloads.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-ch:
+			fmt.Fprint(w, "event: reload\ndata: {}\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// injectReloadScript adds liveReloadScript to HTML responses, before
+// </body> or at the end if there is none. Compressed bodies are decoded
+// and sent on uncompressed. Other content types, and encodings other than
+// gzip and deflate, pass through untouched.
+func injectReloadScript(resp *http.Response) error {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" || resp.Request.Method == http.MethodHead {
+		return nil
+	}
+	if resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	switch encoding {
+	case "", "identity", "gzip", "deflate":
+	default:
+		return nil
+	}
+
+	raw, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	body, err := decodeBody(raw, encoding)
+	if err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", encoding, err)
+	}
+
+	var b bytes.Buffer
+	b.Grow(len(body) + len(liveReloadScript))
+	if i := lastIndexFold(body, "</body>"); i >= 0 {
+		b.Write(body[:i])
+		b.WriteString(liveReloadScript)
+		b.Write(body[i:])
+	} else {
+		b.Write(body)
+		b.WriteString(liveReloadScript)
+	}
+
+	resp.Body = io.NopCloser(&b)
+	resp.ContentLength = int64(b.Len())
+	resp.Header.Set("Content-Length", strconv.Itoa(b.Len()))
+	resp.Header.Del("Content-Encoding")
+	return nil
+}
+
+// decodeBody decompresses a response body sent with encoding. Servers
+// disagree on whether deflate means zlib-wrapped or raw, so both are tried.
+func decodeBody(raw []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case "gzip":
+		r, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	case "deflate":
+		if r, err := zlib.NewReader(bytes.NewReader(raw)); err == nil {
+			if body, err := io.ReadAll(r); err == nil {
+				return body, nil
+			}
+		}
+		return io.ReadAll(flate.NewReader(bytes.NewReader(raw)))
+	}
+	return raw, nil
+}
+
+// lastIndexFold is bytes.LastIndex ignoring ASCII case. Unlike searching
+// bytes.ToLower(s), the index is always valid in s.
+func lastIndexFold(s []byte, substr string) int {
+	sub := []byte(substr)
+	for i := len(s) - len(sub); i >= 0; i-- {
+		if bytes.EqualFold(s[i:i+len(sub)], sub) {
+			return i
+		}
+	}
+	return -1
+}
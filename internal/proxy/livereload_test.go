@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// compress encodes body as a server sending it with encoding would.
+func compress(t *testing.T, body, encoding string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&b)
+	case "deflate":
+		w = zlib.NewWriter(&b)
+	case "raw deflate":
+		w, _ = flate.NewWriter(&b, flate.DefaultCompression)
+	default:
+		return []byte(body)
+	}
+	io.WriteString(w, body)
+	w.Close()
+	return b.Bytes()
+}
+
+func TestInjectReloadScript(t *testing.T) {
+	const page = "<html><BODY><p>hi</p></BODY></html>"
+	injected := "<html><BODY><p>hi</p>" + liveReloadScript + "</BODY></html>"
+
+	tests := []struct {
+		name        string
+		method      string
+		status      int
+		contentType string
+		encoding    string // Content-Encoding sent; "raw deflate" is deflate without the zlib wrapper
+		body        string
+		want        string // Body the client gets, decoded; empty if it is the one sent
+	}{
+		{"html", "GET", 200, "text/html; charset=utf-8", "", page, injected},
+		{"no body tag", "GET", 200, "text/html", "", "<p>hi</p>", "<p>hi</p>" + liveReloadScript},
+		{"last body tag", "GET", 200, "text/html", "", "<body>a</body>b</body>", "<body>a</body>b" + liveReloadScript + "</body>"},
+		{"gzip", "GET", 200, "text/html", "gzip", page, injected},
+		{"deflate", "GET", 200, "text/html", "deflate", page, injected},
+		{"raw deflate", "GET", 200, "text/html", "raw deflate", page, injected},
+		{"error page", "GET", 500, "text/html", "", page, injected},
+		{"not html", "GET", 200, "application/json", "", `{"a":"</body>"}`, ""},
+		{"other encoding", "GET", 200, "text/html", "br", page, ""},
+		{"head", "HEAD", 200, "text/html", "", page, ""},
+		{"not modified", "GET", 304, "text/html", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent := compress(t, tt.body, tt.encoding)
+			encoding := tt.encoding
+			if encoding == "raw deflate" {
+				encoding = "deflate"
+			}
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				if encoding != "" {
+					w.Header().Set("Content-Encoding", encoding)
+				}
+				if tt.status != http.StatusNotModified {
+					w.Header().Set("Content-Length", strconv.Itoa(len(sent)))
+				}
+				w.WriteHeader(tt.status)
+				w.Write(sent)
+			}))
+			defer backend.Close()
+			h, err := NewProxy(backend.URL, make(chan RequestLog, 1), WithLiveReload())
+			if err != nil {
+				t.Fatalf("NewProxy: %v", err)
+			}
+			srv := httptest.NewServer(h)
+			defer srv.Close()
+
+			req, _ := http.NewRequest(tt.method, srv.URL+"/", nil)
+			client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			got, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != tt.status {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.want == "" {
+				// Untouched: the body, encoding and length as the backend sent them
+				wantBody := sent
+				if tt.method == http.MethodHead {
+					wantBody = nil
+				}
+				if !bytes.Equal(got, wantBody) {
+					t.Errorf("body %q, want it untouched: %q", got, wantBody)
+				}
+				if ce := resp.Header.Get("Content-Encoding"); ce != encoding {
+					t.Errorf("Content-Encoding %q, want %q", ce, encoding)
+				}
+				if tt.status != http.StatusNotModified && resp.ContentLength != int64(len(sent)) {
+					t.Errorf("Content-Length %d, want %d", resp.ContentLength, len(sent))
+				}
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("body %q, want %q", got, tt.want)
+			}
+			if ce := resp.Header.Get("Content-Encoding"); ce != "" {
+				t.Errorf("Content-Encoding %q, want none", ce)
+			}
+			if resp.ContentLength != int64(len(tt.want)) {
+				t.Errorf("Content-Length %d, want %d", resp.ContentLength, len(tt.want))
+			}
+		})
+	}
+}
+
+// TestInjectReloadScriptNoBody covers the statuses that have no body, whose
+// responses a server cleans up on the way out whatever the proxy does.
+func TestInjectReloadScriptNoBody(t *testing.T) {
+	for _, status := range []int{http.StatusNoContent, http.StatusNotModified} {
+		body := io.NopCloser(bytes.NewReader(nil))
+		resp := &http.Response{
+			StatusCode: status,
+			Header:     http.Header{"Content-Type": {"text/html"}},
+			Body:       body,
+			Request:    httptest.NewRequest("GET", "/", nil),
+		}
+		if err := injectReloadScript(resp); err != nil {
+			t.Fatalf("status %d: %v", status, err)
+		}
+		if resp.Body != body || resp.Header.Get("Content-Length") != "" {
+			t.Errorf("status %d: response changed", status)
+		}
+	}
+}
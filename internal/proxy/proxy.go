@@ -1,91 +1,364 @@
 package proxy
 
 import (
-	"log"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
+
+	"github.com/Codimow/Reflex/internal/logging"
+	"github.com/charmbracelet/lipgloss"
 )
 
 // RequestLog captures metadata about a proxied HTTP request.
 type RequestLog struct {
-	ID         string        `json:"id"` // Optional: could be useful for correlation
+	ID         string        `json:"id"`                 // Sequence number, used to replay captured requests
+	Protocol   string        `json:"protocol,omitempty"` // "ws" for WebSocket connections, timed until they close; empty for plain HTTP
 	Method     string        `json:"method"`
 	Path       string        `json:"path"`
 	StatusCode int           `json:"status_code"`
 	Duration   time.Duration `json:"duration"`
 	Timestamp  time.Time     `json:"timestamp"`
+
+	// Bodies are only set when capturing (see WithCapture), truncated to
+	// the capture limit.
+	RequestBody  []byte `json:"request_body,omitempty"`
+	ResponseBody []byte `json:"response_body,omitempty"`
+
+	// Also only set when capturing: the rest of the exchange, with the
+	// headers as the client sent and received them.
+	Query          string      `json:"query,omitempty"` // Raw query string, without the "?"
+	Proto          string      `json:"proto,omitempty"` // e.g. "HTTP/1.1"
+	RequestHeader  http.Header `json:"request_header,omitempty"`
+	ResponseHeader http.Header `json:"response_header,omitempty"`
+}
+
+// Colors of request log lines, by the class of their status code.
+var (
+	successStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("#04B575"))
+	redirectStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFCC00"))
+	clientErrorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF9F43"))
+	serverErrorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF5555"))
+)
+
+// statusStyle colors a response status: green for success, yellow for
+// redirects, orange for client errors and red for server errors.
+func statusStyle(code int) lipgloss.Style {
+	switch {
+	case code >= 500:
+		return serverErrorStyle
+	case code >= 400:
+		return clientErrorStyle
+	case code >= 300:
+		return redirectStyle
+	default:
+		return successStyle
+	}
+}
+
+// FormatLog renders rl as a single line: time, ID, method, status code,
+// latency and path, in aligned columns, colored by the status code with
+// ANSI escapes where the terminal supports them. WebSocket connections
+// show "WS" in place of the method.
+func FormatLog(rl RequestLog) string {
+	method := rl.Method
+	if rl.Protocol != "" {
+		method = strings.ToUpper(rl.Protocol)
+	}
+	return statusStyle(rl.StatusCode).Render(fmt.Sprintf("%s #%-4s %-7s %3d %8s %s",
+		rl.Timestamp.Format("15:04:05"),
+		rl.ID,
+		method,
+		rl.StatusCode,
+		rl.Duration.Round(time.Millisecond),
+		rl.Path,
+	))
+}
+
+// RouteRule forwards the requests whose path starts with Prefix to Target.
+type RouteRule struct {
+	Prefix string // e.g. "/api/"; "/" matches every path
+	Target string // URL to forward to, e.g. "http://localhost:8080"
+}
+
+// route is a RouteRule with the handlers that forward to its target.
+type route struct {
+	prefix  string
+	target  *url.URL
+	proxy   *httputil.ReverseProxy
+	ws      *websocketHandler
+	managed bool // Goes to the managed target, so it waits while that restarts
 }
 
 // ProxyHandler wraps the reverse proxy and captures request logs.
 type ProxyHandler struct {
-	proxy   *httputil.ReverseProxy
+	routes  []route  // Longest prefix first
+	managed *url.URL // Target of the first route, whose process BackendDown and BackendUp are about
 	logChan chan<- RequestLog
+	nextID  atomic.Uint64
+
+	captureLimit int          // Body bytes to capture; 0 disables capturing
+	replays      *ReplayStore // Where captured requests are kept
+
+	gate        *backendGate  // Holds requests while the backend restarts
+	holdTimeout time.Duration // How long a request is held at most
+
+	reloads *reloadHub // Pages to reload when the backend is back; nil unless live reloading
+}
+
+// Option configures optional ProxyHandler behaviour.
+type Option func(*ProxyHandler)
+
+// WithCapture records up to limit bytes of each request and response body
+// in the request log, and keeps captured requests in store for Replay.
+func WithCapture(limit int, store *ReplayStore) Option {
+	return func(h *ProxyHandler) {
+		h.captureLimit = limit
+		h.replays = store
+	}
 }
 
 // NewProxy creates a new reverse proxy that forwards requests to targetURL
 // and emits request logs to the provided channel.
-func NewProxy(targetURL string, logChan chan<- RequestLog) (*ProxyHandler, error) {
-	parsedURL, err := url.Parse(targetURL)
-	if err != nil {
-		return nil, err
+func NewProxy(targetURL string, logChan chan<- RequestLog, opts ...Option) (*ProxyHandler, error) {
+	return NewMultiProxy([]RouteRule{{Prefix: "/", Target: targetURL}}, logChan, opts...)
+}
+
+// NewMultiProxy creates a reverse proxy that forwards each request to the
+// target of the route with the longest prefix of its path, and emits
+// request logs to the provided channel. The path is passed on as it is,
+// prefix and all. Requests no route matches get a 404.
+// The first route's target is the managed one, served by the process
+// Reflex restarts: BackendDown and BackendUp only hold requests to it.
+func NewMultiProxy(routes []RouteRule, logChan chan<- RequestLog, opts ...Option) (*ProxyHandler, error) {
+	if len(routes) == 0 {
+		return nil, errors.New("no proxy routes")
 	}
+	h := &ProxyHandler{
+		logChan: logChan,
 
-	proxy := httputil.NewSingleHostReverseProxy(parsedURL)
+		gate:        newBackendGate(),
+		holdTimeout: DefaultHoldTimeout,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	seen := make(map[string]bool)
+	for _, rule := range routes {
+		if !strings.HasPrefix(rule.Prefix, "/") {
+			return nil, fmt.Errorf("route prefix %q must start with /", rule.Prefix)
+		}
+		if seen[rule.Prefix] {
+			return nil, fmt.Errorf("more than one route for %q", rule.Prefix)
+		}
+		seen[rule.Prefix] = true
+		target, err := url.Parse(rule.Target)
+		if err != nil {
+			return nil, err
+		}
+		if h.managed == nil {
+			h.managed = target
+		}
+		h.routes = append(h.routes, route{
+			prefix:  rule.Prefix,
+			target:  target,
+			proxy:   h.newReverseProxy(target),
+			ws:      &websocketHandler{target: target},
+			managed: targetAddr(target) == targetAddr(h.managed),
+		})
+	}
+	sort.SliceStable(h.routes, func(i, j int) bool {
+		return len(h.routes[i].prefix) > len(h.routes[j].prefix)
+	})
+
+	if h.replays != nil {
+		h.replays.mu.Lock()
+		h.replays.targets = h.targetFor
+		h.replays.mu.Unlock()
+	}
+	return h, nil
+}
+
+// newReverseProxy creates the reverse proxy that forwards to target.
+func (h *ProxyHandler) newReverseProxy(target *url.URL) *httputil.ReverseProxy {
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = retryTransport{base: http.DefaultTransport}
 
 	// Optional: Custom ErrorHandler to capture proxy errors (e.g., target down)
 	originalErrorHandler := proxy.ErrorHandler
 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-		log.Printf("Proxy error: %v", err)
+		logging.Printf("Proxy error: %v", err)
 		if originalErrorHandler != nil {
 			originalErrorHandler(w, r, err)
 		} else {
 			w.WriteHeader(http.StatusBadGateway)
 		}
 	}
+	if h.reloads != nil {
+		proxy.ModifyResponse = injectReloadScript
+	}
+	return proxy
+}
 
-	return &ProxyHandler{
-		proxy:   proxy,
-		logChan: logChan,
-	}, nil
+// match returns the route for path, or nil if none matches it.
+func (h *ProxyHandler) match(path string) *route {
+	for i := range h.routes {
+		if strings.HasPrefix(path, h.routes[i].prefix) {
+			return &h.routes[i]
+		}
+	}
+	return nil
+}
+
+// targetFor returns the target a request for path goes to, or nil if no
+// route matches it.
+func (h *ProxyHandler) targetFor(path string) *url.URL {
+	if rt := h.match(path); rt != nil {
+		return rt.target
+	}
+	return nil
 }
 
 // ServeHTTP implements the http.Handler interface.
 func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
+	// The live reload stream is served by the proxy itself, and stays up
+	// while the backend restarts
+	if h.reloads != nil && r.URL.Path == LiveReloadPath {
+		h.serveReloadEvents(w, r)
+		return
+	}
+
+	id := strconv.FormatUint(h.nextID.Add(1), 10)
+
+	rt := h.match(r.URL.Path)
+	if rt == nil {
+		http.NotFound(w, r)
+		h.emit(RequestLog{
+			ID:         id,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			StatusCode: http.StatusNotFound,
+			Duration:   time.Since(start),
+			Timestamp:  start,
+		})
+		return
+	}
+
+	// While the backend restarts, hold the request until it is back. The
+	// logged duration includes the wait. Other targets aren't held up.
+	if rt.managed && !h.waitForBackend(r.Context()) {
+		serveRestarting(w)
+		h.emit(RequestLog{
+			ID:         id,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			StatusCode: http.StatusServiceUnavailable,
+			Duration:   time.Since(start),
+			Timestamp:  start,
+		})
+		return
+	}
+
+	// WebSocket upgrades bypass the reverse proxy. They are logged once the
+	// connection closes, so the duration is how long it was open.
+	if isWebSocket(r) {
+		status := rt.ws.serve(w, r)
+		h.emit(RequestLog{
+			ID:         id,
+			Protocol:   "ws",
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			StatusCode: status,
+			Duration:   time.Since(start),
+			Timestamp:  start,
+		})
+		return
+	}
+
 	// Wrap the ResponseWriter to capture the status code
 	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
 
+	// Copy bodies as they stream through, keeping the request's headers
+	// before the reverse proxy rewrites them
+	var reqBody, respBody *limitedBuffer
+	var header http.Header
+	if h.captureLimit > 0 {
+		reqBody = &limitedBuffer{limit: h.captureLimit}
+		respBody = &limitedBuffer{limit: h.captureLimit}
+		header = r.Header.Clone()
+		if r.Body != nil {
+			r.Body = newTeeReadCloser(r.Body, reqBody)
+		}
+		sw.capture = respBody
+	}
+
 	// Forward the request
-	h.proxy.ServeHTTP(sw, r)
+	rt.proxy.ServeHTTP(sw, r)
 
 	duration := time.Since(start)
 
 	// Create and emit the log
 	reqLog := RequestLog{
+		ID:         id,
 		Method:     r.Method,
 		Path:       r.URL.Path,
 		StatusCode: sw.status,
 		Duration:   duration,
 		Timestamp:  start,
 	}
+	if h.captureLimit > 0 {
+		reqLog.RequestBody = reqBody.Bytes()
+		reqLog.ResponseBody = respBody.Bytes()
+		reqLog.Query = r.URL.RawQuery
+		reqLog.Proto = r.Proto
+		reqLog.RequestHeader = header
+		reqLog.ResponseHeader = w.Header().Clone()
+		if h.replays != nil {
+			h.replays.add(id, capturedRequest{
+				method:    r.Method,
+				url:       &url.URL{Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery},
+				header:    header,
+				body:      reqLog.RequestBody,
+				truncated: reqBody.truncated,
+			})
+		}
+	}
 
-	// Non-blocking send to avoid holding up the request if the consumer is slow
+	h.emit(reqLog)
+}
+
+// emit sends a request log without blocking, so a slow consumer never holds
+// up a request.
+func (h *ProxyHandler) emit(reqLog RequestLog) {
 	select {
 	case h.logChan <- reqLog:
 	default:
 		// Channel is full or no one is listening; drop the log or handle accordingly
-		// log.Println("Warning: RequestLog channel full, dropping log")
+		// logging.Println("Warning: RequestLog channel full, dropping log")
 	}
 }
 
 // statusWriter is a wrapper around http.ResponseWriter to capture the status code.
+// It passes Flush, Hijack and ReadFrom through to the underlying writer, so
+// Server-Sent Events stream as they are written and other protocol upgrades
+// still work through the reverse proxy.
 type statusWriter struct {
 	http.ResponseWriter
-	status int
-	wrote  bool
+	status  int
+	wrote   bool
+	capture *limitedBuffer // Receives a copy of the body when capturing
 }
 
 func (w *statusWriter) WriteHeader(code int) {
@@ -100,5 +373,57 @@ func (w *statusWriter) Write(b []byte) (int, error) {
 	if !w.wrote {
 		w.WriteHeader(http.StatusOK)
 	}
+	if w.capture != nil {
+		w.capture.Write(b)
+	}
 	return w.ResponseWriter.Write(b)
 }
+
+// Flush sends buffered data to the client, which keeps Server-Sent Events
+// flowing rather than held back until the response ends.
+func (w *statusWriter) Flush() {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hands the connection over for a protocol upgrade. The reverse
+// proxy only hijacks once the target has switched protocols, so that is the
+// status recorded.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("proxy: %T does not support hijacking", w.ResponseWriter)
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.status = http.StatusSwitchingProtocols
+		w.wrote = true
+	}
+	return conn, rw, err
+}
+
+// ReadFrom lets the underlying writer copy straight from r when it can.
+// While capturing, the body goes through Write so it is copied too.
+func (w *statusWriter) ReadFrom(r io.Reader) (int64, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok && w.capture == nil {
+		return rf.ReadFrom(r)
+	}
+	return io.Copy(writerOnly{w}, r)
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// writerOnly hides a writer's ReadFrom, so io.Copy into it uses Write.
+type writerOnly struct {
+	io.Writer
+}
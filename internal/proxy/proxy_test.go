@@ -0,0 +1,207 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+func TestFormatLog(t *testing.T) {
+	at := time.Date(2024, 5, 1, 14, 3, 9, 0, time.Local)
+	tests := []struct {
+		name string
+		rl   RequestLog
+		want string
+	}{
+		{
+			"request",
+			RequestLog{ID: "12", Method: "GET", Path: "/api/users?page=2", StatusCode: 200, Duration: 12345 * time.Microsecond, Timestamp: at},
+			"14:03:09 #12   GET     200     12ms /api/users?page=2",
+		},
+		{
+			"websocket",
+			RequestLog{ID: "3", Protocol: "ws", Method: "GET", Path: "/socket", StatusCode: 101, Duration: 90 * time.Second, Timestamp: at},
+			"14:03:09 #3    WS      101    1m30s /socket",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatLog(tt.rl); got != tt.want {
+				t.Errorf("FormatLog() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatusStyle(t *testing.T) {
+	tests := []struct {
+		code int
+		want lipgloss.Style
+	}{
+		{101, successStyle},
+		{200, successStyle},
+		{299, successStyle},
+		{300, redirectStyle},
+		{399, redirectStyle},
+		{400, clientErrorStyle},
+		{499, clientErrorStyle},
+		{500, serverErrorStyle},
+		{503, serverErrorStyle},
+	}
+	for _, tt := range tests {
+		if got := statusStyle(tt.code); got.GetForeground() != tt.want.GetForeground() {
+			t.Errorf("statusStyle(%d) = %v, want %v", tt.code, got.GetForeground(), tt.want.GetForeground())
+		}
+	}
+}
+
+// startProxy serves a proxy to backend and returns its address and the
+// channel its request logs arrive on.
+func startProxy(t *testing.T, backend http.Handler) (string, <-chan RequestLog) {
+	t.Helper()
+	target := httptest.NewServer(backend)
+	t.Cleanup(target.Close)
+	logs := make(chan RequestLog, 10)
+	h, err := NewProxy(target.URL, logs)
+	if err != nil {
+		t.Fatalf("NewProxy: %v", err)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://"), logs
+}
+
+// echoUpgrade switches the connection to protocol and echoes what it
+// receives until the client hangs up.
+func echoUpgrade(protocol string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: %s\r\nConnection: Upgrade\r\n\r\n", protocol)
+		rw.Flush()
+		io.Copy(conn, rw)
+	}
+}
+
+// nextLog returns the next request log, failing the test if none arrives
+// in time.
+func nextLog(t *testing.T, logs <-chan RequestLog) RequestLog {
+	t.Helper()
+	select {
+	case rl := <-logs:
+		return rl
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a request log")
+		return RequestLog{}
+	}
+}
+
+func TestProxyUpgrade(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol string
+		header   string // Extra handshake headers
+		logged   string // Protocol of the request log
+	}{
+		// Proxied over a raw connection by websocketHandler
+		{"websocket", "websocket", "Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n", "ws"},
+		// Proxied by the reverse proxy, which hijacks through statusWriter
+		{"other protocol", "echo", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, logs := startProxy(t, echoUpgrade(tt.protocol))
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			fmt.Fprintf(conn, "GET /socket HTTP/1.1\r\nHost: %s\r\nUpgrade: %s\r\nConnection: Upgrade\r\n%s\r\n", addr, tt.protocol, tt.header)
+			br := bufio.NewReader(conn)
+			resp, err := http.ReadResponse(br, nil)
+			if err != nil {
+				t.Fatalf("reading the handshake: %v", err)
+			}
+			if resp.StatusCode != http.StatusSwitchingProtocols {
+				t.Fatalf("handshake status %d, want %d", resp.StatusCode, http.StatusSwitchingProtocols)
+			}
+
+			for _, msg := range []string{"hello\n", "again\n"} {
+				io.WriteString(conn, msg)
+				got, err := br.ReadString('\n')
+				if err != nil || got != msg {
+					t.Fatalf("echo of %q = %q, %v", msg, got, err)
+				}
+			}
+
+			conn.Close()
+			rl := nextLog(t, logs)
+			if rl.StatusCode != http.StatusSwitchingProtocols || rl.Protocol != tt.logged || rl.Path != "/socket" {
+				t.Errorf("logged %+v, want status 101 and protocol %q for /socket", rl, tt.logged)
+			}
+		})
+	}
+}
+
+func TestProxyStreamsEvents(t *testing.T) {
+	release := make(chan struct{})
+	addr, logs := startProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		// Hold the response open until the client has the first event
+		select {
+		case <-release:
+			fmt.Fprint(w, "data: second\n\n")
+		case <-r.Context().Done():
+		}
+	}))
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get("http://" + addr + "/events")
+	if err != nil {
+		t.Fatalf("the headers and first event were held back: %v", err)
+	}
+	defer resp.Body.Close()
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			if sc.Text() != "" {
+				lines <- sc.Text()
+			}
+		}
+	}()
+	select {
+	case got := <-lines:
+		if got != "data: first" {
+			t.Fatalf("first event %q, want %q", got, "data: first")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the first event was held back until the response ended")
+	}
+	close(release)
+	if got := <-lines; got != "data: second" {
+		t.Errorf("second event %q, want %q", got, "data: second")
+	}
+
+	if rl := nextLog(t, logs); rl.StatusCode != http.StatusOK || rl.Path != "/events" {
+		t.Errorf("logged %+v, want status 200 for /events", rl)
+	}
+}
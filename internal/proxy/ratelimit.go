@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// limiterIdle is how long a client's limiter is kept after its last
+// request. By then it has almost always refilled, so forgetting it changes
+// nothing.
+const limiterIdle = time.Minute
+
+// client is the limiter for one client IP address.
+type client struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// ipLimiters keeps a rate.Limiter per client IP address. Limiters of
+// clients that have gone quiet are dropped as later requests come in, so
+// no goroutine has to be stopped.
+type ipLimiters struct {
+	limit rate.Limit
+	burst int
+
+	mu        sync.Mutex
+	clients   map[string]*client
+	lastPrune time.Time
+}
+
+// get returns the limiter for ip, seen at now, creating it if need be.
+func (l *ipLimiters) get(ip string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastPrune) >= limiterIdle {
+		for k, c := range l.clients {
+			if now.Sub(c.lastSeen) >= limiterIdle {
+				delete(l.clients, k)
+			}
+		}
+		l.lastPrune = now
+	}
+	c, ok := l.clients[ip]
+	if !ok {
+		c = &client{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[ip] = c
+	}
+	c.lastSeen = now
+	return c.limiter
+}
+
+// RateLimitMiddleware limits each client IP address to requestsPerSecond
+// requests a second on average, with bursts of up to burst requests; burst
+// is at least 1. Requests over the limit get a 429 Too Many Requests.
+func RateLimitMiddleware(requestsPerSecond float64, burst int) func(http.Handler) http.Handler {
+	limiters := &ipLimiters{
+		limit:     rate.Limit(requestsPerSecond),
+		burst:     max(burst, 1),
+		clients:   make(map[string]*client),
+		lastPrune: time.Now(),
+	}
+
+	// A request's wait for the next token, for Retry-After
+	retryAfter := strconv.Itoa(max(1, int(1/requestsPerSecond+0.5)))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				ip = r.RemoteAddr
+			}
+			if !limiters.get(ip, time.Now()).Allow() {
+				w.Header().Set("Retry-After", retryAfter)
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	const burst = 5
+	handler := RateLimitMiddleware(0.5, burst)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	get := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := range burst {
+		if w := get("10.0.0.1:1234"); w.Code != http.StatusNoContent {
+			t.Fatalf("request %d of the burst: status %d, want %d", i+1, w.Code, http.StatusNoContent)
+		}
+	}
+	w := get("10.0.0.1:5678") // Another connection from the same client
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request past the burst: status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want %q", got, "2")
+	}
+
+	if w := get("10.0.0.2:1234"); w.Code != http.StatusNoContent {
+		t.Errorf("request from another client: status %d, want %d", w.Code, http.StatusNoContent)
+	}
+}
+
+func TestIPLimitersPrune(t *testing.T) {
+	start := time.Now()
+	l := &ipLimiters{limit: 1, burst: 1, clients: make(map[string]*client), lastPrune: start}
+	quiet := l.get("10.0.0.1", start)
+	l.get("10.0.0.2", start)
+
+	// Not yet idle for long enough
+	l.get("10.0.0.2", start.Add(limiterIdle/2))
+	if len(l.clients) != 2 {
+		t.Fatalf("%d limiters kept before any went idle, want 2", len(l.clients))
+	}
+
+	l.get("10.0.0.3", start.Add(limiterIdle))
+	if _, ok := l.clients["10.0.0.1"]; ok {
+		t.Error("the idle client's limiter was kept")
+	}
+	if len(l.clients) != 2 {
+		t.Errorf("%d limiters kept, want the 2 recently used", len(l.clients))
+	}
+	if l.get("10.0.0.1", start.Add(limiterIdle)) == quiet {
+		t.Error("a client that came back got its old limiter")
+	}
+}
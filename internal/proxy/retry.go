@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Retries of requests the target refused: up to retryAttempts more tries,
+// waiting retryBackoff before the first and twice as long before each
+// next one, about 3 seconds in all.
+const (
+	retryAttempts = 5
+	retryBackoff  = 100 * time.Millisecond
+)
+
+// retryTransport retries GET and HEAD requests that couldn't connect to
+// the target, which covers the moment between a restart and the new
+// server listening that the hold gate doesn't, such as a process that
+// was restarted by hand or crashed and came back. Nothing reached the
+// target on a failed connect, so a retry can't repeat a request it saw.
+type retryTransport struct {
+	base http.RoundTripper
+}
+
+func (t retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if !retryable(req) {
+		return resp, err
+	}
+
+	backoff := retryBackoff
+	for attempt := 0; attempt < retryAttempts && isConnectError(err); attempt++ {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+		resp, err = t.base.RoundTrip(req)
+	}
+	return resp, err
+}
+
+// retryable reports whether req can be sent again: a GET or HEAD without a
+// body to replay.
+func retryable(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody
+}
+
+// isConnectError reports whether err is a failure to connect, such as a
+// refused connection. Dial timeouts don't count: they have already made
+// the client wait.
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial" && !opErr.Timeout()
+}
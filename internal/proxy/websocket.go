@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Codimow/Reflex/internal/logging"
+)
+
+// isWebSocket reports whether r asks to upgrade the connection to a
+// WebSocket.
+func isWebSocket(r *http.Request) bool {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	for _, value := range r.Header.Values("Connection") {
+		for token := range strings.SplitSeq(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// websocketHandler proxies WebSocket connections. It forwards the upgrade
+// request over a raw TCP connection to the target and, once the target
+// switches protocols, copies bytes both ways until either side hangs up.
+type websocketHandler struct {
+	target *url.URL
+}
+
+// serve proxies a single WebSocket connection and returns the status code
+// of the handshake. Once the target switches protocols, it copies the
+// connection until either side hangs up and only then returns.
+func (h *websocketHandler) serve(w http.ResponseWriter, r *http.Request) int {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket proxying not supported", http.StatusInternalServerError)
+		return http.StatusInternalServerError
+	}
+
+	upstream, err := h.dial()
+	if err != nil {
+		logging.Printf("Proxy error: %v", err)
+		w.WriteHeader(http.StatusBadGateway)
+		return http.StatusBadGateway
+	}
+
+	// Forward the handshake with the target's address but the client's
+	// headers, Connection and Upgrade included
+	out := r.Clone(r.Context())
+	out.URL.Scheme = h.target.Scheme
+	out.URL.Host = h.target.Host
+	out.URL.Path = strings.TrimSuffix(h.target.Path, "/") + r.URL.Path
+	out.RequestURI = ""
+	if err := out.Write(upstream); err != nil {
+		upstream.Close()
+		logging.Printf("Proxy error: %v", err)
+		w.WriteHeader(http.StatusBadGateway)
+		return http.StatusBadGateway
+	}
+
+	upstreamReader := bufio.NewReader(upstream)
+	resp, err := http.ReadResponse(upstreamReader, out)
+	if err != nil {
+		upstream.Close()
+		logging.Printf("Proxy error: %v", err)
+		w.WriteHeader(http.StatusBadGateway)
+		return http.StatusBadGateway
+	}
+
+	// The target refused the upgrade; pass its answer on as a plain response
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer upstream.Close()
+		defer resp.Body.Close()
+		for key, values := range resp.Header {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return resp.StatusCode
+	}
+
+	client, clientBuf, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		logging.Printf("Proxy error: %v", err)
+		return http.StatusInternalServerError
+	}
+	if err := resp.Write(client); err != nil {
+		client.Close()
+		upstream.Close()
+		return http.StatusBadGateway
+	}
+
+	// Bytes either side sent right after the handshake may already be
+	// sitting in a buffer, so read through the buffers rather than the
+	// connections.
+	defer client.Close()
+	defer upstream.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, clientBuf.Reader)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(client, upstreamReader)
+		done <- struct{}{}
+	}()
+	// Once either side hangs up, closing both ends the other copy
+	<-done
+
+	return resp.StatusCode
+}
+
+// dial opens a connection to the target, over TLS for https targets.
+func (h *websocketHandler) dial() (net.Conn, error) {
+	addr := targetAddr(h.target)
+	if h.target.Scheme == "https" {
+		return tls.Dial("tcp", addr, &tls.Config{ServerName: h.target.Hostname()})
+	}
+	return net.Dial("tcp", addr)
+}
+
+// targetAddr returns the host:port to connect to for target, filling in
+// the scheme's default port.
+func targetAddr(target *url.URL) string {
+	if target.Port() != "" {
+		return target.Host
+	}
+	if target.Scheme == "https" {
+		return net.JoinHostPort(target.Hostname(), "443")
+	}
+	return net.JoinHostPort(target.Hostname(), "80")
+}
@@ -0,0 +1,58 @@
+package ui
+
+import "strings"
+
+// sanitizeLine prepares a line of process output for the viewport. Color
+// and style (SGR) sequences are kept, since lipgloss measures and wraps
+// around them, but cursor movement, screen clearing and other control
+// sequences would corrupt the layout and are dropped. Progress bars that
+// redraw with \r keep only their final state. A line that sets a style is
+// reset at the end so it can't bleed into the border.
+func sanitizeLine(line string) string {
+	if i := strings.LastIndexByte(line, '\r'); i >= 0 {
+		line = line[i+1:]
+	}
+	if !strings.ContainsAny(line, "\x1b\x07\b") {
+		return line
+	}
+
+	var b strings.Builder
+	styled := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\x1b' && i+1 < len(line) && line[i+1] == '[':
+			// CSI: parameters and intermediates, then a final byte in @–~
+			j := i + 2
+			for j < len(line) && (line[j] < 0x40 || line[j] > 0x7e) {
+				j++
+			}
+			if j < len(line) && line[j] == 'm' {
+				b.WriteString(line[i : j+1])
+				styled = true
+			}
+			i = j
+		case c == '\x1b' && i+1 < len(line) && line[i+1] == ']':
+			// OSC (window titles, hyperlinks): ends with BEL or ESC \
+			j := i + 2
+			for j < len(line) && line[j] != '\x07' && !(line[j] == '\x1b' && j+1 < len(line) && line[j+1] == '\\') {
+				j++
+			}
+			if j < len(line) && line[j] == '\x1b' {
+				j++
+			}
+			i = j
+		case c == '\x1b':
+			// Two-byte escape such as ESC 7 (save cursor)
+			i++
+		case c == '\x07' || c == '\b':
+			// Bells and backspaces have nothing to draw
+		default:
+			b.WriteByte(c)
+		}
+	}
+	if styled {
+		b.WriteString("\x1b[0m")
+	}
+	return b.String()
+}
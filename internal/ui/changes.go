@@ -0,0 +1,153 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/Codimow/Reflex/internal/watcher"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// ChangesMsg shows what changed in a batch of files, as the diffs the
+// watcher made with watcher.WithDiffs, in a section under the header. A
+// batch with no diffs leaves the last ones shown.
+type ChangesMsg struct {
+	Events []watcher.Event
+}
+
+// maxDiffLines is how many lines of diff the changes section shows at
+// most, so the output panes keep most of the screen.
+const maxDiffLines = 10
+
+// changes is the diff of the latest batch of changed files with a diff.
+type changes struct {
+	summary string   // Each file with its counts, e.g. "app.js +3 −1"
+	lines   []string // Styled diff lines, without the file headers
+}
+
+// newChanges builds the changes section from the events that have a diff,
+// reporting false if none has.
+func newChanges(events []watcher.Event) (changes, bool) {
+	var c changes
+	var files []string
+	for _, ev := range events {
+		if ev.Diff == "" {
+			continue
+		}
+		name, err := filepath.Rel(ev.Root, ev.Path)
+		if err != nil {
+			name = ev.Path
+		}
+		name = filepath.ToSlash(name)
+		lines, added, removed := diffLines(ev.Diff)
+		if len(lines) == 0 {
+			continue
+		}
+		files = append(files, fmt.Sprintf("%s +%d −%d", name, added, removed))
+		if len(events) > 1 {
+			c.lines = append(c.lines, taskNameStyle.Render(name))
+		}
+		c.lines = append(c.lines, lines...)
+	}
+	if len(files) == 0 {
+		return changes{}, false
+	}
+	c.summary = strings.Join(files, ", ")
+	return c, true
+}
+
+// diffLines styles the hunks of a unified diff, added lines green and
+// removed lines red, and counts them. The file headers are left out, which
+// takes following the line counts in each hunk header to tell a header
+// from a removed line that starts with "--". A line that ends its file
+// without a newline is followed by a marker saying so, which is dimmed.
+func diffLines(diff string) (lines []string, added, removed int) {
+	oldLeft, newLeft := 0, 0 // Lines of the current hunk still to come
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		if strings.HasPrefix(line, "\\ ") { // "\ No newline at end of file"
+			lines = append(lines, statsStyle.Render(line))
+			continue
+		}
+		if oldLeft == 0 && newLeft == 0 {
+			if strings.HasPrefix(line, "@@ ") {
+				oldLeft, newLeft = hunkCounts(line)
+				lines = append(lines, statsStyle.Render(line))
+			}
+			continue
+		}
+
+		text := strings.ReplaceAll(ansi.Strip(line), "\t", "    ")
+		switch line[0] {
+		case '+':
+			added++
+			newLeft--
+			lines = append(lines, statusRunning.UnsetBold().Render(text))
+		case '-':
+			removed++
+			oldLeft--
+			lines = append(lines, statusStopped.UnsetBold().Render(text))
+		default:
+			oldLeft--
+			newLeft--
+			lines = append(lines, text)
+		}
+	}
+	return lines, added, removed
+}
+
+// hunkCounts returns the number of lines of each version a hunk header
+// such as "@@ -12,5 +12,6 @@" covers. A range without a count is one line.
+func hunkCounts(header string) (old, new int) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 {
+		return 0, 0
+	}
+	return rangeCount(fields[1]), rangeCount(fields[2])
+}
+
+func rangeCount(r string) int {
+	_, count, ok := strings.Cut(r, ",")
+	if !ok {
+		return 1
+	}
+	var n int
+	fmt.Sscan(count, &n)
+	return n
+}
+
+// height is how many lines the section takes: the summary, and the diff
+// lines below it when open.
+func (c changes) height(open bool) int {
+	switch {
+	case c.summary == "":
+		return 0
+	case !open:
+		return 1
+	default:
+		return 1 + min(len(c.lines), maxDiffLines)
+	}
+}
+
+// view renders the section width columns wide: the summary, folded or
+// not, and when open as many diff lines as fit in maxDiffLines.
+func (c changes) view(open bool, width int) string {
+	marker := "▸ "
+	if open {
+		marker = "▾ "
+	}
+	rows := []string{ansi.Truncate(statusRestarting.Render(marker+"Changed ")+c.summary, width, "…")}
+	if open {
+		shown := c.lines
+		if len(shown) > maxDiffLines {
+			shown = shown[:maxDiffLines-1]
+		}
+		for _, line := range shown {
+			rows = append(rows, ansi.Truncate("  "+line, width, "…"))
+		}
+		if more := len(c.lines) - len(shown); more > 0 {
+			rows = append(rows, statsStyle.Render("  … "+plural(more, "more line", "more lines")))
+		}
+	}
+	return strings.Join(rows, "\n")
+}
@@ -0,0 +1,95 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+// LifecycleKind is what happened to a task's process in a
+// LifecycleEventMsg.
+type LifecycleKind int
+
+// The kinds of LifecycleEventMsg.
+const (
+	LifecycleStarted LifecycleKind = iota // The process started, for the first time or again
+	LifecycleExited                       // The process exited on its own with code 0
+	LifecycleCrashed                      // The process exited on its own otherwise
+)
+
+// LifecycleEventMsg adds an entry to the history pane, which the user
+// opens with h to see what happened while they were away.
+type LifecycleEventMsg struct {
+	Task   string
+	Kind   LifecycleKind
+	At     time.Time
+	Detail string // Why the process started, or how it exited
+}
+
+// maxHistory is how many entries the history keeps; older ones are
+// dropped.
+const maxHistory = 200
+
+// historyLines is how many of the latest entries the history pane shows.
+const historyLines = 8
+
+// addHistory records ev in the history. A start of a task that has started
+// before counts as a restart, numbered as in the task's stats.
+func (m *Model) addHistory(ev LifecycleEventMsg) {
+	t, ok := m.tasks[ev.Task]
+	if !ok {
+		return
+	}
+
+	var text string
+	switch ev.Kind {
+	case LifecycleStarted:
+		if t.restartCount == 0 {
+			text = statusRunning.Render("● Started")
+		} else {
+			text = statusRestarting.Render(fmt.Sprintf("◐ Restart #%d", t.restartCount))
+			if ev.Detail != "" {
+				text += statsStyle.Render(" (" + ev.Detail + ")")
+			}
+		}
+	case LifecycleExited:
+		text = statusRunning.Render("✓ " + ev.Detail)
+	case LifecycleCrashed:
+		text = statusStopped.Render("✗ " + ev.Detail)
+		if !m.historyOpen {
+			m.unseenCrashes++
+		}
+	}
+	if m.multi() {
+		text = taskNameStyle.Render(t.name) + " " + text
+	}
+	m.history.push(statsStyle.Render(ev.At.Format("15:04:05")) + "  " + text)
+}
+
+// historyHeight is how many lines the history pane takes when open: its
+// title, its border and its entries.
+func (m Model) historyHeight() int {
+	if !m.historyOpen {
+		return 0
+	}
+	return 3 + max(1, min(m.history.len(), historyLines))
+}
+
+// historyView renders the history pane: a title and the latest entries,
+// oldest first, each cut to the width of the pane.
+func (m Model) historyView() string {
+	var rows []string
+	for line := range m.history.all() {
+		rows = append(rows, ansi.Truncate(line, m.width-4, "…"))
+	}
+	if len(rows) > historyLines {
+		rows = rows[len(rows)-historyLines:]
+	}
+	if len(rows) == 0 {
+		rows = []string{statsStyle.Render("Nothing has happened yet")}
+	}
+	return historyTitleStyle.Render("  history") + "\n" +
+		historyViewportStyle.Width(m.width-2).Render(strings.Join(rows, "\n"))
+}
@@ -0,0 +1,69 @@
+package ui
+
+import tea "github.com/charmbracelet/bubbletea"
+
+// InputMsg carries keys typed into a task's process, as the bytes a
+// terminal sends for them. The UI sends it on Options.Input while it is
+// in input mode.
+type InputMsg struct {
+	Task string
+	Data []byte
+}
+
+// keySequences are the escape sequences terminals send for keys that are
+// neither text nor control characters.
+var keySequences = map[tea.KeyType]string{
+	tea.KeyUp:       "\x1b[A",
+	tea.KeyDown:     "\x1b[B",
+	tea.KeyRight:    "\x1b[C",
+	tea.KeyLeft:     "\x1b[D",
+	tea.KeyShiftTab: "\x1b[Z",
+	tea.KeyHome:     "\x1b[H",
+	tea.KeyEnd:      "\x1b[F",
+	tea.KeyPgUp:     "\x1b[5~",
+	tea.KeyPgDown:   "\x1b[6~",
+	tea.KeyInsert:   "\x1b[2~",
+	tea.KeyDelete:   "\x1b[3~",
+	tea.KeyF1:       "\x1bOP",
+	tea.KeyF2:       "\x1bOQ",
+	tea.KeyF3:       "\x1bOR",
+	tea.KeyF4:       "\x1bOS",
+}
+
+// keyBytes returns the bytes a terminal sends for key, with alt as a
+// leading escape, or nil for a key without a known encoding.
+func keyBytes(key tea.KeyMsg) []byte {
+	var b []byte
+	if key.Alt {
+		b = append(b, '\x1b')
+	}
+	switch {
+	case key.Type == tea.KeyRunes:
+		b = append(b, string(key.Runes)...)
+	case key.Type == tea.KeySpace:
+		b = append(b, ' ')
+	case key.Type >= 0 && key.Type <= 127:
+		// Control characters, enter, tab, escape and backspace
+		b = append(b, byte(key.Type))
+	default:
+		seq, ok := keySequences[key.Type]
+		if !ok {
+			return nil
+		}
+		b = append(b, seq...)
+	}
+	return b
+}
+
+// sendInput passes key to the focused task's process. If earlier input is
+// still waiting, the key is dropped rather than holding up the UI.
+func (m *Model) sendInput(key tea.KeyMsg) {
+	data := keyBytes(key)
+	if data == nil {
+		return
+	}
+	select {
+	case m.input <- InputMsg{Task: m.order[m.focused], Data: data}:
+	default:
+	}
+}
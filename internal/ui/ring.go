@@ -0,0 +1,84 @@
+package ui
+
+import (
+	"iter"
+	"strconv"
+)
+
+// ring holds the most recent items up to a fixed limit. Once full, each
+// push overwrites the oldest item, so memory stays bounded however long
+// the process runs.
+type ring[T any] struct {
+	items   []T
+	limit   int // Zero keeps every item
+	start   int // Index of the oldest item once the ring has filled up
+	dropped int // Items overwritten so far
+}
+
+// newRing creates a ring holding up to limit items. A limit of zero or
+// less keeps every item.
+func newRing[T any](limit int) *ring[T] {
+	return &ring[T]{limit: max(limit, 0)}
+}
+
+// push adds v, dropping the oldest item if the ring is full.
+func (r *ring[T]) push(v T) {
+	if r.limit == 0 || len(r.items) < r.limit {
+		r.items = append(r.items, v)
+		return
+	}
+	r.items[r.start] = v
+	r.start = (r.start + 1) % r.limit
+	r.dropped++
+}
+
+// len returns the number of items held.
+func (r *ring[T]) len() int {
+	return len(r.items)
+}
+
+// all yields the items from oldest to newest.
+func (r *ring[T]) all() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for i := range r.items {
+			if !yield(r.items[(r.start+i)%len(r.items)]) {
+				return
+			}
+		}
+	}
+}
+
+// latest yields the newest n items, oldest first.
+func (r *ring[T]) latest(n int) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for i := max(len(r.items)-n, 0); i < len(r.items); i++ {
+			if !yield(r.items[(r.start+i)%len(r.items)]) {
+				return
+			}
+		}
+	}
+}
+
+// reset empties the ring and its dropped count.
+func (r *ring[T]) reset() {
+	r.items, r.start, r.dropped = nil, 0, 0
+}
+
+// droppedMarker renders the line shown above a pane's output once older
+// lines have been dropped, e.g. "… 2,340 earlier lines dropped".
+func droppedMarker(n int) string {
+	lines := "lines"
+	if n == 1 {
+		lines = "line"
+	}
+	return statsStyle.Render("… " + formatCount(n) + " earlier " + lines + " dropped")
+}
+
+// formatCount formats n with thousands separators.
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
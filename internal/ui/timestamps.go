@@ -0,0 +1,38 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+)
+
+// Timestamps is how output lines are prefixed with the time they were
+// written.
+type Timestamps int
+
+const (
+	TimestampsOff      Timestamps = iota // No prefix
+	TimestampsWall                       // Wall-clock time, e.g. "15:04:05.123"
+	TimestampsRelative                   // Time since the process started, e.g. "+2.41s"
+)
+
+// next returns the mode the t key switches to from ts.
+func (ts Timestamps) next() Timestamps {
+	return (ts + 1) % 3
+}
+
+// Prefix returns the unstyled prefix, space included, for a line written at
+// at by a process started at start, or "" when timestamps are off. Lines
+// written before the process started, such as build output, get a negative
+// offset.
+func (ts Timestamps) Prefix(at, start time.Time) string {
+	switch ts {
+	case TimestampsWall:
+		return at.Format("15:04:05.000") + " "
+	case TimestampsRelative:
+		if start.IsZero() {
+			start = at
+		}
+		return fmt.Sprintf("%+.2fs ", at.Sub(start).Seconds())
+	}
+	return ""
+}
@@ -2,27 +2,200 @@
 package ui
 
 import (
+	"bytes"
+	"fmt"
 	"strings"
+	"time"
 
+	"github.com/Codimow/Reflex/internal/metrics"
+	"github.com/Codimow/Reflex/internal/process"
+	"github.com/Codimow/Reflex/internal/proxy"
+	"github.com/Codimow/Reflex/internal/watcher"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
 )
 
-// Message types for external communication via p.Send()
+// Message types for external communication via p.Send(). Task names the
+// task a message concerns; it is empty for a single unnamed command.
 
-// StatusUpdateMsg updates the header status text.
+// StatusUpdateMsg updates a task's status text.
 type StatusUpdateMsg struct {
+	Task   string
 	Status string
 }
 
-// ProcessOutputLineMsg appends a line to the log viewport.
+// ProcessOutputLineMsg appends a line to a task's log viewport. Stderr marks
+// lines the process wrote to stderr, and Hook lines from a restart hook.
 type ProcessOutputLineMsg struct {
-	Line string
+	Task   string
+	Line   string
+	Stderr bool
+	Hook   bool
+
+	// Time is when the line was written; zero means when it arrives.
+	Time time.Time
+}
+
+// LogMsg shows one of Reflex's own log messages, e.g. which file changed, as
+// a dim "reflex:" line in every task's pane.
+type LogMsg struct {
+	Text string
+	Time time.Time
+}
+
+// ClearLogsMsg clears all logs from a task's viewport.
+type ClearLogsMsg struct {
+	Task string
+}
+
+// ProcessStartedMsg records that a task's process was (re)started at
+// StartedAt. Every start after the first counts as a restart.
+type ProcessStartedMsg struct {
+	Task      string
+	StartedAt time.Time
+}
+
+// ProcessPIDMsg records the process ID of a task's new run, for attaching
+// a debugger. It follows the run's ProcessStartedMsg.
+type ProcessPIDMsg struct {
+	Task string
+	PID  int
+}
+
+// ProcessExitedMsg records that a task's process exited on its own.
+// Restarting says whether it is restarted straight away, as with
+// --restart-on-exit; otherwise a hint on how to bring it back is shown.
+type ProcessExitedMsg struct {
+	Task       string
+	Exit       process.Exit
+	Restarting bool
+}
+
+// ProcessStatsMsg updates the memory and CPU use shown for a task's
+// process. It is cleared when the process exits or restarts.
+type ProcessStatsMsg struct {
+	Task  string
+	Stats metrics.Stats
+}
+
+// ExitStatus describes how a process ended and, if known, how long it ran,
+// e.g. "Exited cleanly (code 0) after 3.2s", "Exited with code 1 after 12s"
+// or "Killed by SIGSEGV after 250ms".
+func ExitStatus(ex process.Exit) string {
+	var status string
+	switch {
+	case ex.Signal != "":
+		status = "Killed by " + ex.Signal
+	case ex.Code < 0:
+		status = "Killed by a signal"
+	case ex.Code == 0:
+		status = "Exited cleanly (code 0)"
+	default:
+		status = fmt.Sprintf("Exited with code %d", ex.Code)
+	}
+	if ex.Uptime > 0 {
+		status += " after " + ranFor(ex.Uptime)
+	}
+	return status
+}
+
+// ranFor rounds how long a process ran to what matters at its scale, e.g.
+// "250ms", "3.2s" or "12m5s".
+func ranFor(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return d.Round(time.Millisecond).String()
+	case d < time.Minute:
+		return d.Round(100 * time.Millisecond).String()
+	default:
+		return d.Truncate(time.Second).String()
+	}
+}
+
+// WatchingMsg shows how much the watcher is watching in the header, until
+// the first restart.
+type WatchingMsg struct {
+	Stats watcher.Stats
+}
+
+// WatchLimitMsg warns, for the rest of the session, that the watcher ran
+// out of watches and misses changes in some directories.
+type WatchLimitMsg struct {
+	Limit watcher.WatchLimit
+}
+
+// WatchLimitWarning describes a WatchLimit and what to do about it.
+func WatchLimitWarning(limit watcher.WatchLimit) string {
+	return fmt.Sprintf("Watch limit reached after %s, %s left unwatched; raise fs.inotify.max_user_watches or add --ignore patterns",
+		plural(limit.Watched, "directory", "directories"), formatCount(limit.Unwatched))
+}
+
+// WatchSummary describes what the watcher found, e.g. "Watching 143
+// directories across 2,847 files".
+func WatchSummary(stats watcher.Stats) string {
+	return fmt.Sprintf("Watching %s across %s",
+		plural(stats.WatchedDirs, "directory", "directories"),
+		plural(stats.WatchedFiles, "file", "files"))
+}
+
+// plural formats n with the singular or plural noun, e.g. "2,847 files".
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return "1 " + one
+	}
+	return formatCount(n) + " " + many
 }
 
-// ClearLogsMsg clears all logs from the viewport.
-type ClearLogsMsg struct{}
+// tickMsg re-renders the header so the uptime stays current.
+type tickMsg time.Time
+
+// refreshMsg rebuilds the content of panes that received output since the
+// last refresh.
+type refreshMsg struct{}
+
+// refreshInterval is how often panes receiving output are rebuilt. Lines
+// arriving in between are batched into a single rebuild.
+const refreshInterval = 16 * time.Millisecond
+
+// DefaultMaxLogLines is how many lines each pane keeps when Options doesn't
+// say otherwise.
+const DefaultMaxLogLines = 10000
+
+// RequestLogMsg appends a proxied request to the request log pane.
+type RequestLogMsg struct {
+	Log proxy.RequestLog
+}
+
+// ManualRestartMsg asks the controller to restart a task, as if one of its
+// files had changed. The UI sends it on Options.Restarts when the user
+// presses r.
+type ManualRestartMsg struct {
+	Task string
+}
+
+// PauseMsg asks the controller to stop restarting on file changes, or to
+// start again. The UI sends it on Options.Pauses when the user presses p.
+type PauseMsg struct {
+	Paused bool
+}
+
+// StopMsg asks the controller to stop the processes so Reflex can exit:
+// with SIGINT at first, or with SIGKILL if Force is set. The UI sends it on
+// Options.Stops when the user presses q, and with Force when they press it
+// again within forceWindow.
+type StopMsg struct {
+	Force bool
+}
+
+// forceWindow is how soon after the first q another one forces the exit.
+const forceWindow = 3 * time.Second
+
+// ProxyNoticeMsg shows a message about the proxy in the request log pane.
+type ProxyNoticeMsg struct {
+	Text string
+}
 
 // Styles
 var (
@@ -50,26 +223,287 @@ var (
 			BorderForeground(lipgloss.Color("#7D56F4")).
 			Padding(0, 1)
 
+	proxyViewportStyle = viewportStyle.
+				BorderForeground(lipgloss.Color("#04B575"))
+
+	historyViewportStyle = viewportStyle.
+				BorderForeground(lipgloss.Color("#FFCC00"))
+
+	stderrStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#FF8787"))
+
+	hookStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#FFCC00"))
+
+	statsStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#888888"))
+
+	taskNameStyle = lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("#7D56F4"))
+
+	historyTitleStyle = taskNameStyle.
+				Foreground(lipgloss.Color("#FFCC00"))
+
 	helpStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("#626262")).
 			MarginTop(1)
 )
 
+// Options configures optional parts of the UI.
+type Options struct {
+	// Tasks names the tasks to show, one output pane each, stacked in this
+	// order. Nil means a single unnamed task.
+	Tasks []string
+
+	// ProxyPane splits the screen to show proxied requests below the
+	// process output.
+	ProxyPane bool
+
+	// MaxLogLines caps how many lines each pane keeps; older lines are
+	// dropped. Zero means DefaultMaxLogLines, and a negative value keeps
+	// every line.
+	MaxLogLines int
+
+	// Restarts receives a ManualRestartMsg for the focused task when the
+	// user presses r. Nil disables the key.
+	Restarts chan<- ManualRestartMsg
+
+	// Pauses receives a PauseMsg each time the user presses p to pause or
+	// resume restarts. Nil disables the key.
+	Pauses chan<- PauseMsg
+
+	// Stops receives a StopMsg when the user presses q or ctrl+c, and the
+	// controller quits the UI once the processes have stopped. Nil makes
+	// the keys quit straight away.
+	Stops chan<- StopMsg
+
+	// Timestamps is how lines are prefixed with their time at first; the
+	// user switches between the modes with t.
+	Timestamps Timestamps
+
+	// Quiet discards the output the processes write to stdout and hides
+	// the panes, leaving the status. What a run writes to stderr is kept,
+	// and its pane shown, if the run exits with a non-zero code.
+	Quiet bool
+
+	// Input receives the keys typed into the focused task's process. The
+	// UI starts in input mode, where every key but ctrl+] goes to the
+	// process; ctrl+] switches to the UI's own keys and i back. Nil leaves
+	// the keys to the UI.
+	Input chan<- InputMsg
+}
+
+// taskModel is the state of one task's output pane.
+type taskModel struct {
+	name          string
+	viewport      viewport.Model
+	status        string
+	logs          *ring[logLine]
+	dirty         bool // The viewport content must be rebuilt from logs
+	shown         int  // Lines the current filter lets through
+	following     bool // Scroll to new output as it arrives
+	unseen        int  // Lines added below the view since following stopped
+	restartCount  int
+	lastStartedAt time.Time
+	exited        bool           // The run ended; the status says how long it lasted
+	usage         *metrics.Stats // Latest sample of the running process; nil if none
+
+	crashed bool // The run exited with a non-zero code, so --quiet shows its pane
+
+	pid int // Process ID of the current run; 0 if unknown
+
+	// The viewport content, kept so new lines can be appended and dropped
+	// ones trimmed off the front without rendering every line again
+	rendered []byte // Shown lines, each ending in a newline
+	sizes    []int  // Bytes in rendered of each line in logs, oldest first; 0 if not shown
+	pending  int    // Lines pushed since rendered was brought up to date
+	trim     int    // Lines dropped from logs since rendered was brought up to date
+}
+
+// logLine is a line of process output, sanitized and styled once when it
+// arrives.
+type logLine struct {
+	text   string
+	plain  string // text without styling, lower-cased for searching
+	stderr bool
+	at     time.Time // When the line was written
+}
+
+// lineFilter selects the lines a pane shows, and how their times are shown.
+type lineFilter struct {
+	errorsOnly bool       // Only stderr lines
+	query      string     // Lower-cased search text; "" matches every line
+	timestamps Timestamps // Prefix added to each line as it is rendered
+}
+
+func (f lineFilter) match(l logLine) bool {
+	if f.errorsOnly && !l.stderr {
+		return false
+	}
+	return strings.Contains(l.plain, f.query)
+}
+
+// render rebuilds the pane's content from the lines of the task's logs
+// that f matches, and counts them in shown.
+func (t *taskModel) render(f lineFilter) {
+	t.rendered, t.sizes = t.rendered[:0], t.sizes[:0]
+	t.shown = 0
+	for l := range t.logs.all() {
+		t.appendLine(f, l)
+	}
+}
+
+// appendLine adds l to the end of the pane's content if f matches it, with
+// stderr lines tinted red and timestamps dimmed.
+func (t *taskModel) appendLine(f lineFilter, l logLine) {
+	if !f.match(l) {
+		t.sizes = append(t.sizes, 0)
+		return
+	}
+	t.shown++
+	n := len(t.rendered)
+	if prefix := f.timestamps.Prefix(l.at, t.lastStartedAt); prefix != "" {
+		t.rendered = append(t.rendered, statsStyle.Render(prefix)...)
+	}
+	t.rendered = append(t.rendered, l.text...)
+	t.rendered = append(t.rendered, '\n')
+	t.sizes = append(t.sizes, len(t.rendered)-n)
+}
+
+// trimLines removes the oldest n lines from the pane's content.
+func (t *taskModel) trimLines(n int) {
+	cut := 0
+	for _, size := range t.sizes[:n] {
+		if size > 0 {
+			cut += size
+			t.shown--
+		}
+	}
+	t.rendered = t.rendered[cut:]
+	t.sizes = t.sizes[n:]
+}
+
+// content returns the pane's content: the lines shown, under a marker if
+// older lines have been dropped.
+func (t *taskModel) content() string {
+	lines := string(bytes.TrimSuffix(t.rendered, []byte("\n")))
+	if t.logs.dropped == 0 {
+		return lines
+	}
+	if lines == "" {
+		return droppedMarker(t.logs.dropped)
+	}
+	return droppedMarker(t.logs.dropped) + "\n" + lines
+}
+
+// refresh brings the viewport content up to date with the logs, keeping
+// the view at the bottom while following. Lines pushed since the last
+// refresh are appended to what is shown, and lines dropped since are
+// trimmed off the front; only a change of filter makes it render every
+// line again.
+func (t *taskModel) refresh(f lineFilter) {
+	switch {
+	case t.dirty || t.trim > len(t.sizes):
+		t.render(f)
+	case t.pending > 0:
+		t.trimLines(t.trim)
+		for l := range t.logs.latest(t.pending) {
+			t.appendLine(f, l)
+		}
+	default:
+		return
+	}
+	t.dirty, t.pending, t.trim = false, 0, 0
+	t.viewport.SetContent(t.content())
+	if t.following {
+		t.viewport.GotoBottom()
+	}
+}
+
 // Model represents the TUI state.
 type Model struct {
-	viewport    viewport.Model
-	status      string
-	logs        []string
-	ready       bool
-	width       int
-	height      int
+	tasks         map[string]*taskModel
+	order         []string // Task names, top to bottom
+	focused       int      // Index in order of the task pane that scrolls, unless proxyFocused
+	proxyViewport viewport.Model
+	requestLogs   *ring[string]
+	proxyDirty    bool // requestLogs changed since the proxy pane was set
+	proxyFocused  bool // The request log pane scrolls rather than a task's
+	proxyFollow   bool // The request log pane scrolls to new requests
+	showProxy     bool
+	restarts      chan<- ManualRestartMsg
+	pauses        chan<- PauseMsg
+	paused        bool   // File changes don't restart anything until resumed
+	errorsOnly    bool   // Only stderr lines are shown
+	searching     bool   // The search bar has the keyboard
+	query         string // Search text; only lines containing it are shown
+	ticking       bool   // An uptime tick is scheduled
+	refreshing    bool   // A refresh of changed panes is scheduled
+	quitting      bool
+	ready         bool
+	width         int
+	height        int
+
+	timestamps Timestamps // How lines are prefixed with their time; t switches
+
+	stops     chan<- StopMsg
+	stoppedAt time.Time // When the user last pressed q; zero until then
+
+	watching   string // Summary of what is watched; cleared at the first restart
+	watchLimit string // Warning that the watcher ran out of watches; never cleared
+
+	input  chan<- InputMsg
+	typing bool // Keys go to the focused task's process rather than the UI
+
+	quiet bool // Only stderr is kept, and only shown for a crashed run
+
+	changes     changes // Diff of the latest change, shown under the header
+	changesOpen bool    // The diff lines are shown, not just the summary; d folds them
+
+	history       *ring[string] // Lifecycle events of the tasks, styled, oldest first
+	historyOpen   bool          // The history pane is shown; h toggles it
+	unseenCrashes int           // Crashes added while the history pane was closed
 }
 
 // New creates a new UI model with default values.
-func New() Model {
+func New(opts Options) Model {
+	order := opts.Tasks
+	if len(order) == 0 {
+		order = []string{""}
+	}
+	maxLines := opts.MaxLogLines
+	if maxLines == 0 {
+		maxLines = DefaultMaxLogLines
+	}
+	tasks := make(map[string]*taskModel, len(order))
+	for _, name := range order {
+		tasks[name] = &taskModel{
+			name:      name,
+			status:    "Initializing",
+			logs:      newRing[logLine](maxLines),
+			following: true,
+		}
+	}
 	return Model{
-		status: "Initializing",
-		logs:   []string{},
+		tasks:       tasks,
+		order:       order,
+		requestLogs: newRing[string](maxLines),
+		showProxy:   opts.ProxyPane,
+		proxyFollow: true,
+		restarts:    opts.Restarts,
+		pauses:      opts.Pauses,
+		timestamps:  opts.Timestamps,
+		stops:       opts.Stops,
+
+		input:  opts.Input,
+		typing: opts.Input != nil,
+
+		quiet: opts.Quiet,
+
+		changesOpen: true,
+
+		history: newRing[string](maxHistory),
 	}
 }
 
@@ -78,6 +512,256 @@ func (m Model) Init() tea.Cmd {
 	return nil
 }
 
+// tick schedules the next uptime refresh one second from now.
+func tick() tea.Cmd {
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg {
+		return tickMsg(t)
+	})
+}
+
+// updateSearch handles a key while the search bar is open. Typing narrows
+// the panes as you go; enter keeps the filter and closes the bar, escape
+// clears it.
+func (m Model) updateSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		return m, m.quit()
+	case tea.KeyEsc:
+		m.searching = false
+		m.setQuery("")
+	case tea.KeyEnter:
+		m.searching = false
+	case tea.KeyBackspace:
+		if r := []rune(m.query); len(r) > 0 {
+			m.setQuery(string(r[:len(r)-1]))
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		m.setQuery(m.query + string(msg.Runes))
+	}
+	return m, nil
+}
+
+// push appends line to t's logs, counting it as unseen if t isn't following
+// and would show it.
+func (m *Model) push(t *taskModel, line logLine) {
+	dropped := t.logs.dropped
+	t.logs.push(line)
+	t.trim += t.logs.dropped - dropped
+	t.pending++
+	if !t.following && m.filter().match(line) {
+		t.unseen++
+	}
+}
+
+// restart asks the controller to restart the focused task and flags it in
+// the task's status until the controller reports the restart. If a restart
+// request is already waiting, the key does nothing.
+func (m *Model) restart() {
+	if m.restarts == nil {
+		return
+	}
+	t := m.tasks[m.order[m.focused]]
+	select {
+	case m.restarts <- ManualRestartMsg{Task: t.name}:
+		t.status = "Manual restart triggered"
+	default:
+	}
+}
+
+// togglePause asks the controller to pause or resume restarts. The header
+// only changes once the request is queued, so it never disagrees with the
+// controller; if a request is already waiting, the key does nothing.
+func (m *Model) togglePause() {
+	if m.pauses == nil {
+		return
+	}
+	select {
+	case m.pauses <- PauseMsg{Paused: !m.paused}:
+		m.paused = !m.paused
+	default:
+	}
+}
+
+// quit asks the controller to stop the processes, which gives them the
+// chance to shut down cleanly; it quits the UI once they have. Pressing
+// the key again within forceWindow kills them and quits straight away.
+func (m *Model) quit() tea.Cmd {
+	if m.stops == nil {
+		m.quitting = true
+		return tea.Quit
+	}
+	now := time.Now()
+	switch {
+	case m.stoppedAt.IsZero():
+		select {
+		case m.stops <- StopMsg{}:
+		default:
+		}
+	case now.Sub(m.stoppedAt) < forceWindow:
+		select {
+		case m.stops <- StopMsg{Force: true}:
+		default:
+		}
+		m.quitting = true
+		return tea.Quit
+	}
+	m.stoppedAt = now
+	return nil
+}
+
+// setQuery changes the search text and re-filters the panes.
+func (m *Model) setQuery(query string) {
+	if query == m.query {
+		return
+	}
+	m.query = query
+	m.refreshAll()
+}
+
+// filter returns the filter the panes currently apply.
+func (m Model) filter() lineFilter {
+	return lineFilter{errorsOnly: m.errorsOnly, query: strings.ToLower(m.query), timestamps: m.timestamps}
+}
+
+// refreshAll rebuilds every task pane, e.g. after the filter changed.
+func (m *Model) refreshAll() {
+	if !m.ready {
+		return
+	}
+	for _, t := range m.tasks {
+		t.dirty = true
+		t.refresh(m.filter())
+	}
+}
+
+// scheduleRefresh arranges for changed panes to be rebuilt shortly, unless
+// a refresh is already on its way.
+func (m *Model) scheduleRefresh() tea.Cmd {
+	if m.refreshing {
+		return nil
+	}
+	m.refreshing = true
+	return tea.Tick(refreshInterval, func(time.Time) tea.Msg {
+		return refreshMsg{}
+	})
+}
+
+// refreshProxy sets the proxy pane's content if requests were logged since
+// it was last set.
+func (m *Model) refreshProxy() {
+	if !m.proxyDirty {
+		return
+	}
+	m.proxyDirty = false
+	var b strings.Builder
+	if m.requestLogs.dropped > 0 {
+		b.WriteString(droppedMarker(m.requestLogs.dropped))
+	}
+	for line := range m.requestLogs.all() {
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(line)
+	}
+	m.proxyViewport.SetContent(b.String())
+	if m.proxyFollow {
+		m.proxyViewport.GotoBottom()
+	}
+}
+
+// focusedFollowing reports whether the focused pane scrolls to new output.
+func (m Model) focusedFollowing() bool {
+	if m.proxyFocused {
+		return m.proxyFollow
+	}
+	return m.tasks[m.order[m.focused]].following
+}
+
+// cycleFocus moves the focus step panes down, wrapping around. The request
+// log pane comes after the tasks.
+func (m *Model) cycleFocus(step int) {
+	panes := len(m.order)
+	if m.showProxy {
+		panes++
+	}
+	i := m.focused
+	if m.proxyFocused {
+		i = len(m.order)
+	}
+	i = (i + step + panes) % panes
+	m.proxyFocused = i == len(m.order)
+	if !m.proxyFocused {
+		m.focused = i
+	}
+}
+
+// layout sizes the panes to share the screen, creating them the first
+// time, once the size of the terminal is known.
+func (m *Model) layout() {
+	if m.width == 0 && m.height == 0 {
+		return
+	}
+
+	headerHeight := 3 // header + margin
+	helpHeight := 2   // help text + margin
+	headerHeight += m.changes.height(m.changesOpen)
+	helpHeight += m.historyHeight()
+
+	// Share the space between the panes: one per task, plus the proxy
+	// pane. Each pane has a border, and with several tasks a divider.
+	panes := len(m.order)
+	if m.showProxy {
+		panes++
+	}
+	available := m.height - headerHeight - helpHeight - 2*panes // border padding
+	if m.multi() {
+		available -= len(m.order)
+	}
+	if m.showProxy {
+		available-- // The request log pane's divider
+	}
+	paneHeight := available / panes
+	lastHeight := available - paneHeight*(panes-1) // Last pane takes the remainder
+
+	for i, name := range m.order {
+		t := m.tasks[name]
+		height := paneHeight
+		if i == panes-1 {
+			height = lastHeight
+		}
+		if !m.ready {
+			t.viewport = viewport.New(m.width-4, height)
+			t.dirty = true
+			t.refresh(m.filter())
+		} else {
+			t.viewport.Width = m.width - 4
+			t.viewport.Height = height
+			if t.following {
+				t.viewport.GotoBottom()
+			}
+		}
+	}
+
+	proxyHeight := 0
+	if m.showProxy {
+		proxyHeight = lastHeight
+	}
+	if !m.ready {
+		m.proxyViewport = viewport.New(m.width-4, proxyHeight)
+		m.proxyDirty = true
+		m.refreshProxy()
+		m.ready = true
+	} else {
+		m.proxyViewport.Width = m.width - 4
+		m.proxyViewport.Height = proxyHeight
+	}
+}
+
+// multi reports whether several tasks are shown, each under its own divider.
+func (m Model) multi() bool {
+	return len(m.order) > 1
+}
+
 // Update implements tea.Model.
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
@@ -85,48 +769,246 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.typing {
+			// Every key but ctrl+] belongs to the process
+			if msg.Type == tea.KeyCtrlCloseBracket {
+				m.typing = false
+			} else {
+				m.sendInput(msg)
+			}
+			return m, nil
+		}
+		if m.searching {
+			// The search bar takes every key but ctrl+c
+			return m.updateSearch(msg)
+		}
+
 		switch msg.String() {
 		case "q", "ctrl+c":
-			return m, tea.Quit
+			return m, m.quit()
+		case "i":
+			m.typing = m.input != nil
+		case "/":
+			m.searching = true
+			return m, nil
+		case "esc":
+			m.setQuery("")
+		case "tab":
+			m.cycleFocus(1)
+		case "shift+tab":
+			m.cycleFocus(-1)
+		case "f", "end", "G":
+			// Jump back to the newest output and keep up with it
+			if m.proxyFocused {
+				m.proxyFollow = true
+				m.proxyViewport.GotoBottom()
+				break
+			}
+			t := m.tasks[m.order[m.focused]]
+			t.follow()
+		case "e":
+			m.errorsOnly = !m.errorsOnly
+			m.refreshAll()
+		case "r":
+			m.restart()
+		case "p":
+			m.togglePause()
+		case "t":
+			m.timestamps = m.timestamps.next()
+			m.refreshAll()
+		case "h":
+			m.historyOpen = !m.historyOpen
+			m.unseenCrashes = 0
+			m.layout()
+			// h also scrolls left, which the panes never need
+			return m, nil
+		case "d":
+			// Without a diff to fold, d is left to scroll half a page
+			if m.changes.summary != "" {
+				m.changesOpen = !m.changesOpen
+				m.layout()
+				return m, nil
+			}
 		}
 
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
+		m.layout()
 
-		headerHeight := 3 // header + margin
-		helpHeight := 2   // help text + margin
-		viewportHeight := m.height - headerHeight - helpHeight - 2 // border padding
+	case LifecycleEventMsg:
+		m.addHistory(msg)
+		if m.historyOpen {
+			m.layout()
+		}
 
-		if !m.ready {
-			m.viewport = viewport.New(m.width-4, viewportHeight)
-			m.viewport.SetContent(strings.Join(m.logs, "\n"))
-			m.ready = true
-		} else {
-			m.viewport.Width = m.width - 4
-			m.viewport.Height = viewportHeight
+	case ChangesMsg:
+		if c, ok := newChanges(msg.Events); ok {
+			m.changes = c
+			m.layout()
 		}
 
 	case StatusUpdateMsg:
-		m.status = msg.Status
+		if t, ok := m.tasks[msg.Task]; ok {
+			t.status = msg.Status
+		}
+
+	case ProcessExitedMsg:
+		if t, ok := m.tasks[msg.Task]; ok {
+			t.status = ExitStatus(msg.Exit)
+			t.usage = nil
+			t.exited = true
+			t.crashed = msg.Exit.Code != 0
+			if !msg.Restarting {
+				hint := "Waiting for a change to restart it"
+				if m.restarts != nil {
+					hint += ", or press r"
+				}
+				m.push(t, logLine{
+					text:  statsStyle.Render(hint),
+					plain: strings.ToLower(hint),
+					at:    time.Now(),
+				})
+				cmds = append(cmds, m.scheduleRefresh())
+			}
+		}
+
+	case ProcessStatsMsg:
+		if t, ok := m.tasks[msg.Task]; ok {
+			t.usage = &msg.Stats
+		}
+
+	case ProcessPIDMsg:
+		if t, ok := m.tasks[msg.Task]; ok {
+			t.pid = msg.PID
+		}
+
+	case ProcessStartedMsg:
+		if t, ok := m.tasks[msg.Task]; ok {
+			if !t.lastStartedAt.IsZero() {
+				t.restartCount++
+				m.watching = ""
+			}
+			t.lastStartedAt = msg.StartedAt
+			t.usage = nil
+			t.pid = 0
+			t.exited = false
+			t.crashed = false
+			// Relative timestamps count from the new start
+			t.dirty = t.dirty || m.timestamps == TimestampsRelative
+		}
+
+		// Start the uptime ticker with the first run
+		if !m.ticking {
+			m.ticking = true
+			cmds = append(cmds, tick())
+		}
+
+	case WatchingMsg:
+		m.watching = WatchSummary(msg.Stats)
+
+	case WatchLimitMsg:
+		m.watchLimit = WatchLimitWarning(msg.Limit)
+
+	case tickMsg:
+		// Keep ticking until the UI quits so no timer outlives the program
+		if m.quitting {
+			m.ticking = false
+		} else {
+			cmds = append(cmds, tick())
+		}
 
 	case ProcessOutputLineMsg:
-		m.logs = append(m.logs, msg.Line)
+		if m.quiet && !msg.Stderr {
+			break
+		}
+		if t, ok := m.tasks[msg.Task]; ok {
+			line := logLine{
+				text:   sanitizeLine(msg.Line),
+				plain:  strings.ToLower(ansi.Strip(msg.Line)),
+				stderr: msg.Stderr,
+				at:     msg.Time,
+			}
+			if line.at.IsZero() {
+				line.at = time.Now()
+			}
+			switch {
+			case msg.Hook:
+				line.text = hookStyle.Render("[hook] " + line.text)
+			case line.stderr:
+				line.text = stderrStyle.Render(line.text)
+			}
+			m.push(t, line)
+			cmds = append(cmds, m.scheduleRefresh())
+		}
+
+	case LogMsg:
+		text := "reflex: " + msg.Text
+		for _, t := range m.tasks {
+			m.push(t, logLine{
+				text:  statsStyle.Render(sanitizeLine(text)),
+				plain: strings.ToLower(ansi.Strip(text)),
+				at:    msg.Time,
+			})
+		}
+		cmds = append(cmds, m.scheduleRefresh())
+
+	case refreshMsg:
+		m.refreshing = false
 		if m.ready {
-			m.viewport.SetContent(strings.Join(m.logs, "\n"))
-			m.viewport.GotoBottom()
+			for _, t := range m.tasks {
+				t.refresh(m.filter())
+			}
+			m.refreshProxy()
 		}
 
 	case ClearLogsMsg:
-		m.logs = []string{}
-		if m.ready {
-			m.viewport.SetContent("")
+		if t, ok := m.tasks[msg.Task]; ok {
+			// The output being read is gone, so start following again
+			t.logs.reset()
+			t.following, t.unseen = true, 0
+			t.usage = nil
+			t.dirty = true
+			if m.ready {
+				t.refresh(m.filter())
+			}
 		}
+
+	case ProxyNoticeMsg:
+		m.requestLogs.push(statusRestarting.Render(msg.Text))
+		m.proxyDirty = true
+		cmds = append(cmds, m.scheduleRefresh())
+
+	case RequestLogMsg:
+		m.requestLogs.push(proxy.FormatLog(msg.Log))
+		m.proxyDirty = true
+		cmds = append(cmds, m.scheduleRefresh())
 	}
 
+	// Scrolling applies to the focused pane. Scrolling up stops following
+	// new output; scrolling back to the bottom resumes it.
 	if m.ready {
-		m.viewport, cmd = m.viewport.Update(msg)
-		cmds = append(cmds, cmd)
+		switch msg.(type) {
+		case tea.KeyMsg, tea.MouseMsg:
+			if m.proxyFocused {
+				m.refreshProxy()
+				m.proxyViewport, cmd = m.proxyViewport.Update(msg)
+				cmds = append(cmds, cmd)
+				m.proxyFollow = m.proxyViewport.AtBottom()
+				break
+			}
+			t := m.tasks[m.order[m.focused]]
+			// Scroll over the latest output, not the last refresh
+			t.refresh(m.filter())
+			t.viewport, cmd = t.viewport.Update(msg)
+			cmds = append(cmds, cmd)
+
+			if t.viewport.AtBottom() {
+				t.follow()
+			} else {
+				t.following = false
+			}
+		}
 	}
 
 	return m, tea.Batch(cmds...)
@@ -138,38 +1020,216 @@ func (m Model) View() string {
 		return "Initializing..."
 	}
 
-	// Render header with styled status
-	styledStatus := m.styledStatus()
-	header := headerStyle.Render("⚡ Reflex") + " " + styledStatus
+	// Render header; a single task shows its status and stats right there
+	header := headerStyle.Render("⚡ Reflex")
+	if !m.multi() {
+		t := m.tasks[m.order[0]]
+		header += " " + t.styledStatus() + t.stats() + t.newLines()
+	}
+	if m.paused {
+		header += " " + statusRestarting.Render("⏸ Paused")
+	}
+	if m.watching != "" {
+		header += statsStyle.Render(" — " + m.watching)
+	}
+	if m.watchLimit != "" {
+		header += " " + statusStopped.Render("⚠ "+m.watchLimit)
+	}
 
-	// Render viewport with border
-	viewportContent := viewportStyle.Render(m.viewport.View())
+	sections := []string{header}
+	if m.changes.summary != "" {
+		sections = append(sections, m.changes.view(m.changesOpen, m.width))
+	}
+	for i, name := range m.order {
+		t := m.tasks[name]
+		if m.multi() {
+			sections = append(sections, t.divider(i == m.focused && !m.proxyFocused))
+		}
+		if m.quiet && !t.crashed {
+			continue
+		}
+		sections = append(sections, viewportStyle.Render(t.viewport.View()))
+	}
+	if m.showProxy {
+		sections = append(sections, m.proxyDivider())
+		sections = append(sections, proxyViewportStyle.Render(m.proxyViewport.View()))
+	}
+	if m.historyOpen {
+		sections = append(sections, m.historyView())
+	}
+
+	// While stopping, the help text only says how to force it
+	if !m.stoppedAt.IsZero() {
+		if time.Since(m.stoppedAt) < forceWindow {
+			sections = append(sections, helpStyle.Render("Stopping (press again to force)…"))
+		} else {
+			sections = append(sections, helpStyle.Render("Stopping…"))
+		}
+		return lipgloss.JoinVertical(lipgloss.Left, sections...)
+	}
+
+	// While typing, the help text only says how to get the keys back
+	if m.typing {
+		target := "the process"
+		if m.multi() {
+			target = m.order[m.focused]
+		}
+		sections = append(sections, helpStyle.Render("Typing into "+target+" • ctrl+]: Reflex keys"))
+		return lipgloss.JoinVertical(lipgloss.Left, sections...)
+	}
+
+	// While searching, the search bar takes the place of the help text
+	if m.searching || m.query != "" {
+		sections = append(sections, m.searchBar())
+		return lipgloss.JoinVertical(lipgloss.Left, sections...)
+	}
 
 	// Help text
-	help := helpStyle.Render("↑/↓: scroll • q: quit")
+	help := "↑/↓: scroll • /: search • "
+	if m.multi() || m.showProxy {
+		help += "tab: switch pane • "
+	}
+	if !m.focusedFollowing() {
+		help += "f: follow • "
+	}
+	if m.restarts != nil {
+		help += "r: restart • "
+	}
+	if m.input != nil {
+		help += "i: input • "
+	}
+	if m.pauses != nil {
+		if m.paused {
+			help += "p: resume • "
+		} else {
+			help += "p: pause • "
+		}
+	}
+	help += "t: timestamps • "
+	switch {
+	case m.historyOpen:
+		help += "h: hide history • "
+	case m.unseenCrashes > 0:
+		help += "h: history (" + plural(m.unseenCrashes, "crash", "crashes") + ") • "
+	default:
+		help += "h: history • "
+	}
+	if m.changes.summary != "" {
+		if m.changesOpen {
+			help += "d: hide diff • "
+		} else {
+			help += "d: show diff • "
+		}
+	}
+	if m.errorsOnly {
+		help += "e: show all output • q: quit"
+	} else {
+		help += "e: errors only • q: quit"
+	}
+	sections = append(sections, helpStyle.Render(help))
+
+	return lipgloss.JoinVertical(lipgloss.Left, sections...)
+}
+
+// searchBar renders the search text and how many of the focused pane's
+// lines match it, e.g. "/error  showing 12/347 lines".
+func (m Model) searchBar() string {
+	t := m.tasks[m.order[m.focused]]
+	cursor := ""
+	hint := "esc: clear • /: edit"
+	if m.searching {
+		cursor = "█"
+		hint = "enter: done • esc: clear"
+	}
+	count := fmt.Sprintf("showing %s/%s lines", formatCount(t.shown), formatCount(t.logs.len()))
+	return helpStyle.Render(taskNameStyle.Render("/"+m.query+cursor) + "  " + count + " • " + hint)
+}
 
-	return lipgloss.JoinVertical(
-		lipgloss.Left,
-		header,
-		viewportContent,
-		help,
-	)
+// follow scrolls to the newest output and keeps the pane there.
+func (t *taskModel) follow() {
+	t.following = true
+	t.unseen = 0
+	t.viewport.GotoBottom()
+}
+
+// newLines returns an indicator of the output that arrived below the view
+// since the user scrolled away, or an empty string if there is none.
+func (t *taskModel) newLines() string {
+	if t.following || t.unseen == 0 {
+		return ""
+	}
+	lines := "lines"
+	if t.unseen == 1 {
+		lines = "line"
+	}
+	return " " + statusRestarting.Render(fmt.Sprintf("⤓ %d new %s", t.unseen, lines))
+}
+
+// divider renders the label above a task's pane: its name, status and
+// stats. The focused pane, which receives scroll keys, is marked.
+func (t *taskModel) divider(focused bool) string {
+	marker := "  "
+	if focused {
+		marker = "▸ "
+	}
+	return taskNameStyle.Render(marker+t.name) + " " + t.styledStatus() + t.stats() + t.newLines()
+}
+
+// proxyDivider renders the title line above the request log pane, marked
+// when the pane has the focus.
+func (m Model) proxyDivider() string {
+	marker := "  "
+	if m.proxyFocused {
+		marker = "▸ "
+	}
+	return taskNameStyle.Foreground(lipgloss.Color("#04B575")).Render(marker + "requests")
+}
+
+// stats returns the restart count and, while it lasts, the uptime and PID
+// of the task's current run, followed by its memory and CPU use once
+// sampled, or an empty string before the process has started.
+func (t *taskModel) stats() string {
+	if t.lastStartedAt.IsZero() {
+		return ""
+	}
+	restarts := "restarts"
+	if t.restartCount == 1 {
+		restarts = "restart"
+	}
+	stats := fmt.Sprintf(" — %d %s", t.restartCount, restarts)
+	if !t.exited {
+		stats += fmt.Sprintf(" — up %s", time.Since(t.lastStartedAt).Truncate(time.Second))
+		if t.pid != 0 {
+			stats += fmt.Sprintf(" — PID %d", t.pid)
+		}
+	}
+	if t.usage != nil {
+		stats += fmt.Sprintf(" — Mem: %.0fMB  CPU: %.1f%%", t.usage.MemoryMB, t.usage.CPUPercent)
+	}
+	return statsStyle.Render(stats)
 }
 
 // styledStatus returns the status text with appropriate styling.
-func (m Model) styledStatus() string {
-	status := strings.ToLower(m.status)
+func (t *taskModel) styledStatus() string {
+	status := strings.ToLower(t.status)
 
 	switch {
+	case strings.Contains(status, "fail"), strings.Contains(status, "crashed ("),
+		strings.HasPrefix(status, "error:"), strings.HasPrefix(status, "exited with code"),
+		strings.HasPrefix(status, "killed by"):
+		return statusStopped.Render("✗ " + t.status)
 	case strings.Contains(status, "running"):
-		return statusRunning.Render("● " + m.status)
-	case strings.Contains(status, "restart"):
-		return statusRestarting.Render("◐ " + m.status)
+		return statusRunning.Render("● " + t.status)
+	case strings.HasPrefix(status, "exited cleanly"):
+		return statusRunning.Render("✓ " + t.status)
+	case strings.Contains(status, "restart"), strings.Contains(status, "build"),
+		strings.HasPrefix(status, "starting ("):
+		return statusRestarting.Render("◐ " + t.status)
 	case strings.Contains(status, "stop"):
-		return statusStopped.Render("○ " + m.status)
+		return statusStopped.Render("○ " + t.status)
 	default:
 		return lipgloss.NewStyle().
 			Foreground(lipgloss.Color("#888888")).
-			Render("◌ " + m.status)
+			Render("◌ " + t.status)
 	}
 }
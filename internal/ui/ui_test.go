@@ -0,0 +1,121 @@
+package ui
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// newTestModel returns a ready model with one task keeping up to maxLines
+// lines.
+func newTestModel(maxLines int) (Model, *taskModel) {
+	m := New(Options{MaxLogLines: maxLines})
+	next, _ := m.Update(tea.WindowSizeMsg{Width: 100, Height: 40})
+	m = next.(Model)
+	return m, m.tasks[""]
+}
+
+// output sends line to the task and refreshes its pane, as the refresh
+// tick would.
+func output(m Model, line string, stderr bool) Model {
+	next, _ := m.Update(ProcessOutputLineMsg{Line: line, Stderr: stderr, Time: time.Unix(0, 0)})
+	next, _ = next.Update(refreshMsg{})
+	return next.(Model)
+}
+
+func TestRefreshAppendsLikeRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxLines int
+		filter   func(*Model)
+	}{
+		{"every line", 0, func(*Model) {}},
+		{"errors only", 0, func(m *Model) { m.errorsOnly = true }},
+		{"search", 0, func(m *Model) { m.query = "7" }},
+		{"timestamps", 0, func(m *Model) { m.timestamps = TimestampsWall }},
+		{"lines dropped", 20, func(*Model) {}},
+		{"lines dropped, errors only", 20, func(m *Model) { m.errorsOnly = true }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, task := newTestModel(tt.maxLines)
+			tt.filter(&m)
+			m.refreshAll()
+			for i := range 50 {
+				m = output(m, fmt.Sprintf("line %d", i), i%3 == 0)
+			}
+
+			got, shown := task.content(), task.shown
+			task.render(m.filter())
+			if want := task.content(); got != want {
+				t.Errorf("content after appending differs from a full render\ngot:\n%s\nwant:\n%s", got, want)
+			}
+			if shown != task.shown {
+				t.Errorf("shown = %d after appending, want %d", shown, task.shown)
+			}
+		})
+	}
+}
+
+func TestRefreshAfterFilterChange(t *testing.T) {
+	m, task := newTestModel(0)
+	for i := range 10 {
+		m = output(m, fmt.Sprintf("line %d", i), i == 4)
+	}
+	m.errorsOnly = true
+	m.refreshAll()
+	m = output(m, "failed", true)
+	m = output(m, "ok", false)
+	if got, want := task.content(), stderrStyle.Render("line 4")+"\n"+stderrStyle.Render("failed"); got != want {
+		t.Errorf("content = %q, want %q", got, want)
+	}
+}
+
+func TestRefreshAfterBurst(t *testing.T) {
+	tests := []struct {
+		name  string
+		burst int // Lines pushed between refreshes
+	}{
+		{"fewer than the limit", 15},
+		{"more than the limit", 45},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, task := newTestModel(20)
+			for i := range 30 {
+				m = output(m, fmt.Sprintf("line %d", i), false)
+			}
+			for i := range tt.burst {
+				m.push(task, logLine{text: fmt.Sprintf("burst %d", i), plain: fmt.Sprintf("burst %d", i)})
+			}
+			task.refresh(m.filter())
+
+			got, shown := task.content(), task.shown
+			task.render(m.filter())
+			if want := task.content(); got != want {
+				t.Errorf("content after the burst differs from a full render\ngot:\n%s\nwant:\n%s", got, want)
+			}
+			if shown != 20 || task.shown != 20 {
+				t.Errorf("shown = %d after the burst, %d after a render; want 20", shown, task.shown)
+			}
+		})
+	}
+}
+
+// BenchmarkAppendLine appends to a pane whose logs are full, so every line
+// drops the oldest, as in a long verbose run.
+func BenchmarkAppendLine(b *testing.B) {
+	m, task := newTestModel(DefaultMaxLogLines)
+	for i := range DefaultMaxLogLines + 100 {
+		m.push(task, logLine{text: fmt.Sprintf("line %d", i), plain: fmt.Sprintf("line %d", i)})
+	}
+	task.refresh(m.filter())
+
+	b.ResetTimer()
+	for i := range b.N {
+		m.push(task, logLine{text: fmt.Sprintf("line %d", i), plain: fmt.Sprintf("line %d", i)})
+		task.refresh(m.filter())
+	}
+}
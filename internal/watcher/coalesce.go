@@ -0,0 +1,93 @@
+package watcher
+
+import "time"
+
+// Coalesce groups the events from ch into batches. A batch starts with the
+// first event to arrive and takes in every event that follows within
+// window of it, so a bulk operation such as git stash pop is delivered as
+// one batch rather than hundreds of events. A batch holds at most one event
+// per path, with the latest operation. With a window of zero or less, a
+// batch holds just the events already waiting on ch.
+//
+// The returned channel is closed once ch is closed and the last batch has
+// been delivered.
+func Coalesce(ch <-chan Event, window time.Duration) <-chan []Event {
+	out := make(chan []Event)
+
+	go func() {
+		defer close(out)
+
+		for first := range ch {
+			b := batch{}
+			b.add(first)
+
+			open := true
+			if window > 0 {
+				deadline := time.NewTimer(window)
+			collect:
+				for {
+					select {
+					case ev, ok := <-ch:
+						if !ok {
+							open = false
+							break collect
+						}
+						b.add(ev)
+					case <-deadline.C:
+						break collect
+					}
+				}
+				deadline.Stop()
+			} else {
+			drain:
+				for {
+					select {
+					case ev, ok := <-ch:
+						if !ok {
+							open = false
+							break drain
+						}
+						b.add(ev)
+					default:
+						break drain
+					}
+				}
+			}
+
+			out <- b.events
+			if !open {
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// replaceEvent returns the event to keep when ev follows prev for the same
+// path: ev, with the diffs of both changes if both have one.
+func replaceEvent(prev, ev Event) Event {
+	if prev.Diff != "" && ev.Diff != "" {
+		ev.Diff = prev.Diff + ev.Diff
+	}
+	return ev
+}
+
+// batch collects events in arrival order, keeping one per path.
+type batch struct {
+	events []Event
+	index  map[string]int // Path to position in events
+}
+
+// add appends ev, or replaces the earlier event for the same path.
+func (b *batch) add(ev Event) {
+	if i, ok := b.index[ev.Path]; ok {
+		b.events[i] = replaceEvent(b.events[i], ev)
+		return
+	}
+	if b.index == nil {
+		b.index = make(map[string]int)
+	}
+	b.index[ev.Path] = len(b.events)
+	b.events = append(b.events, ev)
+}
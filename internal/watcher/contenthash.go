@@ -0,0 +1,97 @@
+package watcher
+
+import (
+	"container/list"
+	"hash/maphash"
+	"io"
+	"os"
+)
+
+// maxHashSize is the largest file whose content is compared. Hashing a
+// bigger one on every write costs more than the restart it might save.
+const maxHashSize = 5 << 20 // 5 MB
+
+// hashCacheSize is how many files' hashes are remembered.
+const hashCacheSize = 1024
+
+// contentHashes remembers a hash of the content of recently changed files,
+// so a write that leaves a file as it was can be told apart from a real
+// change. The least recently changed files are forgotten first. It is
+// only used by the event goroutine.
+type contentHashes struct {
+	seed    maphash.Seed
+	entries map[string]*list.Element
+	order   *list.List // Most recently changed at the front
+}
+
+// hashEntry is an element of contentHashes.order.
+type hashEntry struct {
+	path string
+	sum  uint64
+}
+
+func newContentHashes() *contentHashes {
+	return &contentHashes{
+		seed:    maphash.MakeSeed(),
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// changed hashes the file at path and reports whether its content differs
+// from the last time. A file seen for the first time, one too big to hash,
+// or one that can't be read counts as changed.
+func (c *contentHashes) changed(path string) bool {
+	sum, ok := c.hash(path)
+	if !ok {
+		c.forget(path)
+		return true
+	}
+
+	if el, ok := c.entries[path]; ok {
+		c.order.MoveToFront(el)
+		entry := el.Value.(*hashEntry)
+		if entry.sum == sum {
+			return false
+		}
+		entry.sum = sum
+		return true
+	}
+
+	c.entries[path] = c.order.PushFront(&hashEntry{path: path, sum: sum})
+	if c.order.Len() > hashCacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*hashEntry).path)
+	}
+	return true
+}
+
+// forget drops what is remembered about path, e.g. once it is deleted.
+func (c *contentHashes) forget(path string) {
+	if el, ok := c.entries[path]; ok {
+		c.order.Remove(el)
+		delete(c.entries, path)
+	}
+}
+
+// hash returns the hash of the content of the regular file at path. It
+// reports false for anything it won't or can't hash.
+func (c *contentHashes) hash(path string) (uint64, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() || info.Size() > maxHashSize {
+		return 0, false
+	}
+
+	var h maphash.Hash
+	h.SetSeed(c.seed)
+	if _, err := io.Copy(&h, f); err != nil {
+		return 0, false
+	}
+	return h.Sum64(), true
+}
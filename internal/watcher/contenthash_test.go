@@ -0,0 +1,55 @@
+package watcher
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestContentHashesChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	c := newContentHashes()
+	steps := []struct {
+		content string
+		want    bool
+	}{
+		{"one", true}, // First seen
+		{"one", false},
+		{"two", true},
+		{"two", false},
+		{"one", true},
+	}
+	for i, step := range steps {
+		writeFile(t, path, step.content)
+		if got := c.changed(path); got != step.want {
+			t.Errorf("step %d, content %q: changed = %v, want %v", i+1, step.content, got, step.want)
+		}
+	}
+
+	c.forget(path)
+	if !c.changed(path) {
+		t.Error("a forgotten file doesn't count as changed")
+	}
+	if !c.changed(filepath.Join(t.TempDir(), "missing.txt")) {
+		t.Error("a missing file doesn't count as changed")
+	}
+}
+
+func TestContentHashesEvictsOldest(t *testing.T) {
+	dir := t.TempDir()
+	c := newContentHashes()
+	for i := range hashCacheSize + 1 {
+		path := filepath.Join(dir, fmt.Sprintf("%d.txt", i))
+		writeFile(t, path, "same")
+		c.changed(path)
+	}
+	if len(c.entries) != hashCacheSize || c.order.Len() != hashCacheSize {
+		t.Fatalf("cache holds %d entries in a list of %d, want %d", len(c.entries), c.order.Len(), hashCacheSize)
+	}
+	if !c.changed(filepath.Join(dir, "0.txt")) {
+		t.Error("the oldest file is still remembered")
+	}
+	if c.changed(filepath.Join(dir, fmt.Sprintf("%d.txt", hashCacheSize))) {
+		t.Error("the newest file was forgotten")
+	}
+}
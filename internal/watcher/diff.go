@@ -0,0 +1,187 @@
+package watcher
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is how many unchanged lines surround each hunk of a diff.
+const diffContext = 3
+
+// maxDiffCells caps the work of matching up the changed lines of two
+// versions of a file, as the product of their line counts. Past it the
+// changed lines are shown removed and then added as one block.
+const maxDiffCells = 1 << 20
+
+// noNewline follows a line of a diff that is the last of its file and has
+// no line ending, as diff -u and patch expect.
+const noNewline = "\\ No newline at end of file\n"
+
+// edit is a line of a diff: kept (' '), removed ('-') or added ('+'). The
+// line keeps its line ending, so a file that gains or loses its final
+// newline differs in its last line.
+type edit struct {
+	op   byte
+	line string
+}
+
+// unifiedDiff returns the changes from old to new as a unified diff of the
+// file name, or "" if their lines are the same.
+func unifiedDiff(name, old, new string) string {
+	edits := diffLines(splitLines(old), splitLines(new))
+
+	var b strings.Builder
+	oldLine, newLine := 0, 0 // Lines of each version before edits[i]
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+
+		// A hunk runs from the context before this change to the context
+		// after the last change no more than two contexts' worth of
+		// unchanged lines further on
+		start := max(0, i-diffContext)
+		end, kept := i, 0
+		for j := i; j < len(edits) && kept <= 2*diffContext; j++ {
+			if edits[j].op == ' ' {
+				kept++
+			} else {
+				end, kept = j, 0
+			}
+		}
+		end = min(len(edits), end+diffContext+1)
+
+		oldStart, newStart := oldLine-(i-start), newLine-(i-start)
+		oldCount, newCount := 0, 0
+		for _, e := range edits[start:end] {
+			if e.op != '+' {
+				oldCount++
+			}
+			if e.op != '-' {
+				newCount++
+			}
+		}
+		if b.Len() == 0 {
+			fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", name, name)
+		}
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, e := range edits[start:end] {
+			b.WriteByte(e.op)
+			b.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				b.WriteByte('\n')
+				b.WriteString(noNewline)
+			}
+		}
+
+		oldLine, newLine = oldStart+oldCount, newStart+newCount
+		i = end
+	}
+	return b.String()
+}
+
+// hunkRange formats the lines a hunk covers in one version, counting from
+// 1, as a hunk header does: "start,count", or just "start" for one line. A
+// hunk with no lines names the line before it.
+func hunkRange(before, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", before)
+	case 1:
+		return fmt.Sprint(before + 1)
+	default:
+		return fmt.Sprintf("%d,%d", before+1, count)
+	}
+}
+
+// splitLines splits text into lines, each with its line ending but the
+// last if the text doesn't end with one.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the edits that turn a into b, keeping as many lines as
+// it can. The lines the two have in common at the start and the end are
+// set aside first, which leaves little to match for a typical edit.
+func diffLines(a, b []string) []edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits := make([]edit, 0, len(a)+len(b)-prefix-suffix)
+	for _, line := range a[:prefix] {
+		edits = append(edits, edit{' ', line})
+	}
+	edits = append(edits, matchLines(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		edits = append(edits, edit{' ', line})
+	}
+	return edits
+}
+
+// matchLines finds a longest common subsequence of a and b and returns
+// the edits around it, or, if that would take more than maxDiffCells of
+// work, all of a removed and all of b added.
+func matchLines(a, b []string) []edit {
+	var edits []edit
+	if len(a)*len(b) > maxDiffCells {
+		for _, line := range a {
+			edits = append(edits, edit{'-', line})
+		}
+		for _, line := range b {
+			edits = append(edits, edit{'+', line})
+		}
+		return edits
+	}
+
+	// common[i][j] is the length of the longest common subsequence of
+	// a[i:] and b[j:]
+	common := make([][]int32, len(a)+1)
+	for i := range common {
+		common[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i++
+			j++
+		case common[i+1][j] >= common[i][j+1]:
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		edits = append(edits, edit{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, edit{'+', b[j]})
+	}
+	return edits
+}
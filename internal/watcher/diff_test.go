@@ -0,0 +1,117 @@
+package watcher
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// numbered returns the lines from to to, one number per line.
+func numbered(from, to int) string {
+	var b strings.Builder
+	for i := from; i <= to; i++ {
+		fmt.Fprintf(&b, "%d\n", i)
+	}
+	return b.String()
+}
+
+var diffCases = []struct {
+	name     string
+	old, new string
+}{
+	{"change", "a\nb\nc\n", "a\nB\nc\n"},
+	{"insert at start", "a\nb\n", "new\na\nb\n"},
+	{"delete at end", "a\nb\nc\n", "a\nb\n"},
+	{"from empty", "", "a\nb\n"},
+	{"to empty", "a\nb\n", ""},
+	{"separate hunks", numbered(1, 40), strings.Replace(strings.Replace(numbered(1, 40), "5\n", "five\n", 1), "30\n", "thirty\n", 1)},
+	{"hunks merged across six lines", numbered(1, 20), strings.Replace(strings.Replace(numbered(1, 20), "3\n", "x\n", 1), "10\n", "y\n", 1)},
+	{"hunks split across seven lines", numbered(1, 20), strings.Replace(strings.Replace(numbered(1, 20), "3\n", "x\n", 1), "11\n", "y\n", 1)},
+	{"add final newline", "a\nb", "a\nb\n"},
+	{"remove final newline", "a\nb\n", "a\nb"},
+	{"change last line without newline", "a\nb", "a\nc"},
+	{"unchanged last line without newline", "a\nb\nc\nd", "A\nb\nc\nd"},
+}
+
+func TestUnifiedDiffMatchesDiff(t *testing.T) {
+	if _, err := exec.LookPath("diff"); err != nil {
+		t.Skip("diff not found")
+	}
+	dir := t.TempDir()
+	for _, tt := range diffCases {
+		t.Run(tt.name, func(t *testing.T) {
+			oldPath, newPath := filepath.Join(dir, "old"), filepath.Join(dir, "new")
+			os.WriteFile(oldPath, []byte(tt.old), 0o644)
+			os.WriteFile(newPath, []byte(tt.new), 0o644)
+			out, _ := exec.Command("diff", "-u", oldPath, newPath).Output()
+
+			got := unifiedDiff("f.txt", tt.old, tt.new)
+			header := "--- a/f.txt\n+++ b/f.txt\n"
+			if !strings.HasPrefix(got, header) {
+				t.Fatalf("diff doesn't start with the file header:\n%s", got)
+			}
+			// diff -u headers carry the paths and times; compare the hunks
+			_, want, _ := strings.Cut(string(out), "\n+++ ")
+			_, want, _ = strings.Cut(want, "\n")
+			if hunks := strings.TrimPrefix(got, header); hunks != want {
+				t.Errorf("hunks differ from diff -u\ngot:\n%s\nwant:\n%s", hunks, want)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiffSameContent(t *testing.T) {
+	for _, text := range []string{"", "a\n", "a\nb", numbered(1, 100)} {
+		if got := unifiedDiff("f.txt", text, text); got != "" {
+			t.Errorf("unifiedDiff of %q with itself = %q, want \"\"", text, got)
+		}
+	}
+}
+
+// TestUnifiedDiffApplies checks that patch turns the old version into the
+// new one with the diff, for edits made at random.
+func TestUnifiedDiffApplies(t *testing.T) {
+	if _, err := exec.LookPath("patch"); err != nil {
+		t.Skip("patch not found")
+	}
+	dir := t.TempDir()
+	rng := rand.New(rand.NewSource(1))
+	for i := range 50 {
+		lines := splitLines(numbered(1, 30))
+		var edited []string
+		for _, line := range lines {
+			switch rng.Intn(8) {
+			case 0: // Drop it
+			case 1:
+				edited = append(edited, "changed "+line)
+			case 2:
+				edited = append(edited, line, "inserted\n")
+			default:
+				edited = append(edited, line)
+			}
+		}
+		old, new := strings.Join(lines, ""), strings.Join(edited, "")
+		if rng.Intn(2) == 0 {
+			new = strings.TrimSuffix(new, "\n")
+		}
+		diff := unifiedDiff("f.txt", old, new)
+		if diff == "" {
+			continue
+		}
+
+		oldPath, diffPath, outPath := filepath.Join(dir, "old"), filepath.Join(dir, "diff"), filepath.Join(dir, "out")
+		os.WriteFile(oldPath, []byte(old), 0o644)
+		os.WriteFile(diffPath, []byte(diff), 0o644)
+		os.Remove(outPath)
+		if out, err := exec.Command("patch", "-s", "-o", outPath, oldPath, "-i", diffPath).CombinedOutput(); err != nil {
+			t.Fatalf("case %d: patch failed: %v\n%s\ndiff:\n%s", i, err, out, diff)
+		}
+		if got, _ := os.ReadFile(outPath); string(got) != new {
+			t.Fatalf("case %d: patched file differs\ngot:\n%q\nwant:\n%q\ndiff:\n%s", i, got, new, diff)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package watcher
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// gitignore holds the rules from every .gitignore file found under a watch
+// root, keyed by the file's directory so reading one again replaces its
+// rules. For any path the last matching rule decides, with the rules of
+// deeper files read after those of their parents, as in git.
+type gitignore struct {
+	rules map[string][]gitignoreRule // Rules per directory, as gitignoreRule.base
+}
+
+// gitignoreRule is a single pattern line from a .gitignore file.
+type gitignoreRule struct {
+	base     string   // Directory holding the .gitignore, slash-separated and relative to the root ("" for the root)
+	segments []string // Pattern split on "/"
+	negate   bool     // Pattern started with "!"
+	dirOnly  bool     // Pattern ended with "/"
+	anchored bool     // Pattern contained a "/" other than a trailing one
+}
+
+// load reads the .gitignore in dir, if any, in place of the rules read from
+// it before. rel is dir relative to the watch root.
+func (g *gitignore) load(dir, rel string) error {
+	return g.loadFile(filepath.Join(dir, ".gitignore"), rel)
+}
+
+// loadFile reads a file in .gitignore syntax in place of the rules read
+// from its directory before, which are dropped if it no longer exists. rel
+// is the file's directory relative to the watch root.
+func (g *gitignore) loadFile(name, rel string) error {
+	base := gitignoreBase(rel)
+	f, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			delete(g.rules, base)
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	var rules []gitignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseGitignoreLine(scanner.Text(), base); ok {
+			rules = append(rules, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		delete(g.rules, base)
+		return nil
+	}
+	if g.rules == nil {
+		g.rules = make(map[string][]gitignoreRule)
+	}
+	g.rules[base] = rules
+	return nil
+}
+
+// drop forgets the rules read from rel, relative to the watch root, and
+// from every directory below it.
+func (g *gitignore) drop(rel string) {
+	if g == nil {
+		return
+	}
+	base := gitignoreBase(rel)
+	for dir := range g.rules {
+		if base == "" || dir == base || strings.HasPrefix(dir, base+"/") {
+			delete(g.rules, dir)
+		}
+	}
+}
+
+// gitignoreBase returns rel in the form of gitignoreRule.base.
+func gitignoreBase(rel string) string {
+	base := filepath.ToSlash(rel)
+	if base == "." {
+		return ""
+	}
+	return base
+}
+
+// parseGitignoreLine parses one line of a .gitignore file. It reports false
+// for blank lines and comments.
+func parseGitignoreLine(line, base string) (gitignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return gitignoreRule{}, false
+	}
+
+	rule := gitignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		// "\#" and "\!" escape a literal leading character
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return gitignoreRule{}, false
+	}
+
+	rule.segments = strings.Split(line, "/")
+	return rule, true
+}
+
+// ignored reports whether rel (slash-separated, relative to the watch root)
+// is ignored. A path inside an ignored directory is always ignored, since git
+// can't re-include files below an excluded directory.
+func (g *gitignore) ignored(rel string, isDir bool) bool {
+	if g == nil || len(g.rules) == 0 {
+		return false
+	}
+
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if g.matches(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return g.matches(rel, isDir)
+}
+
+// matches applies the rules to a single path without looking at its parents.
+// Only the .gitignore files in the directories above rel can hold rules for
+// it, and they are applied from the root down.
+func (g *gitignore) matches(rel string, isDir bool) bool {
+	ignored := false
+	parts := strings.Split(rel, "/")
+	for i := range parts {
+		for _, rule := range g.rules[strings.Join(parts[:i], "/")] {
+			if rule.match(rel, isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// match reports whether the rule's pattern matches rel.
+func (r gitignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	// Rules only apply below the directory of their .gitignore
+	if r.base != "" {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = strings.TrimPrefix(rel, r.base+"/")
+	}
+
+	if !r.anchored {
+		// A pattern without a slash matches the name at any depth
+		ok, _ := path.Match(r.segments[0], path.Base(rel))
+		return ok
+	}
+	return matchSegments(r.segments, strings.Split(rel, "/"))
+}
@@ -0,0 +1,58 @@
+package watcher
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+)
+
+// DirCount is a directory the watcher would watch, with the number of files
+// in it whose changes it would report.
+type DirCount struct {
+	Dir   string
+	Files int
+}
+
+// List walks rootPaths with the same rules as New, without watching
+// anything, and returns the directories New would watch in the order they
+// are found. Options that only change how changes are picked up, such as
+// WithPolling, make no difference.
+func List(rootPaths []string, patterns []string, opts ...Option) ([]DirCount, error) {
+	t, err := newTree(rootPaths, patterns, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []DirCount
+	index := make(map[string]int) // Directory to its place in dirs
+	for _, root := range t.roots {
+		if err := t.resetIgnores(root); err != nil {
+			return nil, err
+		}
+		err := t.walkTree(root, root, func(path string) error {
+			index[path] = len(dirs)
+			dirs = append(dirs, DirCount{Dir: path})
+			return nil
+		}, func(path string, d fs.DirEntry) {
+			i, ok := index[filepath.Dir(path)]
+			if _, accepted := t.accept(path, Create); ok && accepted {
+				dirs[i].Files++
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dirs, nil
+}
+
+// IgnoredDirs returns the names of the directories that are never watched,
+// wherever they are, sorted.
+func IgnoredDirs() []string {
+	names := make([]string, 0, len(ignoredDirs))
+	for name := range ignoredDirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,126 @@
+package watcher
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// matcher decides whether a changed file should trigger an event.
+//
+// Each pattern is one of:
+//   - a plain suffix such as ".go" or "Makefile", matched with strings.HasSuffix
+//   - a glob such as "*.config.js", "src/*.ts" or "**/*.go"
+//   - a negated glob prefixed with "!", such as "!**/*.test.ts"
+//
+// Globs containing a "/" are matched against the path relative to the watch
+// root; globs without one are matched against the file's base name.
+// "**" matches any number of directories, including none, so an exclude
+// pattern such as "!**/tmp/**" also prunes the tmp directory itself.
+type matcher struct {
+	include []string
+	exclude []string
+}
+
+// newMatcher splits patterns into include and exclude lists.
+func newMatcher(patterns []string) matcher {
+	var m matcher
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "!") {
+			m.exclude = append(m.exclude, p[1:])
+		} else {
+			m.include = append(m.include, p)
+		}
+	}
+	return m
+}
+
+// Filter matches file paths against a list of patterns, using the same
+// rules as the patterns given to New. It lets callers route events further,
+// e.g. to the tasks whose patterns they match.
+type Filter struct {
+	m matcher
+}
+
+// NewFilter creates a Filter from patterns.
+func NewFilter(patterns []string) Filter {
+	return Filter{m: newMatcher(patterns)}
+}
+
+// Match reports whether ev's file matches the filter's patterns, evaluated
+// relative to the event's watch root.
+func (f Filter) Match(ev Event) bool {
+	rel, err := filepath.Rel(ev.Root, ev.Path)
+	if err != nil {
+		rel = ev.Path
+	}
+	return f.m.match(rel)
+}
+
+// match reports whether the file at name (relative to the watch root)
+// matches at least one include pattern and no exclude pattern.
+func (m matcher) match(name string) bool {
+	if m.excluded(name) {
+		return false
+	}
+
+	rel := filepath.ToSlash(filepath.Clean(name))
+	for _, p := range m.include {
+		if matchPattern(p, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// excluded reports whether name (relative to the watch root) matches any
+// exclude pattern. It is used to prune whole directories while walking.
+func (m matcher) excluded(name string) bool {
+	rel := filepath.ToSlash(filepath.Clean(name))
+	for _, p := range m.exclude {
+		if matchPattern(p, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasWildcard reports whether the pattern uses any glob metacharacters.
+func hasWildcard(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// matchPattern matches a single pattern against a slash-separated path.
+func matchPattern(pattern, rel string) bool {
+	if !hasWildcard(pattern) {
+		return strings.HasSuffix(rel, pattern)
+	}
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments matches pattern segments against path segments,
+// treating "**" as zero or more whole segments.
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
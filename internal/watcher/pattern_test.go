@@ -0,0 +1,70 @@
+package watcher
+
+import "testing"
+
+func TestMatcher(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		want     bool
+	}{
+		{"suffix", []string{".go"}, "main.go", true},
+		{"suffix in subdirectory", []string{".go"}, "cmd/reflex/main.go", true},
+		{"suffix mismatch", []string{".go"}, "main.js", false},
+		{"file name", []string{"Makefile"}, "Makefile", true},
+		{"base name glob", []string{"*.config.js"}, "web/vite.config.js", true},
+		{"base name glob mismatch", []string{"*.config.js"}, "web/vite.js", false},
+
+		{"doublestar at root", []string{"**/*.go"}, "main.go", true},
+		{"doublestar nested", []string{"**/*.go"}, "internal/watcher/pattern.go", true},
+		{"doublestar wrong extension", []string{"**/*.go"}, "internal/watcher/README.md", false},
+
+		{"directory glob", []string{"src/*.ts"}, "src/app.ts", true},
+		{"directory glob too deep", []string{"src/*.ts"}, "src/lib/app.ts", false},
+		{"directory glob other directory", []string{"src/*.ts"}, "test/app.ts", false},
+
+		{"doublestar in the middle", []string{"src/**/*.ts"}, "src/a/b/app.ts", true},
+		{"doublestar in the middle matching no directory", []string{"src/**/*.ts"}, "src/app.ts", true},
+		{"doublestar in the middle under another directory", []string{"src/**/*.ts"}, "lib/src/app.ts", false},
+		{"trailing doublestar", []string{"docs/**"}, "docs/guide/intro.md", true},
+		{"doublestar segment is whole", []string{"**/gen/*.go"}, "pkg/generated/a.go", false},
+
+		{"extension kept past doublestar exclude", []string{".go", "!**/testdata/**"}, "pkg/parse.go", true},
+		{"doublestar exclude inside allow list", []string{".go", "!**/testdata/**"}, "pkg/testdata/in.go", false},
+		{"doublestar exclude at root", []string{".go", "!**/testdata/**"}, "testdata/in.go", false},
+		{"doublestar include outside allow list", []string{".go", "web/**/*.ts"}, "web/src/app.ts", true},
+		{"allow list not widened by doublestar", []string{".go", "web/**/*.ts"}, "web/src/app.js", false},
+
+		{"negated glob excludes", []string{".ts", "!**/*.test.ts"}, "src/app.test.ts", false},
+		{"negated glob keeps others", []string{".ts", "!**/*.test.ts"}, "src/app.ts", true},
+		{"negated glob at root", []string{".ts", "!**/*.test.ts"}, "app.test.ts", false},
+		{"only a negation matches nothing", []string{"!**/*.test.ts"}, "src/app.ts", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newMatcher(tt.patterns).match(tt.path); got != tt.want {
+				t.Errorf("match(%q) with %q = %v, want %v", tt.path, tt.patterns, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatcherExcluded(t *testing.T) {
+	m := newMatcher([]string{".go", "!**/tmp/**"})
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"tmp", true},
+		{"pkg/tmp", true},
+		{"pkg/tmp/gen.go", true},
+		{"pkg", false},
+		{"pkg/tmpl.go", false},
+	}
+	for _, tt := range tests {
+		if got := m.excluded(tt.path); got != tt.want {
+			t.Errorf("excluded(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package watcher
+
+import (
+	"io/fs"
+	"sort"
+	"time"
+
+	"github.com/Codimow/Reflex/internal/logging"
+)
+
+// DefaultPollInterval is how often a polling watcher scans the tree when
+// WithPolling isn't given an interval.
+const DefaultPollInterval = 500 * time.Millisecond
+
+// maxPolledFiles caps how many files a polling watcher tracks. Each one
+// costs around 150 bytes with its path, so the cap keeps an enormous tree
+// to about 15 MB; files beyond it aren't watched.
+const maxPolledFiles = 100_000
+
+// WithPolling scans the watched tree every interval instead of waiting for
+// file system notifications, which bind mounts from another OS and network
+// file systems don't deliver. Files are compared by modification time and
+// size. Zero or negative means DefaultPollInterval.
+func WithPolling(interval time.Duration) Option {
+	return func(t *tree) {
+		if interval <= 0 {
+			interval = DefaultPollInterval
+		}
+		t.pollInterval = interval
+	}
+}
+
+// fileStamp is what a polling scan compares to spot a changed file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func (s fileStamp) changed(other fileStamp) bool {
+	return s.size != other.size || !s.modTime.Equal(other.modTime)
+}
+
+// scan walks every root and records the files that aren't ignored. The
+// .gitignore and .reflexignore rules are read afresh each time, so edits to
+// them apply.
+func (t *tree) scan() (map[string]fileStamp, error) {
+	files := make(map[string]fileStamp)
+	for _, root := range t.roots {
+		if err := t.resetIgnores(root); err != nil {
+			return nil, err
+		}
+		err := t.walkTree(root, root, func(string) error { return nil }, func(path string, d fs.DirEntry) {
+			if len(files) >= maxPolledFiles {
+				if !t.pollCapped {
+					t.pollCapped = true
+					logging.Printf("watcher: more than %d files to poll; changes to the rest are missed, narrow --watch or add ignores", maxPolledFiles)
+				}
+				return
+			}
+			info, err := d.Info()
+			if err != nil {
+				return
+			}
+			files[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// poll scans the tree every interval and delivers the differences from the
+// previous scan, starting from files. Like the fsnotify loop, events wait
+// in a queue that collapses repeats until the consumer takes them.
+func (t *tree) poll(files map[string]fileStamp, eventChan chan<- Event) {
+	defer close(eventChan)
+
+	ticker := time.NewTicker(t.pollInterval)
+	defer ticker.Stop()
+
+	var q queue
+	var lastErr string
+	for {
+		// Only offer an event to the consumer when one is waiting
+		var out chan<- Event
+		var next Event
+		if q.len() > 0 {
+			out = eventChan
+			next = q.peek()
+		}
+
+		select {
+		case out <- next:
+			q.pop()
+
+		case <-ticker.C:
+			current, err := t.scan()
+			if err != nil {
+				// Keep the last good scan rather than reporting everything
+				// past the failure as removed, and say so once per error
+				if err.Error() != lastErr {
+					lastErr = err.Error()
+					logging.Printf("watcher error: %v", err)
+				}
+				continue
+			}
+			lastErr = ""
+			for _, ev := range t.diff(files, current) {
+				q.push(ev)
+			}
+			files = current
+		}
+	}
+}
+
+// diff returns the events for the differences between two scans, in path
+// order.
+func (t *tree) diff(before, after map[string]fileStamp) []Event {
+	var paths []string
+	ops := make(map[string]Op)
+	for path, stamp := range after {
+		old, ok := before[path]
+		switch {
+		case !ok:
+			ops[path] = Create
+		case old.changed(stamp):
+			ops[path] = Write
+		default:
+			continue
+		}
+		paths = append(paths, path)
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			ops[path] = Remove
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var events []Event
+	for _, path := range paths {
+		op := ops[path]
+		ev, ok := t.accept(path, op)
+		if !ok {
+			continue
+		}
+		if t.hashes != nil {
+			if op == Remove {
+				t.hashes.forget(path)
+			} else if !t.hashes.changed(path) {
+				continue
+			}
+		}
+		if op == Remove && t.snapshots != nil {
+			t.snapshots.forget(path)
+		}
+		events = append(events, t.withDiff(ev))
+	}
+	return events
+}
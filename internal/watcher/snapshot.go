@@ -0,0 +1,106 @@
+package watcher
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// maxSnapshotSize is the largest file kept to diff against. A diff of a
+// bigger one is rarely worth reading.
+const maxSnapshotSize = 256 << 10 // 256 KB
+
+// maxSnapshotTotal caps the content kept across all files. A file that
+// doesn't fit when the tree is walked is kept once it changes, so only its
+// first diff is missed.
+const maxSnapshotTotal = 64 << 20 // 64 MB
+
+// snapshots keeps the content of the watched text files, so a change can
+// be shown as a diff from what the file held before: by the time a write
+// is reported, the old content is gone from the disk. It is only used by
+// the event goroutine. Paths are cleaned, since the walk and fsnotify
+// spell them differently.
+type snapshots struct {
+	content map[string]string
+	size    int // Total length of content
+}
+
+func newSnapshots() *snapshots {
+	return &snapshots{content: make(map[string]string)}
+}
+
+// remember keeps the content of the file at path, if it is a text file and
+// there is room for it.
+func (s *snapshots) remember(path string) {
+	if text, ok := readText(path); ok {
+		s.keep(filepath.Clean(path), text)
+	}
+}
+
+// diff returns a unified diff from the kept content of the file at path to
+// what it holds now, and keeps the new content. A file that wasn't kept
+// before is diffed from empty if created is set, and otherwise gets no
+// diff. So does a file that isn't text, or is too big.
+func (s *snapshots) diff(root, path string, created bool) string {
+	text, ok := readText(path)
+	if !ok {
+		s.forget(path)
+		return ""
+	}
+	key := filepath.Clean(path)
+	old, had := s.content[key]
+	s.keep(key, text)
+	if !had && !created {
+		return ""
+	}
+
+	name, err := filepath.Rel(root, path)
+	if err != nil {
+		name = path
+	}
+	return unifiedDiff(filepath.ToSlash(name), old, text)
+}
+
+// forget drops the content kept for path, e.g. once it is deleted.
+func (s *snapshots) forget(path string) {
+	path = filepath.Clean(path)
+	s.size -= len(s.content[path])
+	delete(s.content, path)
+}
+
+// keep stores text as the content of path, unless path is new and there is
+// no room left for it.
+func (s *snapshots) keep(path, text string) {
+	old, had := s.content[path]
+	if !had && s.size+len(text) > maxSnapshotTotal {
+		return
+	}
+	s.content[path] = text
+	s.size += len(text) - len(old)
+}
+
+// readText returns the content of the regular file at path. It reports
+// false for a file that is too big to keep or doesn't look like text: one
+// with a NUL byte near the start or that isn't valid UTF-8.
+func readText(path string) (string, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() || info.Size() > maxSnapshotSize {
+		return "", false
+	}
+
+	data, err := io.ReadAll(io.LimitReader(f, maxSnapshotSize+1))
+	if err != nil || len(data) > maxSnapshotSize {
+		return "", false
+	}
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 || !utf8.Valid(data) {
+		return "", false
+	}
+	return string(data), true
+}
@@ -0,0 +1,73 @@
+package watcher
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// walkFollowingLinks is filepath.WalkDir, except that symbolic links are
+// followed to the files and directories they point at, which fn sees under
+// the link's path. A directory is only walked the first time it is reached,
+// so links that loop back up the tree, or several links to one directory,
+// don't walk it again. Links that point nowhere are passed to fn as links.
+func walkFollowingLinks(root string, fn fs.WalkDirFunc) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkLinked(root, fs.FileInfoToDirEntry(info), fn, make(map[string]bool))
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkLinked walks path for walkFollowingLinks. visited holds the resolved
+// paths of the directories walked so far.
+func walkLinked(path string, d fs.DirEntry, fn fs.WalkDirFunc, visited map[string]bool) error {
+	if d.Type()&fs.ModeSymlink != 0 {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fn(path, d, nil)
+		}
+		d = fs.FileInfoToDirEntry(info)
+	}
+	if !d.IsDir() {
+		return fn(path, d, nil)
+	}
+
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		if visited[real] {
+			return nil
+		}
+		visited[real] = true
+	}
+
+	if err := fn(path, d, nil); err != nil {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		// Let fn decide, as filepath.WalkDir does
+		if err := fn(path, d, err); err != nil {
+			if err == filepath.SkipDir {
+				return nil
+			}
+			return err
+		}
+	}
+	for _, entry := range entries {
+		if err := walkLinked(filepath.Join(path, entry.Name()), entry, fn, visited); err != nil {
+			if err == filepath.SkipDir {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
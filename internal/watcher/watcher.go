@@ -1,17 +1,85 @@
 package watcher
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/Codimow/Reflex/internal/logging"
 	"github.com/fsnotify/fsnotify"
 )
 
 // Event represents a single file system event.
 type Event struct {
 	Path string // The path to the file that changed.
+	Root string // The watch root the file lives under.
+	Op   Op     // What happened to the file.
+
+	// Diff is a unified diff of the change to a text file's content, with
+	// WithDiffs; empty otherwise.
+	Diff string
+}
+
+// Op describes the kind of change behind an Event.
+type Op uint32
+
+// The operations reported on Event.Op.
+const (
+	Create Op = 1 << iota // File was created
+	Write                 // File was written to
+	Remove                // File was deleted
+	Rename                // File was renamed away; Path is the old name
+)
+
+// AllOps is every kind of change, for a set of ops that leaves none out.
+const AllOps = Create | Write | Remove | Rename
+
+// String returns a lower-case name for the operation, e.g. "write".
+func (op Op) String() string {
+	switch op {
+	case Create:
+		return "create"
+	case Write:
+		return "write"
+	case Remove:
+		return "remove"
+	case Rename:
+		return "rename"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseOp returns the Op with the given name, as String writes it.
+func ParseOp(name string) (Op, error) {
+	for _, op := range []Op{Create, Write, Remove, Rename} {
+		if op.String() == name {
+			return op, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown kind of change %q; use create, write, remove or rename", name)
+}
+
+// opFrom maps an fsnotify operation to the Op reported on events. When
+// fsnotify combines several operations the most significant one wins.
+func opFrom(op fsnotify.Op) Op {
+	switch {
+	case op.Has(fsnotify.Remove):
+		return Remove
+	case op.Has(fsnotify.Rename):
+		return Rename
+	case op.Has(fsnotify.Create):
+		return Create
+	default:
+		return Write
+	}
 }
 
 // ignoredDirs contains directory names that should be skipped during watching.
@@ -48,71 +116,275 @@ func shouldIgnoreFile(path string) bool {
 		return true
 	}
 
-	return false
+	return isEditorTempFile(base)
 }
 
-// New creates a new file system watcher and returns a channel of events.
-// It watches the given root path recursively for files with the specified extensions.
-func New(rootPath string, extensions []string) (<-chan Event, error) {
-	watcher, err := fsnotify.NewWatcher()
+// editorTempSuffixes end the names of files editors write next to the one
+// being edited: backups (file~), vim swap files, and JetBrains' safe-write
+// copies.
+var editorTempSuffixes = []string{"~", ".swp", ".swo", ".swx", "___jb_tmp___", "___jb_old___"}
+
+// isEditorTempFile reports whether base names a file an editor writes while
+// saving rather than one being edited. Editors that save by writing a
+// temporary file and renaming it over the original still produce a Create
+// event for the original, which is what triggers the restart.
+func isEditorTempFile(base string) bool {
+	for _, suffix := range editorTempSuffixes {
+		if strings.HasSuffix(base, suffix) {
+			return true
+		}
+	}
+	// Emacs lock files
+	if strings.HasPrefix(base, ".#") {
+		return true
+	}
+	// Vim checks it can write to a directory by creating a file named 4913
+	// (or 4913 plus a multiple of 123 if that exists). Other numbers, such
+	// as 2024 or 404, are names like any other.
+	if strings.Trim(base, "0123456789") != "" {
+		return false
+	}
+	n, err := strconv.Atoi(base)
+	return err == nil && n >= 4913 && (n-4913)%123 == 0
+}
+
+// Option configures optional watcher behaviour.
+type Option func(*tree)
+
+// WithoutGitignore stops the watcher from reading .gitignore files.
+func WithoutGitignore() Option {
+	return func(t *tree) {
+		t.useGitignore = false
+	}
+}
+
+// WithoutContentCheck reports every write, even one that leaves a file's
+// content as it was. By default the watcher hashes files up to 5 MB as they
+// change and drops writes that don't change the hash.
+func WithoutContentCheck() Option {
+	return func(t *tree) {
+		t.hashes = nil
+	}
+}
+
+// WithDiffs keeps the content of the watched text files, up to 256 KB
+// each, and fills in Event.Diff for a write or create with how the file's
+// content changed. The files are read when the tree is walked, since a
+// change is only reported once the old content is gone.
+func WithDiffs() Option {
+	return func(t *tree) {
+		t.snapshots = newSnapshots()
+	}
+}
+
+// WithFollowSymlinks follows symbolic links to directories and files while
+// walking the tree, so a package linked in with npm link or pnpm link is
+// watched like the rest. Each directory is only walked once, however many
+// links lead to it, and links that loop back up the tree are not followed.
+func WithFollowSymlinks() Option {
+	return func(t *tree) {
+		t.followSymlinks = true
+	}
+}
+
+// WithExcludeRegexps skips every file and directory whose path matches one
+// of the given regular expressions. Expressions are matched against the
+// absolute, slash-separated path. New reports an error if any expression
+// doesn't compile.
+func WithExcludeRegexps(exprs []string) Option {
+	return func(t *tree) {
+		t.excludeExprs = append(t.excludeExprs, exprs...)
+	}
+}
+
+// WithFiles reports changes to the given files whatever the patterns,
+// ignores and .gitignore files say, such as a .env file that no pattern
+// matches. Files outside the watch roots are still not watched.
+func WithFiles(paths []string) Option {
+	return func(t *tree) {
+		for _, path := range paths {
+			if abs, err := filepath.Abs(path); err == nil {
+				t.files[abs] = true
+			}
+		}
+	}
+}
+
+// Watcher reports changes to the files under a set of watch roots.
+type Watcher struct {
+	events <-chan Event
+	stats  Stats
+	limits <-chan WatchLimit
+}
+
+// Stats counts what a Watcher found when it first walked its roots.
+type Stats struct {
+	WatchedDirs  int // Directories watched, roots included
+	WatchedFiles int // Regular files in them, matching the patterns or not
+	IgnoredDirs  int // Directories skipped, not counting those inside them
+
+	UnwatchedDirs int // Directories left unwatched because the watch limit was reached
+}
+
+// WatchLimit tells how far the watcher got once the system's limit on
+// watches, such as fs.inotify.max_user_watches, was reached. Changes in the
+// unwatched directories are missed; the rest are still reported.
+type WatchLimit struct {
+	Watched   int // Directories being watched
+	Unwatched int // Directories that couldn't be watched, so far
+}
+
+// Events returns the channel changes are delivered on.
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+// Stats returns what the watcher found when it first walked its roots.
+// Directories created since aren't counted.
+func (w *Watcher) Stats() Stats {
+	return w.stats
+}
+
+// LimitReached delivers a WatchLimit whenever more directories go
+// unwatched for lack of watches, starting with the initial walk. Only the
+// latest is kept until it is taken.
+func (w *Watcher) LimitReached() <-chan WatchLimit {
+	return w.limits
+}
+
+// New creates a new file system watcher. It watches each of the given root
+// paths recursively for files matching the given patterns. A pattern may be
+// a plain extension or file name (".go", "Makefile"), a glob ("*.config.js",
+// "src/*.ts", "**/*.go"), or a negated glob ("!**/*.test.ts") that excludes
+// otherwise matching files.
+// Files and directories matched by .gitignore files under each root are
+// skipped unless WithoutGitignore is given, and edits to them apply as they
+// are made. So are those matched by a .reflexignore file, in the same
+// syntax, at the top of a root.
+func New(rootPaths []string, patterns []string, opts ...Option) (*Watcher, error) {
+	t, err := newTree(rootPaths, patterns, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	eventChan := make(chan Event)
+	eventChan := make(chan Event, eventBuffer)
 
-	// Walk the initial directory tree and add all subdirectories to the watcher.
-	err = filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+	if t.pollInterval > 0 {
+		files, err := t.scan()
 		if err != nil {
-			return err
+			return nil, err
 		}
-		if info.IsDir() {
-			// Skip ignored directories (node_modules, .next, .git, dist, build, .cache)
-			if ignoredDirs[info.Name()] {
-				return filepath.SkipDir
-			}
-			return watcher.Add(path)
+		for path := range files {
+			t.snapshotFile(path)
 		}
-		return nil
-	})
+		w := &Watcher{events: eventChan, stats: *t.stats, limits: t.limits}
+		t.stats = nil
+		go t.poll(files, eventChan)
+		return w, nil
+	}
 
+	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		watcher.Close()
 		return nil, err
 	}
+	t.fs = watcher
 
-	// Goroutine to handle events from fsnotify and filter them.
+	// Walk each root's directory tree and add all subdirectories to the watcher.
+	for _, rootPath := range t.roots {
+		if err := t.resetIgnores(rootPath); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+		if err := t.addTree(rootPath, rootPath, t.snapshotFile); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+	t.reportLimit()
+	w := &Watcher{events: eventChan, stats: *t.stats, limits: t.limits}
+	t.stats = nil
+
+	// Goroutine to handle events from fsnotify and filter them. Events are
+	// queued rather than sent directly so a slow consumer never stalls the
+	// fsnotify loop; while they wait, repeated events for a path collapse
+	// into one.
 	go func() {
 		defer watcher.Close()
 		defer close(eventChan)
 
+		var q queue
 		for {
+			// Only offer an event to the consumer when one is waiting
+			var out chan<- Event
+			var next Event
+			if q.len() > 0 {
+				out = eventChan
+				next = q.peek()
+			}
+
 			select {
+			case out <- next:
+				q.pop()
+
 			case event, ok := <-watcher.Events:
 				if !ok {
 					return
 				}
 
-				if event.Op.Has(fsnotify.Write) || event.Op.Has(fsnotify.Create) {
-					// Skip files inside ignored directories (e.g., .next created at runtime)
-					if isInIgnoredDir(event.Name) {
-						continue
-					}
+				// An edited .gitignore changes what is ignored from now on
+				if filepath.Base(event.Name) == ".gitignore" {
+					t.reloadGitignore(event.Name)
+				}
 
-					// Skip files that should be ignored (lock files, etc.)
-					if shouldIgnoreFile(event.Name) {
+				// A deleted or renamed directory takes its watches with it;
+				// a deleted or renamed file is a change like any other.
+				if event.Op.Has(fsnotify.Remove) || event.Op.Has(fsnotify.Rename) {
+					if t.watched[event.Name] {
+						t.unwatchTree(event.Name)
 						continue
 					}
+					if t.hashes != nil {
+						t.hashes.forget(event.Name)
+					}
+					if t.snapshots != nil {
+						t.snapshots.forget(event.Name)
+					}
+					if ev, ok := t.accept(event.Name, opFrom(event.Op)); ok {
+						q.push(ev)
+					}
+					continue
+				}
 
-					isTarget := false
-					for _, ext := range extensions {
-						if strings.HasSuffix(event.Name, ext) {
-							isTarget = true
-							break
+				if event.Op.Has(fsnotify.Create) {
+					// New directories aren't covered by the initial walk, so add
+					// them (and anything already inside) now. Files created
+					// before the watch was in place are reported directly.
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						root := rootFor(t.roots, event.Name)
+						var pending []Event
+						err := t.addTree(root, event.Name, func(path string) {
+							ev, ok := t.accept(path, Create)
+							if ok && (t.hashes == nil || t.hashes.changed(path)) {
+								pending = append(pending, t.withDiff(ev))
+							}
+						})
+						if err != nil {
+							logging.Printf("watcher error: %v", err)
 						}
+						t.reportLimit()
+						for _, ev := range pending {
+							q.push(ev)
+						}
+						continue
 					}
-					if isTarget {
-						eventChan <- Event{Path: event.Name}
+				}
+
+				if event.Op.Has(fsnotify.Write) || event.Op.Has(fsnotify.Create) {
+					ev, ok := t.accept(event.Name, opFrom(event.Op))
+					// Saving without changes, or twice in a row, rewrites
+					// the same content
+					if ok && (t.hashes == nil || t.hashes.changed(event.Name)) {
+						q.push(t.withDiff(ev))
 					}
 				}
 
@@ -120,10 +392,438 @@ func New(rootPath string, extensions []string) (<-chan Event, error) {
 				if !ok {
 					return
 				}
-				log.Printf("watcher error: %v", err)
+				logging.Printf("watcher error: %v", err)
 			}
 		}
 	}()
 
-	return eventChan, nil
+	return w, nil
+}
+
+// newTree sets up the rules for watching rootPaths, as New does, without
+// walking or watching anything yet.
+func newTree(rootPaths []string, patterns []string, opts []Option) (*tree, error) {
+	t := &tree{
+		filter:       newMatcher(patterns),
+		watched:      make(map[string]bool),
+		gitignores:   make(map[string]*gitignore),
+		useGitignore: true,
+		hashes:       newContentHashes(),
+		stats:        &Stats{},
+		files:        make(map[string]bool),
+
+		reflexignores: make(map[string]*gitignore),
+		limits:        make(chan WatchLimit, 1),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	// Compile exclude expressions once rather than on every event
+	for _, expr := range t.excludeExprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", expr, err)
+		}
+		t.excludeRegexps = append(t.excludeRegexps, re)
+	}
+
+	rootPaths, err := distinctRoots(rootPaths)
+	if err != nil {
+		return nil, err
+	}
+	t.roots = rootPaths
+	return t, nil
+}
+
+// accept applies the ignore rules and patterns to a changed file, unless
+// it is one of the WithFiles files, and builds the event to deliver for it.
+func (t *tree) accept(name string, op Op) (Event, bool) {
+	if abs, err := filepath.Abs(name); err == nil && t.files[abs] {
+		return Event{Path: name, Root: rootFor(t.roots, name), Op: op}, true
+	}
+
+	// Skip files inside ignored directories (e.g., .next created at runtime)
+	if isInIgnoredDir(name) {
+		return Event{}, false
+	}
+
+	// Skip files that should be ignored (lock files, etc.)
+	if shouldIgnoreFile(name) {
+		return Event{}, false
+	}
+
+	if t.excludedByRegexp(name) {
+		return Event{}, false
+	}
+
+	// Patterns are evaluated relative to the watch root
+	root := rootFor(t.roots, name)
+	rel, err := filepath.Rel(root, name)
+	if err != nil {
+		rel = name
+	}
+	if t.ignoredByFile(root, filepath.ToSlash(rel), false) {
+		return Event{}, false
+	}
+	if !t.filter.match(rel) {
+		return Event{}, false
+	}
+	return Event{Path: name, Root: root, Op: op}, true
+}
+
+// snapshotFile keeps the content of path for diffing, with WithDiffs, if
+// it is a file a change to would be reported.
+func (t *tree) snapshotFile(path string) {
+	if t.snapshots == nil {
+		return
+	}
+	if _, ok := t.accept(path, Write); ok {
+		t.snapshots.remember(path)
+	}
+}
+
+// withDiff fills in the diff of a write or create event, with WithDiffs.
+func (t *tree) withDiff(ev Event) Event {
+	if t.snapshots != nil && ev.Op&(Write|Create) != 0 {
+		ev.Diff = t.snapshots.diff(ev.Root, ev.Path, ev.Op&Create != 0)
+	}
+	return ev
+}
+
+// eventBuffer is the capacity of the channel returned by New. Beyond it,
+// events wait in a queue that coalesces repeats for the same path.
+const eventBuffer = 64
+
+// queue holds events the consumer hasn't taken yet, in arrival order, with
+// at most one entry per path. It is only used by the event goroutine.
+type queue struct {
+	events  []Event
+	index   map[string]int // Path to absolute position of its event
+	dropped int            // Events popped so far; events[0] is at this position
+}
+
+// push appends ev, or updates the pending event for the same path so the
+// consumer sees the latest operation without a duplicate.
+func (q *queue) push(ev Event) {
+	if pos, ok := q.index[ev.Path]; ok {
+		q.events[pos-q.dropped] = replaceEvent(q.events[pos-q.dropped], ev)
+		return
+	}
+	if q.index == nil {
+		q.index = make(map[string]int)
+	}
+	q.index[ev.Path] = q.dropped + len(q.events)
+	q.events = append(q.events, ev)
+}
+
+func (q *queue) len() int {
+	return len(q.events)
+}
+
+func (q *queue) peek() Event {
+	return q.events[0]
+}
+
+// pop removes the oldest event.
+func (q *queue) pop() {
+	delete(q.index, q.events[0].Path)
+	q.events = q.events[1:]
+	q.dropped++
+}
+
+// tree tracks the directories registered with fsnotify and the rules used to
+// decide which ones to register. After New returns it is only touched by the
+// event goroutine.
+type tree struct {
+	roots        []string          // Watch roots, none inside another
+	fs           *fsnotify.Watcher // nil when polling
+	filter       matcher
+	watched      map[string]bool       // Directories currently watched
+	gitignores   map[string]*gitignore // .gitignore rules per watch root
+	useGitignore bool
+
+	reflexignores map[string]*gitignore // Rules from the .reflexignore in each watch root
+
+	followSymlinks bool // Walk into linked directories, from WithFollowSymlinks
+
+	excludeExprs   []string         // Regular expressions from WithExcludeRegexps
+	excludeRegexps []*regexp.Regexp // Compiled excludeExprs
+
+	files map[string]bool // Absolute paths from WithFiles, reported regardless
+
+	hashes *contentHashes // Content of recently changed files; nil without the check
+
+	snapshots *snapshots // Content of the watched text files, from WithDiffs; nil without
+
+	pollInterval time.Duration // Scan this often instead of using fsnotify; 0 uses fsnotify
+	pollCapped   bool          // Warned that the tree has more than maxPolledFiles files
+
+	stats *Stats // Counts what the initial walk finds; nil once it is done
+
+	unwatched int             // Directories left unwatched for lack of watches
+	reported  int             // unwatched as last sent on limits
+	limits    chan WatchLimit // Holds the latest WatchLimit not yet taken
+}
+
+// resetIgnores forgets the .gitignore rules for root, to be read again as
+// its tree is walked, and reads the .reflexignore at its top, if there is
+// one.
+func (t *tree) resetIgnores(root string) error {
+	if t.useGitignore {
+		t.gitignores[root] = &gitignore{}
+	}
+	ignore := &gitignore{}
+	if err := ignore.loadFile(filepath.Join(root, ".reflexignore"), "."); err != nil {
+		return err
+	}
+	t.reflexignores[root] = ignore
+	return nil
+}
+
+// ignoredByFile reports whether rel (slash-separated, relative to root) is
+// ignored by a .gitignore or .reflexignore file.
+func (t *tree) ignoredByFile(root, rel string, isDir bool) bool {
+	return t.gitignores[root].ignored(rel, isDir) || t.reflexignores[root].ignored(rel, isDir)
+}
+
+// excludedByRegexp reports whether path matches any exclude expression.
+func (t *tree) excludedByRegexp(path string) bool {
+	if len(t.excludeRegexps) == 0 {
+		return false
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	path = filepath.ToSlash(path)
+	for _, re := range t.excludeRegexps {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// addTree walks dir and adds every directory that isn't ignored or excluded
+// by a pattern, and isn't watched already, to the watcher. Exclude patterns and .gitignore rules are
+// evaluated relative to rootPath. If onFile is non-nil it is called for every
+// regular file found along the way.
+func (t *tree) addTree(rootPath, dir string, onFile func(path string)) error {
+	return t.walkTree(rootPath, dir, func(path string) error {
+		if t.watched[path] {
+			return nil
+		}
+		if err := t.fs.Add(path); err != nil {
+			if !errors.Is(err, syscall.ENOSPC) {
+				return err
+			}
+			// Out of inotify watches: keep watching the rest, which
+			// reportLimit warns about
+			t.unwatched++
+			if t.stats != nil {
+				t.stats.WatchedDirs--
+				t.stats.UnwatchedDirs++
+			}
+			return nil
+		}
+		t.watched[path] = true
+		return nil
+	}, func(path string, d fs.DirEntry) {
+		if onFile != nil {
+			onFile(path)
+		}
+	})
+}
+
+// walkTree walks dir, calling onDir for every directory that isn't ignored
+// or excluded by a pattern and onFile for every regular file in them that
+// isn't excluded by a regular expression. Ignored directories are skipped
+// without being read. Exclude patterns and .gitignore rules are evaluated
+// relative to rootPath, and .gitignore files are loaded as they are found.
+// Entries that vanish during the walk are skipped. Symbolic links are only
+// followed with WithFollowSymlinks.
+func (t *tree) walkTree(rootPath, dir string, onDir func(path string) error, onFile func(path string, d fs.DirEntry)) error {
+	ignore := t.gitignores[rootPath]
+
+	walk := filepath.WalkDir
+	if t.followSymlinks {
+		walk = walkFollowingLinks
+	}
+	skip := func() error {
+		if t.stats != nil {
+			t.stats.IgnoredDirs++
+		}
+		return filepath.SkipDir
+	}
+	return walk(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path != dir {
+				return nil
+			}
+			return err
+		}
+		rel, relErr := filepath.Rel(rootPath, path)
+		if d.IsDir() {
+			// Skip ignored directories (node_modules, .next, .git, dist, build, .cache)
+			if ignoredDirs[d.Name()] {
+				return skip()
+			}
+			if path != rootPath && t.excludedByRegexp(path) {
+				return skip()
+			}
+			if relErr == nil && rel != "." {
+				// Skip directories pruned by an exclude pattern
+				if t.filter.excluded(rel) {
+					return skip()
+				}
+				// Skip directories listed in a .gitignore or .reflexignore
+				if t.ignoredByFile(rootPath, filepath.ToSlash(rel), true) {
+					return skip()
+				}
+			}
+			// Pick up this directory's own .gitignore before walking into it
+			if ignore != nil && relErr == nil {
+				if err := ignore.load(path, rel); err != nil {
+					return err
+				}
+			}
+			if t.stats != nil {
+				t.stats.WatchedDirs++
+			}
+			return onDir(path)
+		}
+		if t.excludedByRegexp(path) {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if t.stats != nil {
+				t.stats.WatchedFiles++
+			}
+			onFile(path, d)
+		}
+		return nil
+	})
+}
+
+// reportLimit sends a WatchLimit on limits if more directories have gone
+// unwatched since the last one, replacing one that hasn't been taken.
+func (t *tree) reportLimit() {
+	if t.unwatched == t.reported {
+		return
+	}
+	t.reported = t.unwatched
+	select {
+	case <-t.limits:
+	default:
+	}
+	t.limits <- WatchLimit{Watched: len(t.watched), Unwatched: t.unwatched}
+}
+
+// reloadGitignore reads the .gitignore at name again after a change to it,
+// and watches the directories below it that its old rules ignored. Nothing
+// is read for a directory that isn't watched, or without .gitignore support.
+func (t *tree) reloadGitignore(name string) {
+	dir := filepath.Dir(name)
+	root := rootFor(t.roots, dir)
+	ignore := t.gitignores[root]
+	if ignore == nil || !t.watched[dir] {
+		return
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return
+	}
+	if err := ignore.load(dir, rel); err != nil {
+		logging.Printf("watcher error: %v", err)
+		return
+	}
+	if err := t.addTree(root, dir, nil); err != nil {
+		logging.Printf("watcher error: %v", err)
+	}
+	t.reportLimit()
+}
+
+// unwatchTree removes the watch on dir and on every watched directory below
+// it, and forgets the .gitignore rules read from them.
+func (t *tree) unwatchTree(dir string) {
+	root := rootFor(t.roots, dir)
+	if rel, err := filepath.Rel(root, dir); err == nil {
+		t.gitignores[root].drop(rel)
+	}
+	prefix := dir + string(os.PathSeparator)
+	for path := range t.watched {
+		if path == dir || strings.HasPrefix(path, prefix) {
+			// fsnotify may already have dropped the watch for a deleted
+			// directory, so an error here is expected and harmless.
+			t.fs.Remove(path)
+			delete(t.watched, path)
+		}
+	}
+}
+
+// distinctRoots checks that each root is a directory, and drops roots that
+// repeat another or lie inside one, since walking the outer root already
+// covers them. The roots that are kept stay as given, in their original
+// order.
+func distinctRoots(rootPaths []string) ([]string, error) {
+	type root struct{ path, abs string }
+	var roots []root
+	for _, path := range rootPaths {
+		info, err := os.Stat(path)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("watch directory %q does not exist", path)
+			}
+			return nil, fmt.Errorf("cannot watch %q: %w", path, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("cannot watch %q: not a directory", path)
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot watch %q: %w", path, err)
+		}
+		roots = append(roots, root{path: filepath.Clean(path), abs: abs})
+	}
+
+	var distinct []string
+	for i, r := range roots {
+		covered := false
+		for j, other := range roots {
+			if i == j {
+				continue
+			}
+			rel, err := filepath.Rel(other.abs, r.abs)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+				continue
+			}
+			// The same directory twice keeps its first mention
+			if rel != "." || j < i {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			distinct = append(distinct, r.path)
+		}
+	}
+	return distinct, nil
+}
+
+// rootFor returns the watch root that contains path. When roots are nested
+// the most specific one wins.
+func rootFor(rootPaths []string, path string) string {
+	best := ""
+	for _, root := range rootPaths {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+			continue
+		}
+		if len(root) > len(best) {
+			best = root
+		}
+	}
+	if best == "" && len(rootPaths) > 0 {
+		best = rootPaths[0]
+	}
+	return best
 }
@@ -0,0 +1,417 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// eventTimeout is how long a test waits for an event it expects.
+const eventTimeout = 5 * time.Second
+
+// watchDir starts a watcher on a new temporary directory and returns the
+// directory, with symbolic links resolved so it matches the event paths.
+func watchDir(t *testing.T, patterns []string, opts ...Option) (string, *Watcher) {
+	t.Helper()
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := New([]string{dir}, patterns, opts...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return dir, w
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// save replaces the content of path as many editors do: by writing a
+// temporary file next to it and renaming that over it.
+func save(t *testing.T, path, content string) {
+	t.Helper()
+	tmp := path + ".tmp"
+	writeFile(t, tmp, content)
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// next returns the next event, failing the test if none arrives in time.
+func next(t *testing.T, w *Watcher) Event {
+	t.Helper()
+	select {
+	case ev := <-w.Events():
+		return ev
+	case <-time.After(eventTimeout):
+		t.Fatal("timed out waiting for an event")
+		return Event{}
+	}
+}
+
+// waitFor returns the first event for path, failing the test if one
+// doesn't arrive in time. Events for other paths are skipped.
+func waitFor(t *testing.T, w *Watcher, path string) Event {
+	t.Helper()
+	deadline := time.After(eventTimeout)
+	for {
+		select {
+		case ev := <-w.Events():
+			if ev.Path == path {
+				return ev
+			}
+		case <-deadline:
+			t.Fatalf("timed out waiting for an event for %s", path)
+			return Event{}
+		}
+	}
+}
+
+func TestNewDirectoryIsWatched(t *testing.T) {
+	dir, w := watchDir(t, []string{".txt"})
+
+	nested := filepath.Join(dir, "a", "b")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(nested, "new.txt")
+	writeFile(t, file, "one\n")
+	if ev := waitFor(t, w, file); ev.Op&(Create|Write) == 0 {
+		t.Errorf("event for a file in a new directory has op %v, want create or write", ev.Op)
+	}
+
+	// The new directory is watched from now on, not just walked once
+	writeFile(t, file, "two\n")
+	if ev := waitFor(t, w, file); ev.Op != Write {
+		t.Errorf("event for a write in a new directory has op %v, want write", ev.Op)
+	}
+
+	later := filepath.Join(nested, "later.txt")
+	writeFile(t, later, "three\n")
+	if ev := waitFor(t, w, later); ev.Op != Create {
+		t.Errorf("event for a file created later in a new directory has op %v, want create", ev.Op)
+	}
+}
+
+func TestRapidWrites(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "a.txt")
+	writeFile(t, file, "v0\n")
+	w, err := New([]string{dir}, []string{".txt"}, WithDiffs())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	// Nothing is read while writing, so the events pile up behind the
+	// channel
+	const writes = 100
+	for i := 1; i <= writes; i++ {
+		writeFile(t, file, fmt.Sprintf("v%d\n", i))
+	}
+
+	// However the writes were coalesced, the last event is for the last
+	// content
+	last := fmt.Sprintf("+v%d\n", writes)
+	deadline := time.After(eventTimeout)
+	for {
+		select {
+		case ev := <-w.Events():
+			if ev.Path == file && strings.Contains(ev.Diff, last) {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("no event for the last of %d writes", writes)
+		}
+	}
+}
+
+func TestManyFilesBeyondBuffer(t *testing.T) {
+	dir, w := watchDir(t, []string{".txt"})
+
+	const files = 3 * eventBuffer
+	for i := range files {
+		writeFile(t, filepath.Join(dir, fmt.Sprintf("%d.txt", i)), "x\n")
+	}
+
+	seen := make(map[string]bool)
+	deadline := time.After(eventTimeout)
+	for len(seen) < files {
+		select {
+		case ev := <-w.Events():
+			seen[ev.Path] = true
+		case <-deadline:
+			t.Fatalf("got events for %d of %d files", len(seen), files)
+		}
+	}
+}
+
+func TestSameContentIsNotAChange(t *testing.T) {
+	dir, w := watchDir(t, []string{".txt"})
+	file, other := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+
+	save(t, file, "one\n")
+	if ev := next(t, w); ev.Path != file {
+		t.Fatalf("first save: event for %s, want %s", ev.Path, file)
+	}
+
+	// Saving the same bytes again is followed by nothing but the change
+	// to the other file
+	save(t, file, "one\n")
+	save(t, other, "x\n")
+	if ev := next(t, w); ev.Path != other {
+		t.Fatalf("after saving the same content: event for %s, want only one for %s", ev.Path, other)
+	}
+
+	save(t, file, "two\n")
+	if ev := next(t, w); ev.Path != file {
+		t.Fatalf("after changing the content: event for %s, want %s", ev.Path, file)
+	}
+
+	// Without the check, every save is a change
+	dir, w = watchDir(t, []string{".txt"}, WithoutContentCheck())
+	file = filepath.Join(dir, "a.txt")
+	save(t, file, "one\n")
+	waitFor(t, w, file)
+	save(t, file, "one\n")
+	waitFor(t, w, file)
+}
+
+func TestIsEditorTempFile(t *testing.T) {
+	tests := []struct {
+		base string
+		want bool
+	}{
+		{"main.go", false},
+		{"main.go~", true},
+		{".main.go.swp", true},
+		{".main.go.swo", true},
+		{".main.go.swx", true},
+		{"main.go___jb_tmp___", true},
+		{"main.go___jb_old___", true},
+		{".#main.go", true},
+		{"4913", true},
+		{"5036", true}, // 4913 + 123
+		{"2024", false},
+		{"404", false},
+		{"4914", false},
+		{"0", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isEditorTempFile(tt.base); got != tt.want {
+			t.Errorf("isEditorTempFile(%q) = %v, want %v", tt.base, got, tt.want)
+		}
+	}
+}
+
+func TestEditorSaveReportsOnlyTheFile(t *testing.T) {
+	dir, w := watchDir(t, []string{"*"})
+	file := filepath.Join(dir, "a.txt")
+	writeFile(t, file, "one\n")
+	waitFor(t, w, file)
+
+	// Vim probes the directory, then a JetBrains IDE saves safely: a
+	// temporary copy is renamed over the file, and the old one removed
+	probe := filepath.Join(dir, "4913")
+	writeFile(t, probe, "")
+	os.Remove(probe)
+	tmp, old := file+"___jb_tmp___", file+"___jb_old___"
+	writeFile(t, tmp, "two\n")
+	if err := os.Rename(file, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(old)
+
+	// A file named like a number is no temporary file
+	year := filepath.Join(dir, "2024")
+	writeFile(t, year, "x\n")
+
+	var sawFile bool
+	for {
+		ev := next(t, w)
+		switch ev.Path {
+		case file:
+			sawFile = true
+		case year:
+			if !sawFile {
+				t.Errorf("no event for %s", file)
+			}
+			return
+		default:
+			t.Errorf("event for %s, which the editor wrote while saving", ev.Path)
+		}
+	}
+}
+
+func TestRemoveAndRename(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b, c := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt"), filepath.Join(dir, "c.txt")
+	writeFile(t, a, "a\n")
+	writeFile(t, b, "b\n")
+	w, err := New([]string{dir}, []string{".txt"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	// rm
+	if err := os.Remove(a); err != nil {
+		t.Fatal(err)
+	}
+	if ev := next(t, w); ev.Path != a || ev.Op != Remove {
+		t.Errorf("after rm: %v event for %s, want remove for %s", ev.Op, ev.Path, a)
+	}
+
+	// mv: the old name is renamed away and the new one created
+	if err := os.Rename(b, c); err != nil {
+		t.Fatal(err)
+	}
+	if ev := next(t, w); ev.Path != b || ev.Op != Rename {
+		t.Errorf("after mv: %v event for %s, want rename for %s", ev.Op, ev.Path, b)
+	}
+	if ev := next(t, w); ev.Path != c || ev.Op != Create {
+		t.Errorf("after mv: %v event for %s, want create for %s", ev.Op, ev.Path, c)
+	}
+}
+
+func TestRemovedDirectoryCanBeRecreated(t *testing.T) {
+	dir, w := watchDir(t, []string{".txt"})
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(sub, "a.txt")
+	writeFile(t, file, "one\n")
+	waitFor(t, w, file)
+
+	// rm -r
+	if err := os.RemoveAll(sub); err != nil {
+		t.Fatal(err)
+	}
+	for waitFor(t, w, file).Op != Remove {
+		// A late event for the write
+	}
+
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, file, "two\n")
+	if ev := waitFor(t, w, file); ev.Op&(Create|Write) == 0 {
+		t.Errorf("in the recreated directory: %v event for %s, want create or write", ev.Op, file)
+	}
+}
+
+func TestGitignoreRulesPerDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, ".gitignore"), "*.log\n")
+	writeFile(t, filepath.Join(dir, "sub", ".gitignore"), "!keep.log\n")
+
+	var g gitignore
+	for range 2 {
+		if err := g.load(dir, "."); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.load(filepath.Join(dir, "sub"), "sub"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(g.rules[""]) + len(g.rules["sub"]); n != 2 {
+		t.Errorf("%d rules after loading twice, want 2", n)
+	}
+	// The deeper .gitignore decides
+	if g.ignored("sub/keep.log", false) {
+		t.Error("sub/keep.log is ignored, want it re-included by sub/.gitignore")
+	}
+	if !g.ignored("keep.log", false) {
+		t.Error("keep.log is not ignored")
+	}
+
+	g.drop("sub")
+	if !g.ignored("sub/keep.log", false) {
+		t.Error("sub/keep.log is not ignored after dropping sub's rules")
+	}
+
+	writeFile(t, filepath.Join(dir, ".gitignore"), "")
+	if err := g.load(dir, "."); err != nil {
+		t.Fatal(err)
+	}
+	if g.ignored("a.log", false) {
+		t.Error("a.log is ignored after its rule was removed")
+	}
+}
+
+func TestGitignoreEditApplies(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := filepath.Join(dir, "gen")
+	if err := os.Mkdir(gen, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	gitignore := filepath.Join(dir, ".gitignore")
+	writeFile(t, gitignore, "skip.txt\ngen/\n")
+	w, err := New([]string{dir}, []string{".txt"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	skip, marker := filepath.Join(dir, "skip.txt"), filepath.Join(dir, "marker.txt")
+	writeFile(t, skip, "one\n")
+	writeFile(t, marker, "one\n")
+	if ev := next(t, w); ev.Path != marker {
+		t.Fatalf("event for %s, want only %s while skip.txt is ignored", ev.Path, marker)
+	}
+
+	// Once the rules are gone, the file and the directory count
+	save(t, gitignore, "")
+	writeFile(t, skip, "two\n")
+	waitFor(t, w, skip)
+	generated := filepath.Join(gen, "a.txt")
+	writeFile(t, generated, "one\n")
+	waitFor(t, w, generated)
+}
+
+func TestGitignoreOfRemovedDirectoryIsForgotten(t *testing.T) {
+	dir, w := watchDir(t, []string{".txt"})
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(sub, ".gitignore"), "a.txt\n")
+	marker := filepath.Join(dir, "marker.txt")
+	writeFile(t, marker, "one\n")
+	waitFor(t, w, marker)
+
+	// rm -r, then the directory comes back without its .gitignore
+	if err := os.RemoveAll(sub); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, marker, "two\n")
+	waitFor(t, w, marker)
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(sub, "a.txt")
+	writeFile(t, file, "one\n")
+	waitFor(t, w, file)
+}